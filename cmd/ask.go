@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/warm3snow/tama/internal/llm"
+	"github.com/warm3snow/tama/internal/logging"
+	"github.com/warm3snow/tama/internal/ui"
+)
+
+// Exit codes used by non-interactive commands
+const (
+	ExitOK            = 0
+	ExitInternalError = 1 // Unexpected failure inside tama
+	ExitUserError     = 2 // Bad arguments, missing input or invalid configuration
+	ExitProviderError = 3 // The LLM provider request failed
+)
+
+// Output formats supported by ask
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+// maxStdinBytes caps how much piped input is attached to the prompt
+const maxStdinBytes = 1 << 20
+
+// askResult is the machine-readable result of an ask command
+type askResult struct {
+	Content      string    `json:"content"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	FinishReason string    `json:"finish_reason"`
+	Usage        llm.Usage `json:"usage"`
+}
+
+// askEvent is a single line of ndjson output
+type askEvent struct {
+	Type         string     `json:"type"` // "chunk", "done" or "error"
+	Content      string     `json:"content,omitempty"`
+	Provider     string     `json:"provider,omitempty"`
+	Model        string     `json:"model,omitempty"`
+	FinishReason string     `json:"finish_reason,omitempty"`
+	Usage        *llm.Usage `json:"usage,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	ErrorType    string     `json:"error_type,omitempty"`
+}
+
+// askCmd represents the ask command
+var askCmd = &cobra.Command{
+	Use:   "ask [question]",
+	Short: "Ask a single question non-interactively",
+	Long: `Ask the AI a single question and print the answer. Anything piped to
+stdin is attached as context, which makes ask usable in scripts:
+
+  git diff | tama ask "review this"
+  tama ask --output json "summarize" < notes.txt
+
+Exit codes: 0 success, 1 internal error, 2 user or configuration error,
+3 provider error.`,
+	// Errors are reported by ask itself in the requested output format
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		if code := runAsk(cmd, args, output); code != ExitOK {
+			return &exitError{code: code}
+		}
+		return nil
+	},
+}
+
+// runAsk executes the ask command and returns the process exit code
+func runAsk(cmd *cobra.Command, args []string, output string) int {
+	switch output {
+	case outputText, outputJSON, outputNDJSON:
+	default:
+		return askFail(outputText, ExitUserError, fmt.Errorf("unsupported output format %q (use text, json or ndjson)", output))
+	}
+
+	cop := GetCopilot(cmd)
+	if cop == nil {
+		return askFail(output, ExitInternalError, fmt.Errorf("failed to initialize copilot"))
+	}
+
+	// Attach piped input as context
+	var stdinContent string
+	if !isTerminal(os.Stdin) {
+		content, err := io.ReadAll(io.LimitReader(os.Stdin, maxStdinBytes+1))
+		if err != nil {
+			return askFail(output, ExitUserError, fmt.Errorf("failed to read stdin: %v", err))
+		}
+		if len(content) > maxStdinBytes {
+			return askFail(output, ExitUserError, fmt.Errorf("stdin exceeds %d bytes", maxStdinBytes))
+		}
+		stdinContent = string(content)
+	}
+
+	prompt := buildAskPrompt(strings.Join(args, " "), stdinContent)
+	if prompt == "" {
+		return askFail(output, ExitUserError, fmt.Errorf("no question given and nothing piped to stdin"))
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	out := ui.NewResponseWriter(os.Stdout, renderMarkdown())
+	var callback func(string)
+	switch output {
+	case outputText:
+		callback = func(chunk string) {
+			out.Write([]byte(chunk))
+		}
+	case outputNDJSON:
+		callback = func(chunk string) {
+			encoder.Encode(askEvent{Type: "chunk", Content: chunk})
+		}
+	}
+
+	completion, err := cop.Ask(prompt, callback)
+	if err != nil {
+		logging.LogError("Ask failed", "error", err)
+		var configErr *llm.ConfigError
+		if errors.As(err, &configErr) {
+			return askFail(output, ExitUserError, err)
+		}
+		return askFail(output, ExitProviderError, err)
+	}
+
+	switch output {
+	case outputText:
+		out.Flush()
+		if !strings.HasSuffix(completion.Content, "\n") {
+			fmt.Println()
+		}
+	case outputJSON:
+		encoder.SetIndent("", "  ")
+		encoder.Encode(askResult{
+			Content:      completion.Content,
+			Provider:     cop.GetProvider(),
+			Model:        completion.Model,
+			FinishReason: completion.FinishReason,
+			Usage:        completion.Usage,
+		})
+	case outputNDJSON:
+		encoder.Encode(askEvent{
+			Type:         "done",
+			Provider:     cop.GetProvider(),
+			Model:        completion.Model,
+			FinishReason: completion.FinishReason,
+			Usage:        &completion.Usage,
+		})
+	}
+
+	return ExitOK
+}
+
+// buildAskPrompt combines the question with piped context
+func buildAskPrompt(question, stdinContent string) string {
+	question = strings.TrimSpace(question)
+	if strings.TrimSpace(stdinContent) == "" {
+		return question
+	}
+
+	var prompt strings.Builder
+	if question != "" {
+		prompt.WriteString(question)
+		prompt.WriteString("\n\n")
+	}
+	prompt.WriteString("Input:\n```\n")
+	prompt.WriteString(stdinContent)
+	if !strings.HasSuffix(stdinContent, "\n") {
+		prompt.WriteString("\n")
+	}
+	prompt.WriteString("```\n")
+	return prompt.String()
+}
+
+// askFail reports an error in the requested output format and returns the exit code
+func askFail(output string, code int, err error) int {
+	errorType := "internal"
+	switch code {
+	case ExitUserError:
+		errorType = "user"
+	case ExitProviderError:
+		errorType = "provider"
+	}
+
+	switch output {
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(map[string]string{"error": err.Error(), "error_type": errorType})
+	case outputNDJSON:
+		json.NewEncoder(os.Stdout).Encode(askEvent{Type: "error", Error: err.Error(), ErrorType: errorType})
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+
+	return code
+}
+
+func init() {
+	rootCmd.AddCommand(askCmd)
+
+	askCmd.Flags().StringP("output", "o", outputText, "Output format: text, json or ndjson")
+	askCmd.Flags().StringP("model", "m", "", "Specify the AI model to use")
+	askCmd.Flags().StringP("provider", "p", "", "Specify the AI provider (openai, ollama)")
+}
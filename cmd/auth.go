@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+	"github.com/warm3snow/tama/internal/config"
+	"github.com/warm3snow/tama/internal/logging"
+)
+
+// authCmd represents the auth command
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage secrets in the encrypted secrets store",
+	Long: `Manage API keys and other secrets in a passphrase-encrypted store
+(~/.config/tama/secrets.enc). Reference a stored secret from the config
+file with "api_key": "secret:<name>".
+
+The passphrase is read from TAMA_SECRETS_PASSPHRASE or prompted for.`,
+}
+
+// authSetCmd stores a secret
+var authSetCmd = &cobra.Command{
+	Use:   "set <name> [value]",
+	Short: "Store a secret",
+	Long: `Store a secret under the given name. If the value is omitted it is
+prompted for without echo, which keeps it out of the shell history.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		var value string
+		if len(args) == 2 {
+			value = args[1]
+		} else {
+			secret, err := readline.Password(fmt.Sprintf("Value for %s: ", name))
+			if err != nil {
+				exitWithError("Failed to read secret", err)
+			}
+			value = strings.TrimSpace(string(secret))
+		}
+		if value == "" {
+			exitWithError("Failed to store secret", fmt.Errorf("secret value must not be empty"))
+		}
+
+		store, err := config.OpenSecretStore()
+		if err != nil {
+			exitWithError("Failed to open secrets store", err)
+		}
+		store.Set(name, value)
+		if err := store.Save(); err != nil {
+			exitWithError("Failed to save secrets store", err)
+		}
+
+		fmt.Printf("Stored secret %s. Reference it with \"api_key\": \"%s%s\"\n", name, config.SecretStorePrefix, name)
+	},
+}
+
+// authListCmd lists stored secret names
+var authListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stored secret names",
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := config.OpenSecretStore()
+		if err != nil {
+			exitWithError("Failed to open secrets store", err)
+		}
+
+		names := store.Names()
+		if len(names) == 0 {
+			fmt.Println("No secrets stored.")
+			return
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	},
+}
+
+// authRemoveCmd removes a stored secret
+var authRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a stored secret",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := config.OpenSecretStore()
+		if err != nil {
+			exitWithError("Failed to open secrets store", err)
+		}
+		if !store.Remove(args[0]) {
+			exitWithError("Failed to remove secret", fmt.Errorf("secret %s not found", args[0]))
+		}
+		if err := store.Save(); err != nil {
+			exitWithError("Failed to save secrets store", err)
+		}
+
+		fmt.Printf("Removed secret %s\n", args[0])
+	},
+}
+
+// promptPassphrase reads the secrets store passphrase from the environment,
+// falling back to an interactive prompt when stdin is a terminal
+func promptPassphrase(prompt string) ([]byte, error) {
+	if passphrase := os.Getenv(config.SecretsPassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if !isTerminal(os.Stdin) {
+		return nil, fmt.Errorf("secrets store is locked: set %s", config.SecretsPassphraseEnv)
+	}
+	return readline.Password(prompt)
+}
+
+// exitWithError logs and prints an error, then exits
+func exitWithError(msg string, err error) {
+	logging.LogError(msg, "error", err)
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(1)
+}
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authSetCmd)
+	authCmd.AddCommand(authListCmd)
+	authCmd.AddCommand(authRemoveCmd)
+
+	config.PassphraseFunc = promptPassphrase
+}
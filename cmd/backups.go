@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/warm3snow/tama/internal/backup"
+)
+
+// backupsCmd represents the backups command
+var backupsCmd = &cobra.Command{
+	Use:   "backups",
+	Short: "List, restore and prune file backups",
+	Long: `Files are backed up to .tama/backups in the project before the agent
+changes them. Each backup records the file's path, a SHA-256 hash of its
+content, the task that made it and when. Identical contents are stored once.`,
+}
+
+// backupsListCmd lists backups
+var backupsListCmd = &cobra.Command{
+	Use:   "list [path]",
+	Short: "List backups, optionally only those of one file",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store := openBackupStore(cmd)
+		entries, err := store.List()
+		if err != nil {
+			exitWithError("Failed to list backups", err)
+		}
+
+		shown := 0
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			if len(args) > 0 && e.Path != strings.TrimPrefix(args[0], "./") {
+				continue
+			}
+			task := e.TaskID
+			if task == "" {
+				task = "-"
+			}
+			fmt.Printf("%s  %s  %8d  %-20s %s\n", e.ID, e.Time.Format("2006-01-02 15:04:05"), e.Size, task, e.Path)
+			shown++
+		}
+		if shown == 0 {
+			fmt.Println("No backups found.")
+		}
+	},
+}
+
+// backupsRestoreCmd restores a backup
+var backupsRestoreCmd = &cobra.Command{
+	Use:   "restore <id|path>",
+	Short: "Restore a backup after verifying its hash",
+	Long: `Restore a backup by ID, or the latest backup of a file by its path. A
+unique prefix of the ID is accepted. The content is checked against its
+recorded hash before the file is replaced.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store := openBackupStore(cmd)
+		entry, err := store.Find(strings.TrimPrefix(args[0], "./"))
+		if err != nil {
+			exitWithError("Failed to find backup", err)
+		}
+
+		target, _ := cmd.Flags().GetString("to")
+		if err := store.Restore(entry, target); err != nil {
+			exitWithError("Failed to restore backup", err)
+		}
+		if target == "" {
+			target = entry.Path
+		}
+		fmt.Printf("Restored %s from backup %s (%s)\n", target, entry.ID, entry.Time.Format("2006-01-02 15:04:05"))
+	},
+}
+
+// backupsPruneCmd removes old backups
+var backupsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old backups",
+	Long: `Remove backups beyond the newest --keep of each file and, with
+--older-than, backups older than the given age (for example 72h or 30d).
+Contents no other backup refers to are deleted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keep, _ := cmd.Flags().GetInt("keep")
+		olderThan, _ := cmd.Flags().GetString("older-than")
+
+		var before time.Time
+		if olderThan != "" {
+			age, err := parseAge(olderThan)
+			if err != nil {
+				exitWithError("Invalid --older-than", err)
+			}
+			before = time.Now().Add(-age)
+		}
+
+		removed, err := openBackupStore(cmd).Prune(keep, before)
+		if err != nil {
+			exitWithError("Failed to prune backups", err)
+		}
+		fmt.Printf("Removed %d backups\n", len(removed))
+	},
+}
+
+// openBackupStore opens the backup store of the --project directory
+func openBackupStore(cmd *cobra.Command) *backup.Store {
+	projectPath, err := resolveProjectPath(cmd)
+	if err != nil {
+		exitWithError("Failed to resolve project path", err)
+	}
+	return backup.Open(projectPath)
+}
+
+// parseAge parses a duration, also accepting a number of days such as 30d
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days: %s", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func init() {
+	rootCmd.AddCommand(backupsCmd)
+	backupsCmd.AddCommand(backupsListCmd)
+	backupsCmd.AddCommand(backupsRestoreCmd)
+	backupsCmd.AddCommand(backupsPruneCmd)
+
+	backupsCmd.PersistentFlags().StringP("project", "d", "", "Project directory (default: current directory)")
+	backupsRestoreCmd.Flags().String("to", "", "Restore to this path instead of the original one")
+	backupsPruneCmd.Flags().Int("keep", 10, "Backups to keep of each file, 0 for no limit")
+	backupsPruneCmd.Flags().String("older-than", "", "Also remove backups older than this age, such as 72h or 30d")
+}
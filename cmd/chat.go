@@ -7,6 +7,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/warm3snow/tama/internal/logging"
+	"github.com/warm3snow/tama/internal/ui"
 )
 
 // chatCmd represents the chat command
@@ -17,9 +18,6 @@ var chatCmd = &cobra.Command{
 You can provide a message directly as an argument, or omit it
 to enter interactive chat mode.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Print logo before starting chat
-		PrintLogo("Chat")
-
 		// Get copilot instance from context
 		cop := GetCopilot(cmd)
 		if cop == nil {
@@ -29,6 +27,12 @@ to enter interactive chat mode.`,
 
 		// Check if we're in interactive mode or single message mode
 		isInteractive := len(args) == 0
+		if isInteractive {
+			chooseThemeOnFirstRun(cop)
+		}
+
+		// Print logo before starting chat
+		PrintLogo("Chat")
 
 		if isInteractive {
 			// Start interactive chat session
@@ -48,9 +52,11 @@ to enter interactive chat mode.`,
 			}
 
 			// Print the response
+			out := ui.NewResponseWriter(os.Stdout, renderMarkdown())
 			for chunk := range respChan {
-				fmt.Print(chunk)
+				out.Write([]byte(chunk))
 			}
+			out.Flush()
 			fmt.Println()
 		}
 	},
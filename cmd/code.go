@@ -8,6 +8,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/warm3snow/tama/internal/logging"
+	"github.com/warm3snow/tama/internal/tools"
 )
 
 // codeCmd represents the code command
@@ -20,36 +21,24 @@ var codeCmd = &cobra.Command{
 - Fix bugs and improve code quality
 - Review and rollback changes`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Print logo before starting
-		PrintLogo("Code")
-
 		// Get copilot instance from context
 		cop := GetCopilot(cmd)
 		if cop == nil {
 			fmt.Println("Error: Failed to initialize copilot")
 			os.Exit(1)
 		}
+		chooseThemeOnFirstRun(cop)
+		cop.SetToolMode(toolMode(cmd))
+
+		// Print logo before starting
+		PrintLogo("Code")
 
 		// Get project path
-		projectPath, _ := cmd.Flags().GetString("project")
-		if projectPath == "" {
-			// Use current directory if not specified
-			var err error
-			projectPath, err = os.Getwd()
-			if err != nil {
-				logging.LogError("Failed to get current directory", "error", err)
-				fmt.Printf("Error: %v\n", err)
-				os.Exit(1)
-			}
-		} else {
-			// Convert to absolute path
-			var err error
-			projectPath, err = filepath.Abs(projectPath)
-			if err != nil {
-				logging.LogError("Failed to resolve project path", "error", err)
-				fmt.Printf("Error: %v\n", err)
-				os.Exit(1)
-			}
+		projectPath, err := resolveProjectPath(cmd)
+		if err != nil {
+			logging.LogError("Failed to resolve project path", "error", err)
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
 
 		// Set project path in copilot
@@ -79,6 +68,30 @@ var codeCmd = &cobra.Command{
 	},
 }
 
+// resolveProjectPath returns the absolute path of the --project directory,
+// defaulting to the current directory
+func resolveProjectPath(cmd *cobra.Command) (string, error) {
+	projectPath, _ := cmd.Flags().GetString("project")
+	if projectPath == "" {
+		// Use current directory if not specified
+		return os.Getwd()
+	}
+	// Convert to absolute path
+	return filepath.Abs(projectPath)
+}
+
+// toolMode returns the tool permission mode chosen with --yolo or
+// --read-only
+func toolMode(cmd *cobra.Command) tools.Mode {
+	if yolo, _ := cmd.Flags().GetBool("yolo"); yolo {
+		return tools.ModeYolo
+	}
+	if readOnly, _ := cmd.Flags().GetBool("read-only"); readOnly {
+		return tools.ModeReadOnly
+	}
+	return tools.ModeNormal
+}
+
 func init() {
 	rootCmd.AddCommand(codeCmd)
 
@@ -86,4 +99,7 @@ func init() {
 	codeCmd.Flags().StringP("model", "m", "", "Specify the AI model to use")
 	codeCmd.Flags().StringP("provider", "p", "", "Specify the AI provider (openai, ollama)")
 	codeCmd.Flags().StringP("project", "d", "", "Specify the project directory (default: current directory)")
+	codeCmd.Flags().Bool("yolo", false, "Run tool calls that need approval without asking (deny rules still apply)")
+	codeCmd.Flags().Bool("read-only", false, "Refuse every tool call that could change files or run commands")
+	codeCmd.MarkFlagsMutuallyExclusive("yolo", "read-only")
 }
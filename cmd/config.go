@@ -17,6 +17,36 @@ var configCmd = &cobra.Command{
 	},
 }
 
+// configExplainCmd shows the effective configuration and where each value came from
+var configExplainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Show effective configuration values and their sources",
+	Long: `Show every effective configuration value together with the layer it came from.
+Layers are applied in order: built-in defaults, the global config file,
+the project .tama/config.json, environment variables and command line flags.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config.ExplainConfig(Config, ConfigSources)
+	},
+}
+
+// configProfilesCmd lists the configured profiles
+var configProfilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List configuration profiles and show the active one",
+	Long: `List the named profiles defined in the configuration. The active profile
+is selected with --profile, the TAMA_PROFILE environment variable or the
+"profile" key in the config file, in that order of precedence.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config.ShowProfiles(Config)
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configExplainCmd)
+	configCmd.AddCommand(configProfilesCmd)
+
+	configExplainCmd.Flags().StringP("model", "m", "", "Override the model as chat/code would")
+	configExplainCmd.Flags().StringP("provider", "p", "", "Override the provider as chat/code would")
+	configExplainCmd.Flags().StringP("project", "d", "", "Project directory to search for .tama/config.json")
 }
@@ -2,20 +2,25 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
-	"github.com/fatih/color"
+	"github.com/chzyer/readline"
 	"github.com/spf13/cobra"
 	"github.com/warm3snow/tama/internal/config"
 	"github.com/warm3snow/tama/internal/copilot"
 	"github.com/warm3snow/tama/internal/logging"
+	"github.com/warm3snow/tama/internal/ui"
 )
 
 var (
 	// Used for flags
-	cfgFile string
-	Config  config.Config
+	cfgFile       string
+	profile       string
+	raw           bool
+	Config        config.Config
+	ConfigSources config.Sources
 )
 
 // contextKey is a custom type for context keys
@@ -26,9 +31,15 @@ const (
 	copilotKey contextKey = "copilot"
 )
 
-// PrintLogo prints the TAMA ASCII art logo with the given subcommand name
+// PrintLogo prints the TAMA ASCII art logo with the given subcommand name.
+// Nothing is printed when stdout is not a terminal, so output stays clean
+// when piped into other programs.
 func PrintLogo(subcommand string) {
-	logoColor := color.New(color.FgCyan, color.Bold)
+	if !isTerminal(os.Stdout) {
+		return
+	}
+
+	logoColor := ui.CurrentTheme().Logo.Color()
 
 	// Print unified TAMA AI logo for all subcommands
 	logoColor.Printf(`
@@ -48,6 +59,17 @@ func PrintLogo(subcommand string) {
 	fmt.Println()
 }
 
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	return readline.IsTerminal(int(f.Fd()))
+}
+
+// renderMarkdown reports whether AI responses should be rendered as Markdown.
+// Rendering is off with --raw or when stdout is not a terminal.
+func renderMarkdown() bool {
+	return !raw && isTerminal(os.Stdout)
+}
+
 // rootCmd represents the base command
 var rootCmd = &cobra.Command{
 	Use:   "tama",
@@ -62,8 +84,23 @@ AI models, execute commands with AI analysis, and more.`,
 	},
 }
 
+// exitError ends tama with a specific exit code. It is returned by commands
+// that report their own errors, so the process exits only after cleanup.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() {
+	os.Exit(execute())
+}
+
+// execute runs the root command and returns the process exit code
+func execute() int {
 	// Initialize logger
 	if err := logging.InitLogger(); err != nil {
 		fmt.Printf("Error initializing logger: %v\n", err)
@@ -74,56 +111,135 @@ func Execute() {
 
 	logging.LogAppStart("1.0.0")
 
-	if err := rootCmd.Execute(); err != nil {
+	cmd, err := rootCmd.ExecuteC()
+
+	// Stop background commands the session left running
+	if cop := GetCopilot(cmd); cop != nil {
+		cop.Shutdown()
+	}
+
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	if err != nil {
 		logging.LogError("Command execution failed", "error", err)
 		fmt.Println(err)
-		os.Exit(1)
+		return 1
 	}
 
 	logging.LogAppExit()
+	return 0
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/tama/config.json)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "configuration profile to use (overrides TAMA_PROFILE)")
+	rootCmd.PersistentFlags().BoolVar(&raw, "raw", false, "print AI responses as raw Markdown without rendering")
 
-	// Set PreRun hook for all commands to ensure they have the context
-	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
-		if cmd.Context() == nil {
-			if ctx := rootCmd.Context(); ctx != nil {
-				cmd.SetContext(ctx)
-			}
-		}
+	// Load configuration for every command once its flags are parsed,
+	// so flag values can take part in the configuration layering
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return initConfig(cmd)
 	}
 }
 
-func initConfig() {
-	// Load config from file
+// configFlags maps command flags onto the configuration keys they override
+var configFlags = map[string]string{
+	"model":    "defaults.model",
+	"provider": "defaults.provider",
+}
+
+func initConfig(cmd *cobra.Command) error {
+	// The project config is searched from the project directory when given
+	projectPath, _ := cmd.Flags().GetString("project")
+
+	var overrides []config.FlagOverride
+	for flag, key := range configFlags {
+		if f := cmd.Flags().Lookup(flag); f != nil && f.Changed {
+			overrides = append(overrides, config.FlagOverride{Key: key, Flag: flag, Value: f.Value.String()})
+		}
+	}
+
+	// Load config from all layers
+	opts := config.LoadOptions{
+		ConfigPath:    cfgFile,
+		WorkspacePath: projectPath,
+		Profile:       profile,
+		Flags:         overrides,
+	}
+
 	var err error
-	Config, err = config.LoadConfig(cfgFile)
+	Config, ConfigSources, err = config.Load(opts)
+	if err != nil && cmd == askCmd {
+		// Scripts must not get answers from a configuration they did not write
+		logging.LogError("Failed to load config", "error", err)
+		output, _ := cmd.Flags().GetString("output")
+		return &exitError{code: askFail(output, ExitUserError, fmt.Errorf("invalid configuration: %v", err))}
+	}
 	if err != nil {
 		logging.LogError("Failed to load config, using defaults", "error", err)
+		fmt.Fprintf(os.Stderr, "Warning: failed to load config, using defaults: %v\n", err)
 		// If config file doesn't exist or has errors, use defaults
 		Config = config.GetDefaultConfig()
+		Config.GlobalFile = cfgFile
+		ConfigSources = make(config.Sources)
+	}
+
+	for _, warning := range Config.Warnings {
+		logging.LogError("Ignored configuration", "warning", warning)
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	// Apply the color theme before anything is printed
+	if err := ui.SetTheme(Config.UI.Theme); err != nil {
+		logging.LogError("Invalid theme, using default", "error", err)
+		fmt.Fprintf(os.Stderr, "Warning: %v, using %s\n", err, ui.DefaultTheme)
 	}
 
 	// Create copilot instance
 	cop := copilot.New(Config)
+	cop.SetConfigLoader(func(name string) (config.Config, error) {
+		opts.Profile = name
+		cfg, _, err := config.Load(opts)
+		return cfg, err
+	})
+	cop.SetMarkdown(renderMarkdown())
 
 	// Create context with copilot instance
-	ctx := context.WithValue(context.Background(), copilotKey, cop)
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cmd.SetContext(context.WithValue(ctx, copilotKey, cop))
+	return nil
+}
 
-	// Set context for root command and all subcommands
-	rootCmd.SetContext(ctx)
-	for _, cmd := range rootCmd.Commands() {
-		cmd.SetContext(ctx)
+// chooseThemeOnFirstRun shows the style picker when no theme has been chosen
+// yet and the session is interactive
+func chooseThemeOnFirstRun(cop *copilot.Copilot) {
+	if Config.UI.Theme != "" || !ui.ColorEnabled() || !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return
 	}
+
+	theme, err := ui.ShowInitialScreen()
+	if err != nil {
+		logging.LogError("Style picker failed", "error", err)
+		return
+	}
+	if err := cop.SetTheme(theme); err != nil {
+		logging.LogError("Failed to set theme", "error", err)
+		fmt.Printf("Warning: %v\n", err)
+	}
+	Config.UI.Theme = theme
 }
 
 // GetCopilot retrieves the copilot instance from the command context
 func GetCopilot(cmd *cobra.Command) *copilot.Copilot {
+	if cmd == nil || cmd.Context() == nil {
+		return nil
+	}
 	if cop, ok := cmd.Context().Value(copilotKey).(*copilot.Copilot); ok {
 		return cop
 	}
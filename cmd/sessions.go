@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/warm3snow/tama/internal/session"
+)
+
+// sessionsCmd represents the sessions command
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List and export saved chat and agent sessions",
+	Long: `Chat and agent sessions are saved as they run in
+~/.config/tama/sessions. Use "tama sessions list" to find a session and
+"tama sessions export" to share or archive its transcript.`,
+}
+
+// sessionsListCmd lists saved sessions
+var sessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved sessions, most recent first",
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions, err := session.List()
+		if err != nil {
+			exitWithError("Failed to list sessions", err)
+		}
+		if len(sessions) == 0 {
+			fmt.Println("No sessions saved.")
+			return
+		}
+		for _, s := range sessions {
+			fmt.Printf("%s  %s  %-24s %s\n", s.ID, s.Updated.Format("2006-01-02 15:04"), s.Model, s.Title())
+		}
+	},
+}
+
+// sessionsExportCmd exports a saved session
+var sessionsExportCmd = &cobra.Command{
+	Use:   "export <id>",
+	Short: "Export a session transcript as Markdown, JSON or HTML",
+	Long: `Export the transcript of a saved session, including messages,
+timestamps, tool calls and their results, the model used and any diffs the
+agent applied. A unique prefix of the session ID is accepted. The transcript
+is written to stdout unless --output is given.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		if !cmd.Flags().Changed("format") && output != "" {
+			format = session.FormatFromPath(output)
+		}
+
+		s, err := session.Load(args[0])
+		if err != nil {
+			exitWithError("Failed to load session", err)
+		}
+
+		out := os.Stdout
+		if output != "" {
+			file, err := os.Create(output)
+			if err != nil {
+				exitWithError("Failed to create output file", err)
+			}
+			defer file.Close()
+			out = file
+		}
+
+		if err := session.Export(out, s, strings.ToLower(format)); err != nil {
+			exitWithError("Failed to export session", err)
+		}
+		if output != "" {
+			fmt.Printf("Session %s exported to %s\n", s.ID, output)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionsCmd)
+	sessionsCmd.AddCommand(sessionsListCmd)
+	sessionsCmd.AddCommand(sessionsExportCmd)
+
+	sessionsExportCmd.Flags().StringP("format", "f", session.FormatMarkdown, "Export format: md, json or html")
+	sessionsExportCmd.Flags().StringP("output", "o", "", "Write to a file instead of stdout")
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/warm3snow/tama/internal/logging"
+	"github.com/warm3snow/tama/internal/tui"
+)
+
+// tuiCmd represents the tui command
+var tuiCmd = &cobra.Command{
+	Use:   "tui [goal]",
+	Short: "Start a full-screen chat or agent session",
+	Long: `Start a full-screen session with a scrollable conversation history,
+a multi-line input editor and a side panel showing the current task,
+changed files and token usage.
+
+Without a goal the session is a chat. With a goal the agent works on it
+and each step is reviewed with key bindings: a to accept, r to reject,
+A to reject all and stop, d to view the diff and q to quit.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !isTerminal(os.Stdout) || !isTerminal(os.Stdin) {
+			fmt.Println("Error: tui requires an interactive terminal")
+			os.Exit(1)
+		}
+
+		// Get copilot instance from context
+		cop := GetCopilot(cmd)
+		if cop == nil {
+			fmt.Println("Error: Failed to initialize copilot")
+			os.Exit(1)
+		}
+		chooseThemeOnFirstRun(cop)
+
+		projectPath, err := resolveProjectPath(cmd)
+		if err != nil {
+			logging.LogError("Failed to resolve project path", "error", err)
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := cop.SetProjectPath(projectPath); err != nil {
+			logging.LogError("Failed to set project path", "error", err)
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		opts := tui.Options{
+			Goal:     strings.Join(args, " "),
+			Markdown: !raw,
+		}
+		if err := tui.Run(cop, opts); err != nil {
+			logging.LogError("TUI session failed", "error", err)
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+
+	tuiCmd.Flags().StringP("model", "m", "", "Specify the AI model to use")
+	tuiCmd.Flags().StringP("provider", "p", "", "Specify the AI provider (openai, ollama)")
+	tuiCmd.Flags().StringP("project", "d", "", "Specify the project directory (default: current directory)")
+}
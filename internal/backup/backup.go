@@ -0,0 +1,271 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warm3snow/tama/internal/workspace"
+)
+
+// manifestName is the file listing every backup, one JSON entry per line
+const manifestName = "manifest.jsonl"
+
+// Entry records one backed up version of a file
+type Entry struct {
+	ID     string      `json:"id"`
+	Path   string      `json:"path"` // Slash-separated, relative to the workspace
+	Hash   string      `json:"hash"` // SHA-256 of the content
+	Size   int64       `json:"size"`
+	Mode   os.FileMode `json:"mode"`
+	TaskID string      `json:"task_id,omitempty"`
+	Time   time.Time   `json:"time"`
+}
+
+// Store keeps content-addressed backups of workspace files. Contents are
+// stored once per hash under objects/, and the manifest records which path
+// each backup came from.
+type Store struct {
+	root string // Workspace root
+	dir  string
+	mu   sync.Mutex
+}
+
+// Dir returns the backup directory of a workspace
+func Dir(root string) string {
+	return filepath.Join(root, ".tama", "backups")
+}
+
+// Open returns the backup store of a workspace
+func Open(root string) *Store {
+	return &Store{root: root, dir: Dir(root)}
+}
+
+// Save backs up content read from the workspace-relative path
+func (s *Store) Save(path string, content []byte, mode os.FileMode, taskID string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ensureDir(); err != nil {
+		return Entry{}, err
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	now := time.Now()
+	id := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", path, hash, now.UnixNano())))
+
+	entry := Entry{
+		ID:     hex.EncodeToString(id[:])[:12],
+		Path:   filepath.ToSlash(path),
+		Hash:   hash,
+		Size:   int64(len(content)),
+		Mode:   mode.Perm(),
+		TaskID: taskID,
+		Time:   now,
+	}
+
+	object := s.objectPath(hash)
+	if _, err := os.Stat(object); os.IsNotExist(err) {
+		if err := workspace.WriteFileAtomic(object, content, 0600); err != nil {
+			return Entry{}, fmt.Errorf("failed to store backup: %v", err)
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to encode backup entry: %v", err)
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, manifestName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to open backup manifest: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return Entry{}, fmt.Errorf("failed to update backup manifest: %v", err)
+	}
+	return entry, nil
+}
+
+// ensureDir creates the backup directory with a .gitignore ignoring all of
+// it, so backups, which may hold secrets, are never committed
+func (s *Store) ensureDir() error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	ignoreFile := filepath.Join(s.dir, ".gitignore")
+	if _, err := os.Stat(ignoreFile); os.IsNotExist(err) {
+		if err := os.WriteFile(ignoreFile, []byte("*\n"), 0644); err != nil {
+			return fmt.Errorf("failed to create %s: %v", ignoreFile, err)
+		}
+	}
+	return nil
+}
+
+// List returns all backups, oldest first
+func (s *Store) List() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Find returns the latest backup of the given workspace-relative path, or
+// else the backup with the given ID or unique ID prefix
+func (s *Store) Find(ref string) (Entry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	path := filepath.ToSlash(filepath.Clean(ref))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Path == path {
+			return entries[i], nil
+		}
+	}
+
+	var matches []Entry
+	for _, e := range entries {
+		if strings.HasPrefix(e.ID, ref) {
+			matches = append(matches, e)
+		}
+	}
+	switch {
+	case len(matches) == 1:
+		return matches[0], nil
+	case len(matches) > 1:
+		return Entry{}, fmt.Errorf("backup ID %s is ambiguous", ref)
+	}
+	return Entry{}, fmt.Errorf("no backup matches %s", ref)
+}
+
+// Read returns the content of a backup, checking it against the recorded hash
+func (s *Store) Read(e Entry) ([]byte, error) {
+	content, err := os.ReadFile(s.objectPath(e.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup %s: %v", e.ID, err)
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != e.Hash {
+		return nil, fmt.Errorf("backup %s of %s is corrupt: content does not match its hash", e.ID, e.Path)
+	}
+	return content, nil
+}
+
+// Restore writes a backup back to its path in the workspace, or to path if
+// it is not empty
+func (s *Store) Restore(e Entry, path string) error {
+	content, err := s.Read(e)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		path = e.Path
+	}
+
+	fullPath, err := workspace.NewResolver(s.root).Resolve(filepath.FromSlash(path))
+	if err != nil {
+		return err
+	}
+	if err := workspace.WriteFileAtomic(fullPath, content, e.Mode); err != nil {
+		return fmt.Errorf("failed to restore %s: %v", path, err)
+	}
+	if err := os.Chmod(fullPath, e.Mode.Perm()); err != nil {
+		return fmt.Errorf("failed to restore mode of %s: %v", path, err)
+	}
+	return nil
+}
+
+// Prune removes backups beyond the newest keep of each path and, if before
+// is not zero, backups made before it. keep 0 keeps any number. Contents no
+// longer referenced are deleted. The removed entries are returned.
+func (s *Store) Prune(keep int, before time.Time) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Count backups of each path from the newest
+	seen := make(map[string]int)
+	var kept, removed []Entry
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		seen[e.Path]++
+		if (keep > 0 && seen[e.Path] > keep) || (!before.IsZero() && e.Time.Before(before)) {
+			removed = append(removed, e)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	// Rewrite the manifest oldest first
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Time.Before(kept[j].Time) })
+	var buf strings.Builder
+	for _, e := range kept {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode backup entry: %v", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := workspace.WriteFileAtomic(filepath.Join(s.dir, manifestName), []byte(buf.String()), 0600); err != nil {
+		return nil, fmt.Errorf("failed to update backup manifest: %v", err)
+	}
+
+	referenced := make(map[string]bool)
+	for _, e := range kept {
+		referenced[e.Hash] = true
+	}
+	for _, e := range removed {
+		if !referenced[e.Hash] {
+			os.Remove(s.objectPath(e.Hash))
+		}
+	}
+	return removed, nil
+}
+
+// load reads the manifest, skipping damaged lines
+func (s *Store) load() ([]Entry, error) {
+	f, err := os.Open(filepath.Join(s.dir, manifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup manifest: %v", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.ID == "" || len(e.Hash) != sha256.Size*2 {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read backup manifest: %v", err)
+	}
+	return entries, nil
+}
+
+// objectPath returns where content with the given hash is stored
+func (s *Store) objectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash[:2], hash)
+}
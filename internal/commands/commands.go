@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SelectionEnv is the environment variable editors can use to pass the current selection
+const SelectionEnv = "TAMA_SELECTION"
+
+// Command is a user-defined slash command loaded from a Markdown file
+type Command struct {
+	Name         string   `yaml:"-"` // Command name without the leading slash
+	Description  string   `yaml:"description"`
+	Model        string   `yaml:"model"`         // Optional model override
+	AllowedTools []string `yaml:"allowed_tools"` // Optional tool restriction
+	Body         string   `yaml:"-"`             // Prompt template
+	Path         string   `yaml:"-"`             // File the command was loaded from
+}
+
+// RenderContext supplies the values and helpers available to command templates
+type RenderContext struct {
+	Args     string                               // Text typed after the command name
+	ReadFile func(path string) (string, error)    // Backs {{file "path"}}
+	Git      func(command string) (string, error) // Backs {{git "diff"}}
+}
+
+// Dirs returns the command directories in load order: the global directory
+// first, then the nearest project .tama/commands directory above workspacePath
+func Dirs(workspacePath string) []string {
+	var dirs []string
+
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(homeDir, ".config", "tama", "commands"))
+	}
+
+	dir, err := filepath.Abs(workspacePath)
+	if err != nil {
+		return dirs
+	}
+	for {
+		candidate := filepath.Join(dir, ".tama", "commands")
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			if len(dirs) == 0 || dirs[0] != candidate {
+				dirs = append(dirs, candidate)
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return dirs
+}
+
+// Load reads all *.md command files from dirs. Commands in later directories
+// override commands with the same name in earlier ones.
+func Load(dirs []string) (map[string]*Command, error) {
+	commands := make(map[string]*Command)
+
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.md"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list commands in %s: %v", dir, err)
+		}
+
+		for _, file := range files {
+			cmd, err := parseFile(file)
+			if err != nil {
+				return nil, err
+			}
+			commands[cmd.Name] = cmd
+		}
+	}
+
+	return commands, nil
+}
+
+// Names returns the sorted names of the given commands
+func Names(commands map[string]*Command) []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseFile parses a command file with optional YAML front matter
+func parseFile(path string) (*Command, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read command %s: %v", path, err)
+	}
+
+	cmd := &Command{
+		Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Path: path,
+	}
+
+	body := strings.ReplaceAll(string(content), "\r\n", "\n")
+	if strings.HasPrefix(body, "---\n") {
+		end := strings.Index(body[4:], "\n---")
+		if end == -1 {
+			return nil, fmt.Errorf("command %s: unterminated front matter", path)
+		}
+		if err := yaml.Unmarshal([]byte(body[4:4+end]), cmd); err != nil {
+			return nil, fmt.Errorf("command %s: invalid front matter: %v", path, err)
+		}
+		body = strings.TrimPrefix(body[4+end+4:], "\n")
+	}
+	cmd.Body = strings.TrimSpace(body)
+
+	if cmd.Body == "" {
+		return nil, fmt.Errorf("command %s has an empty body", path)
+	}
+
+	return cmd, nil
+}
+
+// Render expands the command template into a prompt
+func (c *Command) Render(ctx RenderContext) (string, error) {
+	funcs := template.FuncMap{
+		"args": func() string {
+			return ctx.Args
+		},
+		"file": func(path string) (string, error) {
+			if ctx.ReadFile == nil {
+				return "", fmt.Errorf("file access is not available")
+			}
+			return ctx.ReadFile(path)
+		},
+		"git": func(command string) (string, error) {
+			if ctx.Git == nil {
+				return "", fmt.Errorf("git is not available")
+			}
+			return ctx.Git(command)
+		},
+		"selection": selection,
+	}
+
+	tmpl, err := template.New(c.Name).Funcs(funcs).Parse(c.Body)
+	if err != nil {
+		return "", fmt.Errorf("command /%s: invalid template: %v", c.Name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return "", fmt.Errorf("command /%s: %v", c.Name, err)
+	}
+
+	return buf.String(), nil
+}
+
+// selection returns the current text selection: TAMA_SELECTION when an
+// editor provides it, otherwise the primary selection or clipboard
+func selection() (string, error) {
+	if text := os.Getenv(SelectionEnv); text != "" {
+		return text, nil
+	}
+
+	candidates := [][]string{
+		{"wl-paste", "--primary", "--no-newline"},
+		{"xclip", "-o", "-selection", "primary"},
+		{"xsel", "--primary", "--output"},
+		{"pbpaste"},
+	}
+	for _, candidate := range candidates {
+		if _, err := exec.LookPath(candidate[0]); err != nil {
+			continue
+		}
+		output, err := exec.Command(candidate[0], candidate[1:]...).Output()
+		if err == nil {
+			return string(output), nil
+		}
+	}
+
+	return "", fmt.Errorf("no selection available: set %s", SelectionEnv)
+}
@@ -1,10 +1,12 @@
 package config
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
 // ProviderType represents the type of LLM provider
@@ -26,8 +28,231 @@ type Provider struct {
 
 // Config represents the application configuration
 type Config struct {
+	Version   int                 `json:"version"`
+	Profile   string              `json:"profile,omitempty"` // Active profile name
 	Providers map[string]Provider `json:"providers"`
 	Defaults  DefaultProvider     `json:"defaults"`
+	Tools     ToolPolicy          `json:"tools"`
+	UI        UIConfig            `json:"ui"`
+	Redaction RedactionConfig     `json:"redaction"`
+	Profiles  map[string]Profile  `json:"profiles,omitempty"`
+
+	// GlobalFile is the global config file the configuration was loaded
+	// from; settings changed at runtime are saved there
+	GlobalFile string `json:"-"`
+
+	// Warnings report configuration that was ignored while loading
+	Warnings []string `json:"-"`
+}
+
+// ToolPolicy restricts which tools the agent may use
+type ToolPolicy struct {
+	Allow []string `json:"allow,omitempty"` // Tool names the agent may use, empty allows all
+	Deny  []string `json:"deny,omitempty"`  // Tool names the agent must never use
+
+	// DenyAll denies every tool, as when a command allows none of the
+	// tools the configuration permits. It is never read from a file.
+	DenyAll bool `json:"-"`
+
+	// ReadOnlyRoots are directories outside the workspace that tools may read
+	ReadOnlyRoots []string `json:"read_only_roots,omitempty"`
+
+	// Rules allow, ask about or deny single calls; the first matching rule
+	// wins and the built-in rules apply after them
+	Rules []ToolRule `json:"rules,omitempty"`
+
+	// ProjectRules are the ask and deny rules of the project config. They
+	// are checked separately and can only make a call stricter.
+	ProjectRules []ToolRule `json:"-"`
+
+	// Terminal limits the commands of run_terminal
+	Terminal TerminalConfig `json:"terminal"`
+}
+
+// Defaults of TerminalConfig
+const (
+	DefaultCommandTimeout = 2 * time.Minute
+	DefaultMaxOutput      = 64 * 1024
+)
+
+// Sandbox modes of TerminalConfig
+const (
+	SandboxNone    = "none"    // Run commands unisolated
+	SandboxAuto    = "auto"    // Use bubblewrap if installed, else unshare
+	SandboxBwrap   = "bwrap"   // Isolate with bubblewrap
+	SandboxUnshare = "unshare" // Isolate with Linux namespaces through unshare
+)
+
+// TerminalConfig sets the limits and isolation of terminal commands
+type TerminalConfig struct {
+	Timeout   string   `json:"timeout,omitempty"`    // Default time limit of a command such as "2m"
+	MaxOutput int      `json:"max_output,omitempty"` // Bytes of output kept, split between head and tail
+	Env       []string `json:"env,omitempty"`        // Environment variables passed on besides the safe defaults, globs allowed
+	Sandbox   string   `json:"sandbox,omitempty"`    // none, auto, bwrap or unshare; isolation needs Linux
+	NoNetwork bool     `json:"no_network,omitempty"` // Run commands without network access
+	Writable  []string `json:"writable,omitempty"`   // Directories a sandboxed command may write besides the workspace
+	Shell     string   `json:"shell,omitempty"`      // Program running commands with -c, default $SHELL or /bin/sh
+}
+
+// ToolRule decides about calls of a tool whose subject matches. The subject
+// of run_terminal is the command line, that of other tools the operation
+// and its path.
+type ToolRule struct {
+	Tool   string `json:"tool"`            // Tool name, "*" for every tool
+	Match  string `json:"match,omitempty"` // Glob, or a regular expression after "re:"; empty matches every call
+	Action string `json:"action"`          // allow, ask or deny
+}
+
+// Validate reports rules with an unknown action or an invalid pattern
+func (p ToolPolicy) Validate() error {
+	for _, rule := range p.Rules {
+		if rule.Tool == "" {
+			return fmt.Errorf("tool rule %q has no tool", rule.Match)
+		}
+		switch rule.Action {
+		case "allow", "ask", "deny":
+		default:
+			return fmt.Errorf("tool rule for %s has invalid action %q (want allow, ask or deny)", rule.Tool, rule.Action)
+		}
+		if pattern, ok := strings.CutPrefix(rule.Match, "re:"); ok {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid tool rule pattern for %s: %v", rule.Tool, err)
+			}
+		}
+	}
+	return p.Terminal.Validate()
+}
+
+// CommandTimeout returns the default time limit of a command
+func (t TerminalConfig) CommandTimeout() time.Duration {
+	if d, err := time.ParseDuration(t.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultCommandTimeout
+}
+
+// OutputLimit returns how many bytes of a command's output are kept
+func (t TerminalConfig) OutputLimit() int {
+	if t.MaxOutput > 0 {
+		return t.MaxOutput
+	}
+	return DefaultMaxOutput
+}
+
+// Tighten applies the tool policy of a project config, which can only take
+// permissions away: its denied tools are added, its allowed tools narrow the
+// allowed ones, its ask and deny rules are kept apart and its terminal limits
+// apply where they are stricter. Its allow rules, read-only roots, terminal
+// environment, writable directories and shell are ignored, so a cloned
+// repository cannot loosen the user's policy.
+func (p ToolPolicy) Tighten(project ToolPolicy) ToolPolicy {
+	tightened := p
+	tightened.Deny = append(append([]string(nil), p.Deny...), project.Deny...)
+	if len(project.Allow) > 0 {
+		tightened.Allow = nil
+		for _, tool := range project.Allow {
+			if p.Allows(tool) {
+				tightened.Allow = append(tightened.Allow, tool)
+			}
+		}
+		tightened.DenyAll = p.DenyAll || len(tightened.Allow) == 0
+	}
+
+	tightened.ProjectRules = append([]ToolRule(nil), p.ProjectRules...)
+	for _, rule := range project.Rules {
+		if rule.Action == "ask" || rule.Action == "deny" {
+			tightened.ProjectRules = append(tightened.ProjectRules, rule)
+		}
+	}
+
+	terminal := project.Terminal
+	if terminal.Timeout != "" && terminal.CommandTimeout() < p.Terminal.CommandTimeout() {
+		tightened.Terminal.Timeout = terminal.Timeout
+	}
+	if terminal.MaxOutput > 0 && terminal.MaxOutput < p.Terminal.OutputLimit() {
+		tightened.Terminal.MaxOutput = terminal.MaxOutput
+	}
+	if terminal.Sandbox != "" && terminal.Sandbox != SandboxNone &&
+		(p.Terminal.Sandbox == "" || p.Terminal.Sandbox == SandboxNone) {
+		tightened.Terminal.Sandbox = terminal.Sandbox
+	}
+	tightened.Terminal.NoNetwork = p.Terminal.NoNetwork || terminal.NoNetwork
+	return tightened
+}
+
+// Validate reports an invalid timeout, output limit or sandbox mode
+func (t TerminalConfig) Validate() error {
+	if t.Timeout != "" {
+		if d, err := time.ParseDuration(t.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid terminal timeout %q", t.Timeout)
+		}
+	}
+	if t.MaxOutput < 0 {
+		return fmt.Errorf("invalid terminal max_output %d", t.MaxOutput)
+	}
+	switch t.Sandbox {
+	case "", SandboxNone, SandboxAuto, SandboxBwrap, SandboxUnshare:
+	default:
+		return fmt.Errorf("invalid terminal sandbox %q (want none, auto, bwrap or unshare)", t.Sandbox)
+	}
+	return nil
+}
+
+// Allows reports whether the policy permits the named tool
+func (p ToolPolicy) Allows(tool string) bool {
+	if p.DenyAll {
+		return false
+	}
+	for _, denied := range p.Deny {
+		if denied == tool {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, allowed := range p.Allow {
+		if allowed == tool {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactionConfig controls how secrets and personal data are replaced with
+// placeholders before prompts are sent to the model
+type RedactionConfig struct {
+	Disabled bool            `json:"disabled,omitempty"` // Send prompts unchanged
+	Rules    []RedactionRule `json:"rules,omitempty"`    // Patterns redacted in addition to the built-in ones
+	Allow    []string        `json:"allow,omitempty"`    // Patterns of values that are never redacted
+	Entropy  float64         `json:"entropy,omitempty"`  // Bits per character above which tokens look random, negative to disable
+}
+
+// RedactionRule is a named regular expression. If it has a group, only the
+// group is redacted.
+type RedactionRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// Validate reports invalid patterns
+func (r RedactionConfig) Validate() error {
+	for _, rule := range r.Rules {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid redaction rule %s: %v", rule.Name, err)
+		}
+	}
+	for _, pattern := range r.Allow {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid redaction allow pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// UIConfig holds terminal appearance settings
+type UIConfig struct {
+	Theme string `json:"theme,omitempty"` // Color theme name, empty until chosen on first run
 }
 
 // DefaultProvider represents the default provider configuration
@@ -41,6 +266,7 @@ type DefaultProvider struct {
 // GetDefaultConfig returns the default configuration
 func GetDefaultConfig() Config {
 	config := Config{
+		Version: CurrentVersion,
 		Providers: map[string]Provider{
 			"openai": {
 				Type:    OpenAI,
@@ -65,118 +291,59 @@ func GetDefaultConfig() Config {
 	return config
 }
 
-// LoadConfig initializes and loads the configuration
+// LoadConfig initializes and loads the configuration from all layers,
+// using the current directory for the project config search
 func LoadConfig(configPath string) (Config, error) {
-	var configFile string
-
-	// If configPath is provided, use it
-	if configPath != "" {
-		configFile = configPath
-	} else {
-		// Otherwise use default location
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return Config{}, fmt.Errorf("failed to get home directory: %v", err)
-		}
-
-		configDir := filepath.Join(homeDir, ".config", "tama")
-		if err := os.MkdirAll(configDir, 0755); err != nil {
-			return Config{}, fmt.Errorf("failed to create config directory: %v", err)
-		}
-
-		configFile = filepath.Join(configDir, "config.json")
-	}
-
-	// Check if config file exists
-	if _, err := os.Stat(configFile); os.IsNotExist(err) {
-		// Config doesn't exist, create default
-		config := GetDefaultConfig()
-
-		// Save the default config to file
-		if err := config.SaveToFile(configFile); err != nil {
-			return Config{}, err
-		}
-
-		return config, nil
-	} else {
-		// Config exists, load it
-		file, err := os.Open(configFile)
-		if err != nil {
-			return Config{}, fmt.Errorf("failed to open config file: %v", err)
-		}
-		defer file.Close()
-
-		var config Config
-		decoder := json.NewDecoder(file)
-		if err := decoder.Decode(&config); err != nil {
-			return Config{}, fmt.Errorf("failed to parse config file: %v", err)
-		}
-
-		// Ensure provider types are properly set
-		for name, provider := range config.Providers {
-			switch provider.Type {
-			case OpenAI:
-				config.Providers[name] = Provider{
-					Type:    OpenAI,
-					APIKey:  provider.APIKey,
-					BaseURL: provider.BaseURL,
-				}
-			case Ollama:
-				config.Providers[name] = Provider{
-					Type:    Ollama,
-					APIKey:  provider.APIKey,
-					BaseURL: provider.BaseURL,
-				}
-			default:
-				return Config{}, fmt.Errorf("unsupported provider type: %s", provider.Type)
-			}
-		}
-
-		return config, nil
-	}
+	config, _, err := Load(LoadOptions{ConfigPath: configPath})
+	return config, err
 }
 
-// SaveToFile saves the configuration to the specified file
+// SaveToFile saves the configuration to the specified file, using the
+// format implied by the file extension
 func (c *Config) SaveToFile(configFile string) error {
-	file, err := os.Create(configFile)
+	values, err := toMap(*c)
 	if err != nil {
-		return fmt.Errorf("failed to create config file: %v", err)
-	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(c); err != nil {
-		return fmt.Errorf("failed to write config file: %v", err)
+		return err
 	}
 
-	return nil
+	return writeConfigMap(configFile, values)
 }
 
-// SwitchModel switches the model for the given provider
+// SwitchModel switches the default model and persists it to the global config file
 func (c *Config) SwitchModel(model string) error {
 	c.Defaults.Model = model
+	return c.setGlobalKey("defaults.model", model)
+}
 
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %v", err)
+// SetTheme switches the color theme and persists it to the global config file
+func (c *Config) SetTheme(theme string) error {
+	c.UI.Theme = theme
+	return c.setGlobalKey("ui.theme", theme)
+}
+
+// setGlobalKey sets a single key in the global config file. Only the key that
+// changed is touched so values from other layers (project files, environment)
+// are not baked into the global file.
+func (c *Config) setGlobalKey(key, value string) error {
+	configFile := c.GlobalFile
+	if configFile == "" {
+		var err error
+		if configFile, err = GlobalConfigPath(); err != nil {
+			return err
+		}
 	}
-	configFile := filepath.Join(homeDir, ".config", "tama", "config.json")
 
-	return c.SaveToFile(configFile)
+	return setFileKey(configFile, key, value)
 }
 
 // showConfig displays the contents of the config file
 func ShowConfig() {
-	homeDir, err := os.UserHomeDir()
+	configPath, err := GlobalConfigPath()
 	if err != nil {
-		fmt.Printf("Error: failed to get home directory: %v\n", err)
+		fmt.Printf("Error: %v\n", err)
 		return
 	}
 
-	configDir := filepath.Join(homeDir, ".config", "tama")
-	configPath := filepath.Join(configDir, "config.json")
-
 	// Check if file exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		fmt.Printf("Config file not found at %s\n", configPath)
@@ -192,6 +359,70 @@ func ShowConfig() {
 
 	fmt.Println("--- Tama Configuration File ---")
 	fmt.Printf("File: %s\n\n", configPath)
-	fmt.Println(string(content))
+	fmt.Println(redactConfigContent(string(content)))
 	fmt.Println("------------------------------")
 }
+
+// apiKeyPattern matches api_key assignments in JSON, YAML and TOML files
+var apiKeyPattern = regexp.MustCompile(`("?api_key"?\s*[:=]\s*["']?)([^"'\s,}]+)`)
+
+// redactConfigContent hides literal API keys in raw config file content
+func redactConfigContent(content string) string {
+	return apiKeyPattern.ReplaceAllStringFunc(content, func(match string) string {
+		parts := apiKeyPattern.FindStringSubmatch(match)
+		return parts[1] + RedactSecret(parts[2])
+	})
+}
+
+// ExplainConfig displays every effective configuration value and the layer it came from
+func ExplainConfig(cfg Config, sources Sources) {
+	values, err := toMap(cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	flat := make(map[string]interface{})
+	flattenMap(values, "", flat)
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Println("--- Effective Tama Configuration ---")
+	for _, key := range keys {
+		// Profile definitions are not effective values themselves
+		if strings.HasPrefix(key, "profiles.") {
+			continue
+		}
+
+		value := flat[key]
+		if strings.HasSuffix(key, ".api_key") {
+			value = RedactSecret(fmt.Sprint(value))
+		}
+
+		source, ok := sources[key]
+		if !ok {
+			source = Source{Layer: LayerDefault}
+		}
+		fmt.Printf("%-36s = %-30v  # %s\n", key, value, source)
+	}
+	fmt.Println("------------------------------------")
+}
+
+// flattenMap flattens nested maps into dotted keys
+func flattenMap(values map[string]interface{}, prefix string, dst map[string]interface{}) {
+	for key, value := range values {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenMap(nested, path, dst)
+			continue
+		}
+		dst[path] = value
+	}
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setFileKey sets a single string key in a config file. YAML and TOML files
+// are edited in place so comments, key order and formatting survive; JSON
+// has none of those and is rewritten from its decoded values.
+func setFileKey(path, key, value string) error {
+	format, err := FormatForPath(path)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		values := make(map[string]interface{})
+		setKey(values, key, value, Source{Layer: LayerGlobal}, make(Sources))
+		return writeConfigMap(path, values)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %v", err)
+	}
+
+	switch format {
+	case FormatYAML:
+		content, err = setYAMLKey(content, key, value)
+	case FormatTOML:
+		content, err = setTOMLKey(content, key, value)
+	default:
+		values, err := readConfigMap(path, true)
+		if err != nil {
+			return err
+		}
+		setKey(values, key, value, Source{Layer: LayerGlobal}, make(Sources))
+		return writeConfigMap(path, values)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update %s in %s: %v", key, path, err)
+	}
+
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+
+	return nil
+}
+
+// setYAMLKey sets a dotted key in a YAML document through its node tree,
+// creating missing mappings on the way
+func setYAMLKey(content []byte, key, value string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	node := doc.Content[0]
+	for _, part := range strings.Split(key, ".") {
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s is not a mapping", part)
+		}
+
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == part {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: part}, next)
+		}
+		node = next
+	}
+
+	// Keep the comments and quoting style of an existing scalar
+	if node.Kind != yaml.ScalarNode {
+		node.Kind = yaml.ScalarNode
+		node.Content = nil
+		node.Style = 0
+	}
+	node.Tag = "!!str"
+	node.Value = value
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	// tomlTable matches a table header, array tables are matched separately
+	tomlTable = regexp.MustCompile(`^\s*\[\s*([^\[\]]+?)\s*\]\s*(#.*)?$`)
+	// tomlArrayTable matches an array of tables header
+	tomlArrayTable = regexp.MustCompile(`^\s*\[\[`)
+	// tomlString matches a key set to a string, keeping its trailing comment
+	tomlString = regexp.MustCompile(`^(\s*([A-Za-z0-9_.\- ]+?)\s*=\s*)("(?:[^"\\]|\\.)*"|'[^']*')(\s*(#.*)?)$`)
+	// tomlKey matches the key of any key/value line
+	tomlKey = regexp.MustCompile(`^\s*([A-Za-z0-9_.\- ]+?)\s*=`)
+)
+
+// setTOMLKey sets a dotted key in a TOML document by editing the line that
+// holds it. The key is added to its table, or a new table, when missing. The
+// result is decoded again to make sure the edit did what was intended.
+func setTOMLKey(content []byte, key, value string) ([]byte, error) {
+	table, name := "", key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		table, name = key[:i], key[i+1:]
+	}
+	quoted := strconv.Quote(value)
+
+	lines := strings.Split(string(content), "\n")
+	current, header, done := "", -1, false
+	for i, line := range lines {
+		if tomlArrayTable.MatchString(line) {
+			current = "[["
+			continue
+		}
+		if m := tomlTable.FindStringSubmatch(line); m != nil {
+			current = normalizeTOMLKey(m[1])
+			if current == table && header < 0 {
+				header = i
+			}
+			continue
+		}
+
+		m := tomlKey.FindStringSubmatch(line)
+		if m == nil || joinTOMLKey(current, normalizeTOMLKey(m[1])) != key {
+			continue
+		}
+		s := tomlString.FindStringSubmatch(line)
+		if s == nil {
+			return nil, fmt.Errorf("%s is not a plain string", key)
+		}
+		lines[i] = s[1] + quoted + s[4]
+		done = true
+		break
+	}
+
+	if !done {
+		switch {
+		case table == "":
+			lines = append([]string{name + " = " + quoted}, lines...)
+		case header >= 0:
+			lines = append(lines[:header+1], append([]string{name + " = " + quoted}, lines[header+1:]...)...)
+		default:
+			for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+				lines = lines[:len(lines)-1]
+			}
+			lines = append(lines, "", "["+table+"]", name+" = "+quoted, "")
+		}
+	}
+
+	edited := []byte(strings.Join(lines, "\n"))
+	values, err := decodeConfigMap(edited, FormatTOML)
+	if err != nil {
+		return nil, err
+	}
+	if lookupKey(values, key) != value {
+		return nil, fmt.Errorf("%s is not defined in a form that can be edited in place", key)
+	}
+
+	return edited, nil
+}
+
+// normalizeTOMLKey removes the spaces TOML allows around the dots of a key
+func normalizeTOMLKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// joinTOMLKey prefixes a key with the table it was found in
+func joinTOMLKey(table, key string) string {
+	if table == "" {
+		return key
+	}
+	return table + "." + key
+}
+
+// lookupKey returns the value of a dotted key in a generic map
+func lookupKey(values map[string]interface{}, key string) interface{} {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := values[part].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		values = next
+	}
+	return values[parts[len(parts)-1]]
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetFileKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		key     string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "yaml keeps comments",
+			file:    "config.yaml",
+			content: "# my config\ndefaults:\n  model: gpt-4 # fast enough\n  provider: openai\n",
+			key:     "defaults.model",
+			value:   "gpt-4o",
+			want:    "# my config\ndefaults:\n  model: gpt-4o # fast enough\n  provider: openai\n",
+		},
+		{
+			name:    "yaml adds missing mapping",
+			file:    "config.yaml",
+			content: "version: 2 # schema\n",
+			key:     "ui.theme",
+			value:   "dark",
+			want:    "version: 2 # schema\nui:\n  theme: dark\n",
+		},
+		{
+			name:    "yaml quotes values that are not strings",
+			file:    "config.yaml",
+			content: "defaults:\n  model: old\n",
+			key:     "defaults.model",
+			value:   "true",
+			want:    "defaults:\n  model: \"true\"\n",
+		},
+		{
+			name:    "toml keeps comments",
+			file:    "config.toml",
+			content: "# my config\n[defaults]\nmodel = \"gpt-4\" # fast enough\nprovider = \"openai\"\n",
+			key:     "defaults.model",
+			value:   "gpt-4o",
+			want:    "# my config\n[defaults]\nmodel = \"gpt-4o\" # fast enough\nprovider = \"openai\"\n",
+		},
+		{
+			name:    "toml adds key to table",
+			file:    "config.toml",
+			content: "[ui]\n# colors\n",
+			key:     "ui.theme",
+			value:   "dark",
+			want:    "[ui]\ntheme = \"dark\"\n# colors\n",
+		},
+		{
+			name:    "toml adds table",
+			file:    "config.toml",
+			content: "version = 2\n\n",
+			key:     "ui.theme",
+			value:   "dark",
+			want:    "version = 2\n\n[ui]\ntheme = \"dark\"\n",
+		},
+		{
+			name:    "toml dotted key",
+			file:    "config.toml",
+			content: "ui.theme = \"light\"\n",
+			key:     "ui.theme",
+			value:   "dark",
+			want:    "ui.theme = \"dark\"\n",
+		},
+		{
+			name:    "toml inline table is refused",
+			file:    "config.toml",
+			content: "ui = { theme = \"light\" }\n",
+			key:     "ui.theme",
+			value:   "dark",
+			wantErr: true,
+		},
+		{
+			name:    "json",
+			file:    "config.json",
+			content: `{"version": 2, "ui": {"theme": "light"}}`,
+			key:     "ui.theme",
+			value:   "dark",
+			want:    "{\n  \"ui\": {\n    \"theme\": \"dark\"\n  },\n  \"version\": 2\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := setFileKey(path, tt.key, tt.value)
+			content, _ := os.ReadFile(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("setFileKey succeeded, want an error; file:\n%s", content)
+				}
+				if string(content) != tt.content {
+					t.Errorf("file changed despite the error:\n%s", content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setFileKey: %v", err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("file =\n%s\nwant\n%s", content, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format represents a configuration file format
+type Format string
+
+const (
+	// FormatJSON is the default JSON format
+	FormatJSON Format = "json"
+	// FormatYAML is the YAML format (.yaml or .yml)
+	FormatYAML Format = "yaml"
+	// FormatTOML is the TOML format
+	FormatTOML Format = "toml"
+)
+
+// configFileNames lists the accepted config file names in lookup order
+var configFileNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// FormatForPath returns the config format implied by the file extension
+func FormatForPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	default:
+		return "", fmt.Errorf("unsupported config file extension: %s", filepath.Ext(path))
+	}
+}
+
+// findConfigFile returns the first existing config file in dir, or an empty string
+func findConfigFile(dir string) string {
+	for _, name := range configFileNames {
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// decodeConfigMap decodes config file content into a generic map
+func decodeConfigMap(content []byte, format Format) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	switch format {
+	case FormatJSON:
+		if err := json.Unmarshal(content, &values); err != nil {
+			return nil, err
+		}
+	case FormatYAML:
+		if err := yaml.Unmarshal(content, &values); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		if err := toml.Unmarshal(content, &values); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", format)
+	}
+
+	return values, nil
+}
+
+// encodeConfigMap encodes a generic map in the given config format
+func encodeConfigMap(values map[string]interface{}, format Format) ([]byte, error) {
+	values = normalizeNumbers(values).(map[string]interface{})
+
+	switch format {
+	case FormatJSON:
+		content, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(content, '\n'), nil
+	case FormatYAML:
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(values); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatTOML:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(values); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", format)
+	}
+}
+
+// writeConfigMap writes a generic map to path in the format implied by its extension
+func writeConfigMap(path string, values map[string]interface{}) error {
+	format, err := FormatForPath(path)
+	if err != nil {
+		return err
+	}
+
+	content, err := encodeConfigMap(values, format)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %v", err)
+	}
+
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+
+	return nil
+}
+
+// normalizeNumbers turns whole float64 values (as produced by JSON decoding)
+// back into integers so YAML and TOML output stays readable
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = normalizeNumbers(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = normalizeNumbers(item)
+		}
+		return out
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return v
+	default:
+		return value
+	}
+}
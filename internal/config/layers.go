@@ -0,0 +1,480 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Layer identifies where a configuration value came from
+type Layer string
+
+const (
+	// LayerDefault is the built-in default configuration
+	LayerDefault Layer = "default"
+	// LayerGlobal is the user's global config file (~/.config/tama/config.json)
+	LayerGlobal Layer = "global"
+	// LayerProject is the project config file (.tama/config.json)
+	LayerProject Layer = "project"
+	// LayerProfile is the active named profile
+	LayerProfile Layer = "profile"
+	// LayerEnv is an environment variable
+	LayerEnv Layer = "env"
+	// LayerFlag is a command line flag
+	LayerFlag Layer = "flag"
+)
+
+// ProjectConfigDir is the directory holding project-level configuration
+const ProjectConfigDir = ".tama"
+
+// Source describes the origin of a single effective configuration value
+type Source struct {
+	Layer    Layer
+	Location string // File path, environment variable or flag name
+}
+
+// String returns a human readable description of the source
+func (s Source) String() string {
+	if s.Location == "" {
+		return string(s.Layer)
+	}
+	return fmt.Sprintf("%s (%s)", s.Layer, s.Location)
+}
+
+// Sources maps dotted configuration keys (e.g. "defaults.model") to their origin
+type Sources map[string]Source
+
+// Keys returns the configuration keys in sorted order
+func (s Sources) Keys() []string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FlagOverride is a command line flag that overrides a configuration key
+type FlagOverride struct {
+	Key   string // Dotted configuration key
+	Flag  string // Flag name without dashes
+	Value string
+}
+
+// LoadOptions controls how the configuration layers are resolved
+type LoadOptions struct {
+	ConfigPath    string         // Explicit global config file, overrides the default location
+	WorkspacePath string         // Directory where the project config search starts
+	Profile       string         // Explicit profile, overrides TAMA_PROFILE and the config files
+	Flags         []FlagOverride // Command line overrides, applied last
+}
+
+// envBinding maps an environment variable onto a configuration key
+type envBinding struct {
+	name  string
+	key   string
+	parse func(string) (interface{}, error)
+}
+
+// envBindings lists the environment variables consulted by Load, in order
+var envBindings = []envBinding{
+	{"TAMA_PROVIDER", "defaults.provider", parseString},
+	{"TAMA_MODEL", "defaults.model", parseString},
+	{"TAMA_TEMPERATURE", "defaults.temperature", parseFloat},
+	{"TAMA_MAX_TOKENS", "defaults.max_tokens", parseInt},
+	{"TAMA_THEME", "ui.theme", parseString},
+	{"OPENAI_API_KEY", "providers.openai.api_key", parseString},
+	{"OPENAI_BASE_URL", "providers.openai.base_url", parseString},
+	{"OLLAMA_HOST", "providers.ollama.base_url", parseOllamaHost},
+}
+
+// Load resolves the configuration from all layers: built-in defaults, the
+// global config file, the nearest project config file, the active profile,
+// environment variables and finally command line flags. Later layers
+// override earlier ones key by key.
+func Load(opts LoadOptions) (Config, Sources, error) {
+	merged := make(map[string]interface{})
+	sources := make(Sources)
+
+	// Built-in defaults
+	defaults, err := toMap(GetDefaultConfig())
+	if err != nil {
+		return Config{}, nil, err
+	}
+	mergeLayer(merged, defaults, "", Source{Layer: LayerDefault}, sources)
+
+	// Global config file
+	globalFile, err := globalConfigFile(opts.ConfigPath)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	if _, err := os.Stat(globalFile); os.IsNotExist(err) {
+		// First run, write the defaults so there is something to edit
+		config := GetDefaultConfig()
+		if err := config.SaveToFile(globalFile); err != nil {
+			return Config{}, nil, err
+		}
+	} else {
+		values, err := readConfigMap(globalFile, true)
+		if err != nil {
+			return Config{}, nil, err
+		}
+		mergeLayer(merged, values, "", Source{Layer: LayerGlobal, Location: globalFile}, sources)
+	}
+
+	// Project config file. Only some keys may be set by it, and its tool
+	// policies can only tighten the others, so they are set aside and
+	// applied last.
+	var projectTools map[string]interface{}
+	var projectProfileTools map[string]interface{}
+	var projectSource Source
+	var warnings []string
+	if projectFile := FindProjectConfig(opts.WorkspacePath); projectFile != "" && projectFile != globalFile {
+		values, err := readConfigMap(projectFile, false)
+		if err != nil {
+			return Config{}, nil, err
+		}
+		if dropped := restrictProject(values); len(dropped) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: ignoring %s; a project config may only set %s",
+				projectFile, strings.Join(dropped, ", "), projectKeysText))
+		}
+		projectSource = Source{Layer: LayerProject, Location: projectFile}
+		projectTools, projectProfileTools = splitTools(values)
+		mergeLayer(merged, values, "", projectSource, sources)
+	}
+
+	// Active profile
+	if name, source := selectProfile(merged, opts.Profile, sources); name != "" {
+		if err := applyProfile(merged, name, source, sources); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	// Environment variables
+	for _, binding := range envBindings {
+		raw, ok := os.LookupEnv(binding.name)
+		if !ok || raw == "" {
+			continue
+		}
+		value, err := binding.parse(raw)
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("invalid value for %s: %v", binding.name, err)
+		}
+		setKey(merged, binding.key, value, Source{Layer: LayerEnv, Location: binding.name}, sources)
+	}
+
+	// Command line flags
+	for _, flag := range opts.Flags {
+		setKey(merged, flag.Key, flag.Value, Source{Layer: LayerFlag, Location: "--" + flag.Flag}, sources)
+	}
+
+	config, err := fromMap(merged)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	config.GlobalFile = globalFile
+	config.Warnings = warnings
+
+	profileTools, _ := projectProfileTools[config.Profile].(map[string]interface{})
+	for _, values := range []map[string]interface{}{projectTools, profileTools} {
+		if values == nil {
+			continue
+		}
+		if err := tightenTools(&config, values, projectSource, sources); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	return config, sources, nil
+}
+
+// projectKeys are the top-level keys a project config may set. A checked
+// out repository is not trusted: it must not point providers at other hosts,
+// run secret commands or read files through api_key references, or turn off
+// redaction.
+var projectKeys = map[string]bool{
+	"version":  true,
+	"profile":  true,
+	"profiles": true,
+	"defaults": true,
+	"ui":       true,
+	"tools":    true,
+}
+
+// projectProfileKeys are the keys a profile in a project config may set
+var projectProfileKeys = map[string]bool{
+	"defaults": true,
+	"tools":    true,
+}
+
+// projectKeysText describes the keys a project config may set, for warnings
+const projectKeysText = "defaults, ui, profile, the defaults of profiles and tool policies that tighten the user's"
+
+// restrictProject removes the keys a project config may not set from its
+// values and returns them, sorted
+func restrictProject(values map[string]interface{}) []string {
+	var dropped []string
+	for key, value := range values {
+		if !projectKeys[key] {
+			delete(values, key)
+			dropped = append(dropped, key)
+			continue
+		}
+		if key != "profiles" {
+			continue
+		}
+		profiles, _ := value.(map[string]interface{})
+		for name, profile := range profiles {
+			profile, ok := profile.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for key := range profile {
+				if !projectProfileKeys[key] {
+					delete(profile, key)
+					dropped = append(dropped, "profiles."+name+"."+key)
+				}
+			}
+		}
+	}
+	sort.Strings(dropped)
+	return dropped
+}
+
+// splitTools removes the tool policies from the values of a project config,
+// both the top-level one and those of its profiles, and returns them. The
+// profile policies are keyed by profile name.
+func splitTools(values map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	tools, _ := values["tools"].(map[string]interface{})
+	delete(values, "tools")
+
+	profileTools := make(map[string]interface{})
+	profiles, _ := values["profiles"].(map[string]interface{})
+	for name, profile := range profiles {
+		if profile, ok := profile.(map[string]interface{}); ok {
+			if values, ok := profile["tools"].(map[string]interface{}); ok {
+				profileTools[name] = values
+				delete(profile, "tools")
+			}
+		}
+	}
+	return tools, profileTools
+}
+
+// tightenTools tightens the tool policy of config with one from a project
+// config and records the project as the source of the keys it changed
+func tightenTools(config *Config, values map[string]interface{}, source Source, sources Sources) error {
+	content, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to encode project tool policy: %v", err)
+	}
+	var project ToolPolicy
+	if err := json.Unmarshal(content, &project); err != nil {
+		return fmt.Errorf("failed to parse project tool policy: %v", err)
+	}
+	if err := project.Validate(); err != nil {
+		return fmt.Errorf("%s: %v", source.Location, err)
+	}
+
+	before := config.Tools
+	config.Tools = before.Tighten(project)
+	after := config.Tools
+	changed := map[string]bool{
+		"tools.allow":               !reflect.DeepEqual(before.Allow, after.Allow) || before.DenyAll != after.DenyAll,
+		"tools.deny":                len(before.Deny) != len(after.Deny),
+		"tools.rules":               len(before.ProjectRules) != len(after.ProjectRules),
+		"tools.terminal.timeout":    before.Terminal.Timeout != after.Terminal.Timeout,
+		"tools.terminal.max_output": before.Terminal.MaxOutput != after.Terminal.MaxOutput,
+		"tools.terminal.sandbox":    before.Terminal.Sandbox != after.Terminal.Sandbox,
+		"tools.terminal.no_network": before.Terminal.NoNetwork != after.Terminal.NoNetwork,
+	}
+	for key, ok := range changed {
+		if ok {
+			sources[key] = source
+		}
+	}
+	return nil
+}
+
+// FindProjectConfig walks up from dir looking for a .tama/config.{json,yaml,yml,toml}
+// file and returns its path, or an empty string if none is found
+func FindProjectConfig(dir string) string {
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return ""
+		}
+		dir = wd
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	for {
+		if candidate := findConfigFile(filepath.Join(dir, ProjectConfigDir)); candidate != "" {
+			return candidate
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// GlobalConfigPath returns the location of the global config file. An existing
+// config.json, config.yaml, config.yml or config.toml is preferred in that order,
+// otherwise config.json is used.
+func GlobalConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+
+	configDir := filepath.Join(homeDir, ".config", "tama")
+	if existing := findConfigFile(configDir); existing != "" {
+		return existing, nil
+	}
+	return filepath.Join(configDir, "config.json"), nil
+}
+
+// globalConfigFile returns the global config file to use, creating its directory if needed
+func globalConfigFile(configPath string) (string, error) {
+	if configPath != "" {
+		return configPath, nil
+	}
+
+	configFile, err := GlobalConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configFile), 0755); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %v", err)
+	}
+
+	return configFile, nil
+}
+
+// toMap converts a Config into a generic map using its JSON representation
+func toMap(config Config) (map[string]interface{}, error) {
+	content, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %v", err)
+	}
+
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %v", err)
+	}
+
+	return values, nil
+}
+
+// fromMap converts a generic map back into a validated Config
+func fromMap(values map[string]interface{}) (Config, error) {
+	content, err := json.Marshal(values)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to encode config: %v", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(content, &config); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config: %v", err)
+	}
+
+	// Ensure provider types are properly set
+	for name, provider := range config.Providers {
+		switch provider.Type {
+		case OpenAI, Ollama:
+		default:
+			return Config{}, fmt.Errorf("unsupported provider type for %s: %s", name, provider.Type)
+		}
+	}
+	if err := config.Redaction.Validate(); err != nil {
+		return Config{}, err
+	}
+	if err := config.Tools.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// mergeLayer deep-merges values into dst and records the source of every leaf
+func mergeLayer(dst, values map[string]interface{}, prefix string, source Source, sources Sources) {
+	for key, value := range values {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			existing, ok := dst[key].(map[string]interface{})
+			if !ok {
+				existing = make(map[string]interface{})
+				dst[key] = existing
+			}
+			mergeLayer(existing, nested, path, source, sources)
+			continue
+		}
+
+		dst[key] = value
+		sources[path] = source
+	}
+}
+
+// setKey sets a single dotted key in the merged map
+func setKey(dst map[string]interface{}, key string, value interface{}, source Source, sources Sources) {
+	parts := strings.Split(key, ".")
+	current := dst
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+	sources[key] = source
+
+	// A provider created from the environment needs a type to be usable
+	if len(parts) == 3 && parts[0] == "providers" {
+		if _, ok := current["type"]; !ok {
+			switch parts[1] {
+			case string(OpenAI), string(Ollama):
+				current["type"] = parts[1]
+				sources["providers."+parts[1]+".type"] = source
+			}
+		}
+	}
+}
+
+func parseString(raw string) (interface{}, error) {
+	return raw, nil
+}
+
+func parseFloat(raw string) (interface{}, error) {
+	return strconv.ParseFloat(raw, 64)
+}
+
+func parseInt(raw string) (interface{}, error) {
+	return strconv.Atoi(raw)
+}
+
+// parseOllamaHost accepts OLLAMA_HOST in the forms Ollama itself understands
+func parseOllamaHost(raw string) (interface{}, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	return strings.TrimSuffix(raw, "/"), nil
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/warm3snow/tama/internal/logging"
+)
+
+// CurrentVersion is the configuration schema version written by this build
+//
+// Version history:
+//
+//	0 - legacy layout with top-level "openai" and "ollama" sections
+//	1 - "providers" and "defaults" without a version field
+//	2 - adds the "version" field
+const CurrentVersion = 2
+
+// migration upgrades a raw config map from one schema version to the next
+type migration func(values map[string]interface{}) (map[string]interface{}, error)
+
+// migrations is indexed by the version a migration upgrades from
+var migrations = map[int]migration{
+	0: migrateLegacyLayout,
+	1: migrateAddVersion,
+}
+
+// detectVersion returns the schema version of a raw config map
+func detectVersion(values map[string]interface{}) (int, error) {
+	if raw, ok := values["version"]; ok {
+		switch v := raw.(type) {
+		case float64:
+			return int(v), nil
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		default:
+			return 0, fmt.Errorf("invalid config version: %v", raw)
+		}
+	}
+
+	// Files without a version are either the legacy layout or version 1
+	_, hasProviders := values["providers"]
+	_, hasOpenAI := values["openai"]
+	_, hasOllama := values["ollama"]
+	if !hasProviders && (hasOpenAI || hasOllama) {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// migrateConfigMap upgrades a raw config map to CurrentVersion. It reports
+// whether any migration was applied.
+func migrateConfigMap(values map[string]interface{}) (map[string]interface{}, bool, error) {
+	version, err := detectVersion(values)
+	if err != nil {
+		return nil, false, err
+	}
+	if version > CurrentVersion {
+		return nil, false, fmt.Errorf("config version %d is newer than supported version %d", version, CurrentVersion)
+	}
+
+	migrated := false
+	for version < CurrentVersion {
+		migrate, ok := migrations[version]
+		if !ok {
+			return nil, false, fmt.Errorf("no migration from config version %d", version)
+		}
+		if values, err = migrate(values); err != nil {
+			return nil, false, fmt.Errorf("failed to migrate config from version %d: %v", version, err)
+		}
+		version++
+		migrated = true
+	}
+
+	return values, migrated, nil
+}
+
+// migrateLegacyLayout converts the {"openai": {...}, "ollama": {...}} layout
+// into providers and defaults
+func migrateLegacyLayout(values map[string]interface{}) (map[string]interface{}, error) {
+	providers := make(map[string]interface{})
+	defaults := make(map[string]interface{})
+
+	if ollama, ok := values["ollama"].(map[string]interface{}); ok {
+		provider := map[string]interface{}{
+			"type":     string(Ollama),
+			"base_url": "http://localhost:11434",
+		}
+		if host, ok := ollama["host"].(string); ok && host != "" {
+			provider["base_url"] = host
+		}
+		if baseURL, ok := ollama["base_url"].(string); ok && baseURL != "" {
+			provider["base_url"] = baseURL
+		}
+		providers["ollama"] = provider
+
+		if model, ok := ollama["model"].(string); ok && model != "" {
+			defaults["provider"] = "ollama"
+			defaults["model"] = model
+		}
+	}
+
+	if openai, ok := values["openai"].(map[string]interface{}); ok {
+		provider := map[string]interface{}{
+			"type":     string(OpenAI),
+			"base_url": "https://api.openai.com/v1",
+		}
+		if apiKey, ok := openai["api_key"].(string); ok {
+			provider["api_key"] = apiKey
+		}
+		if baseURL, ok := openai["base_url"].(string); ok && baseURL != "" {
+			provider["base_url"] = baseURL
+		}
+		providers["openai"] = provider
+
+		// An OpenAI key in the legacy file meant OpenAI was the provider in use
+		if apiKey, _ := openai["api_key"].(string); apiKey != "" {
+			defaults["provider"] = "openai"
+			if model, ok := openai["model"].(string); ok && model != "" {
+				defaults["model"] = model
+			}
+		}
+	}
+
+	migrated := map[string]interface{}{
+		"providers": providers,
+	}
+	if len(defaults) > 0 {
+		migrated["defaults"] = defaults
+	}
+
+	// Keep any other top-level keys untouched
+	for key, value := range values {
+		switch key {
+		case "openai", "ollama":
+		default:
+			migrated[key] = value
+		}
+	}
+
+	return migrated, nil
+}
+
+// migrateAddVersion stamps the schema version into the config
+func migrateAddVersion(values map[string]interface{}) (map[string]interface{}, error) {
+	values["version"] = 2
+	return values, nil
+}
+
+// backupConfigFile copies a config file aside before it is rewritten
+func backupConfigFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	backupPath := fmt.Sprintf("%s.%s.bak", path, time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(backupPath, content, 0600); err != nil {
+		return "", fmt.Errorf("failed to write config backup: %v", err)
+	}
+
+	return backupPath, nil
+}
+
+// readConfigMap reads a config file into a generic map, migrating it to the
+// current schema version. When rewrite is set the migrated file is written
+// back after a backup; files tama does not own, such as project configs
+// that may be checked in, are only migrated in memory.
+func readConfigMap(path string, rewrite bool) (map[string]interface{}, error) {
+	format, err := FormatForPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %v", err)
+	}
+
+	values, err := decodeConfigMap(content, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	values, migrated, err := migrateConfigMap(values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if migrated && rewrite {
+		backupPath, err := backupConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeConfigMap(path, values); err != nil {
+			return nil, err
+		}
+		logging.Logger.Info("Migrated config file", "path", path, "backup", backupPath, "version", CurrentVersion)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// ProfileEnv is the environment variable selecting the active profile
+const ProfileEnv = "TAMA_PROFILE"
+
+// Profile is a named set of providers, defaults and tool policy that is
+// layered over the base configuration when active
+type Profile struct {
+	Providers map[string]Provider `json:"providers,omitempty"`
+	Defaults  *DefaultProvider    `json:"defaults,omitempty"`
+	Tools     *ToolPolicy         `json:"tools,omitempty"`
+}
+
+// ProfileNames returns the configured profile names in sorted order
+func (c Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectProfile determines the active profile name: the explicit option
+// (--profile or /profile) wins over TAMA_PROFILE, which wins over the
+// "profile" key in the config files
+func selectProfile(merged map[string]interface{}, explicit string, sources Sources) (string, Source) {
+	if explicit != "" {
+		return explicit, Source{Layer: LayerFlag, Location: "--profile"}
+	}
+	if name := os.Getenv(ProfileEnv); name != "" {
+		return name, Source{Layer: LayerEnv, Location: ProfileEnv}
+	}
+	if name, ok := merged["profile"].(string); ok && name != "" {
+		return name, sources["profile"]
+	}
+	return "", Source{}
+}
+
+// applyProfile overlays the named profile onto the merged configuration
+func applyProfile(merged map[string]interface{}, name string, source Source, sources Sources) error {
+	profiles, _ := merged["profiles"].(map[string]interface{})
+	profile, ok := profiles[name].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("profile %s is not defined", name)
+	}
+
+	merged["profile"] = name
+	sources["profile"] = source
+
+	for _, key := range []string{"providers", "defaults", "tools"} {
+		values, ok := profile[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		existing, ok := merged[key].(map[string]interface{})
+		if !ok {
+			existing = make(map[string]interface{})
+			merged[key] = existing
+		}
+		mergeLayer(existing, values, key, Source{Layer: LayerProfile, Location: name}, sources)
+	}
+
+	return nil
+}
+
+// ShowProfiles displays the configured profiles and marks the active one
+func ShowProfiles(cfg Config) {
+	names := cfg.ProfileNames()
+	if len(names) == 0 {
+		fmt.Println("No profiles configured.")
+		return
+	}
+
+	fmt.Println("--- Tama Profiles ---")
+	for _, name := range names {
+		marker := "  "
+		if name == cfg.Profile {
+			marker = "* "
+		}
+
+		profile := cfg.Profiles[name]
+		provider, model := "(inherited)", "(inherited)"
+		if profile.Defaults != nil {
+			if profile.Defaults.Provider != "" {
+				provider = profile.Defaults.Provider
+			}
+			if profile.Defaults.Model != "" {
+				model = profile.Defaults.Model
+			}
+		}
+		fmt.Printf("%s%-16s provider: %-12s model: %s\n", marker, name, provider, model)
+	}
+	fmt.Println("---------------------")
+
+	if cfg.Profile == "" {
+		fmt.Println("No profile is active.")
+	} else {
+		fmt.Printf("Active profile: %s\n", cfg.Profile)
+	}
+}
@@ -0,0 +1,358 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Secret reference prefixes accepted in api_key values
+const (
+	// SecretEnvPrefix reads the secret from an environment variable (env:OPENAI_API_KEY)
+	SecretEnvPrefix = "env:"
+	// SecretCmdPrefix runs a command and uses its output (cmd:pass show openai)
+	SecretCmdPrefix = "cmd:"
+	// SecretFilePrefix reads the secret from a file readable only by its owner (file:~/.openai)
+	SecretFilePrefix = "file:"
+	// SecretStorePrefix reads the secret from the encrypted secrets store (secret:openai)
+	SecretStorePrefix = "secret:"
+)
+
+// SecretsPassphraseEnv is the environment variable holding the secrets store passphrase
+const SecretsPassphraseEnv = "TAMA_SECRETS_PASSPHRASE"
+
+// PassphraseFunc obtains the secrets store passphrase. The default only reads
+// TAMA_SECRETS_PASSPHRASE; interactive commands replace it with a prompt.
+var PassphraseFunc = func(prompt string) ([]byte, error) {
+	if passphrase := os.Getenv(SecretsPassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	return nil, fmt.Errorf("secrets store is locked: set %s", SecretsPassphraseEnv)
+}
+
+// IsSecretReference reports whether value refers to a secret instead of containing it
+func IsSecretReference(value string) bool {
+	for _, prefix := range []string{SecretEnvPrefix, SecretCmdPrefix, SecretFilePrefix, SecretStorePrefix} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveSecret turns an api_key value into the actual secret. Plain values
+// are returned unchanged.
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretEnvPrefix):
+		name := strings.TrimPrefix(value, SecretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok || secret == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+
+	case strings.HasPrefix(value, SecretCmdPrefix):
+		return resolveCommandSecret(strings.TrimPrefix(value, SecretCmdPrefix))
+
+	case strings.HasPrefix(value, SecretFilePrefix):
+		return resolveFileSecret(strings.TrimPrefix(value, SecretFilePrefix))
+
+	case strings.HasPrefix(value, SecretStorePrefix):
+		name := strings.TrimPrefix(value, SecretStorePrefix)
+		store, err := OpenSecretStore()
+		if err != nil {
+			return "", err
+		}
+		secret, ok := store.Get(name)
+		if !ok {
+			return "", fmt.Errorf("secret %s not found in secrets store", name)
+		}
+		return secret, nil
+
+	default:
+		return value, nil
+	}
+}
+
+// ResolveAPIKey returns the provider's API key with any secret reference resolved
+func (p Provider) ResolveAPIKey() (string, error) {
+	key, err := ResolveSecret(p.APIKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve api_key: %v", err)
+	}
+	return key, nil
+}
+
+// resolveCommandSecret runs a command through the shell and returns its trimmed output
+func resolveCommandSecret(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", command)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("secret command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	secret := strings.TrimSpace(string(output))
+	if secret == "" {
+		return "", fmt.Errorf("secret command produced no output")
+	}
+	return secret, nil
+}
+
+// resolveFileSecret reads a secret from a file that must not be accessible by other users
+func resolveFileSecret(path string) (string, error) {
+	if strings.HasPrefix(path, "~") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %v", err)
+		}
+		path = filepath.Join(homeDir, path[1:])
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to access secret file: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("secret file %s has mode %o, it must not be accessible by group or others (chmod 600)", path, info.Mode().Perm())
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %v", err)
+	}
+
+	secret := strings.TrimSpace(string(content))
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return secret, nil
+}
+
+// RedactSecret returns a value that is safe to display. Secret references are
+// shown as-is since they do not contain the secret itself.
+func RedactSecret(value string) string {
+	if value == "" || IsSecretReference(value) {
+		return value
+	}
+	if len(value) <= 8 {
+		return "********"
+	}
+	return "********" + value[len(value)-4:]
+}
+
+// secretsFileName is the name of the encrypted secrets store in the config directory
+const secretsFileName = "secrets.enc"
+
+// scrypt parameters for deriving the store key from the passphrase
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// secretsFile is the on-disk format of the secrets store
+type secretsFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// SecretStore is a passphrase-encrypted store of named secrets
+type SecretStore struct {
+	path    string
+	key     []byte
+	salt    []byte
+	secrets map[string]string
+}
+
+// SecretStorePath returns the location of the encrypted secrets store
+func SecretStorePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".config", "tama", secretsFileName), nil
+}
+
+// OpenSecretStore opens the secrets store, asking for the passphrase through
+// PassphraseFunc. A missing store is treated as empty.
+func OpenSecretStore() (*SecretStore, error) {
+	path, err := SecretStorePath()
+	if err != nil {
+		return nil, err
+	}
+
+	store := &SecretStore{
+		path:    path,
+		secrets: make(map[string]string),
+	}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		passphrase, err := PassphraseFunc("New secrets store passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		store.salt = make([]byte, saltLen)
+		if _, err := rand.Read(store.salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %v", err)
+		}
+		if store.key, err = deriveKey(passphrase, store.salt); err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets store: %v", err)
+	}
+
+	var file secretsFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets store: %v", err)
+	}
+
+	passphrase, err := PassphraseFunc("Secrets store passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+
+	store.salt = file.Salt
+	if store.key, err = deriveKey(passphrase, file.Salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(store.key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets store: wrong passphrase or corrupted file")
+	}
+	if err := json.Unmarshal(plaintext, &store.secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted secrets: %v", err)
+	}
+
+	return store, nil
+}
+
+// Get returns the named secret
+func (s *SecretStore) Get(name string) (string, bool) {
+	secret, ok := s.secrets[name]
+	return secret, ok
+}
+
+// Set stores a secret under name
+func (s *SecretStore) Set(name, secret string) {
+	s.secrets[name] = secret
+}
+
+// Remove deletes the named secret, reporting whether it existed
+func (s *SecretStore) Remove(name string) bool {
+	if _, ok := s.secrets[name]; !ok {
+		return false
+	}
+	delete(s.secrets, name)
+	return true
+}
+
+// Names returns the names of all stored secrets in sorted order
+func (s *SecretStore) Names() []string {
+	names := make([]string, 0, len(s.secrets))
+	for name := range s.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save encrypts the store and writes it with owner-only permissions
+func (s *SecretStore) Save() error {
+	plaintext, err := json.Marshal(s.secrets)
+	if err != nil {
+		return fmt.Errorf("failed to encode secrets: %v", err)
+	}
+
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	content, err := json.MarshalIndent(secretsFile{
+		Version: 1,
+		Salt:    s.salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plaintext, nil),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode secrets store: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+
+	// Write next to the store and rename so a failed write never loses secrets
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets store: %v", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write secrets store: %v", err)
+	}
+
+	return nil
+}
+
+// deriveKey derives the store encryption key from the passphrase
+func deriveKey(passphrase, salt []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	return key, nil
+}
+
+// newGCM creates an AES-GCM cipher for the given key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	return gcm, nil
+}
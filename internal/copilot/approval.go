@@ -0,0 +1,72 @@
+package copilot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/warm3snow/tama/internal/tools"
+)
+
+// SetToolMode switches between normal, yolo and read-only tool permissions
+func (c *Copilot) SetToolMode(mode tools.Mode) {
+	c.policy.SetMode(mode)
+}
+
+// SetToolApprover replaces the prompt that asks the user about tool calls
+// needing approval
+func (c *Copilot) SetToolApprover(approver tools.Approver) {
+	c.policy.SetApprover(approver)
+}
+
+// DescribeToolCall formats a tool call for an approval prompt, showing the
+// exact command or operation and the arguments
+func DescribeToolCall(inv tools.Invocation) string {
+	var sb strings.Builder
+	label := "call"
+	if inv.Shell {
+		label = "command"
+	}
+	sb.WriteString(fmt.Sprintf("  tool:    %s\n", inv.Tool))
+	if inv.Subject != "" {
+		sb.WriteString(fmt.Sprintf("  %-8s %s\n", label+":", inv.Subject))
+	}
+	if len(inv.Args) > 0 {
+		args, err := json.MarshalIndent(inv.Args, "           ", "  ")
+		if err == nil {
+			sb.WriteString(fmt.Sprintf("  args:    %s\n", args))
+		}
+	}
+	return sb.String()
+}
+
+// approveToolCall asks on the terminal whether a tool call may run
+func (c *Copilot) approveToolCall(inv tools.Invocation) tools.Approval {
+	for {
+		c.cmdStyle.Print("\nThe agent wants to run a tool that needs your approval:\n")
+		fmt.Print(DescribeToolCall(inv))
+		c.cmdStyle.Print("Allow it? [y]es once, [a]lways this session, [n]o: ")
+
+		rl, err := readline.New("")
+		if err != nil {
+			return tools.Reject
+		}
+		input, err := rl.Readline()
+		rl.Close()
+		if err != nil {
+			return tools.Reject
+		}
+
+		switch input = strings.TrimSpace(input); {
+		case input == "y" || strings.EqualFold(input, "yes"):
+			return tools.ApproveOnce
+		case input == "a" || strings.EqualFold(input, "always"):
+			return tools.ApproveSession
+		case input == "n" || strings.EqualFold(input, "no"):
+			return tools.Reject
+		default:
+			c.cmdStyle.Println("Invalid input. Please try again.")
+		}
+	}
+}
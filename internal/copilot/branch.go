@@ -0,0 +1,193 @@
+package copilot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Undo drops the last exchange from the conversation and returns the prompt
+// that started it
+func (c *Copilot) Undo() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prompt, ok := c.llm.History().Undo()
+	if !ok {
+		return "", fmt.Errorf("nothing to undo")
+	}
+	return prompt, nil
+}
+
+// rewind drops the last exchange from the conversation, keeping it on a
+// branch of its own, and returns the prompt that started it
+func (c *Copilot) rewind() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prompt, saved, ok := c.llm.History().Rewind()
+	if !ok {
+		return "", fmt.Errorf("nothing to rewind")
+	}
+	if saved != "" {
+		c.cmdStyle.Printf("\nThe previous answer stays on branch %s\n", saved)
+	}
+	return prompt, nil
+}
+
+// handleUndoCommand drops the last exchange
+func (c *Copilot) handleUndoCommand() {
+	prompt, err := c.Undo()
+	if err != nil {
+		c.cmdStyle.Printf("\n%v\n", err)
+		return
+	}
+	c.cmdStyle.Printf("\nDropped the last exchange: %s\n", summarize(prompt, 60))
+}
+
+// handleRetryCommand regenerates the last answer, with the model given by
+// --model for this answer only
+func (c *Copilot) handleRetryCommand(args []string) {
+	model := ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--model" && i+1 < len(args):
+			model = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--model="):
+			model = strings.TrimPrefix(args[i], "--model=")
+		default:
+			c.cmdStyle.Printf("\nUsage: /retry [--model name]\n")
+			return
+		}
+	}
+
+	prompt, err := c.rewind()
+	if err != nil {
+		c.cmdStyle.Printf("\nNothing to retry.\n")
+		return
+	}
+
+	if model != "" {
+		previousModel := c.llm.GetModel()
+		c.llm.SetModel(model)
+		defer c.llm.SetModel(previousModel)
+	}
+	c.sendPrompt(prompt, prompt)
+}
+
+// handleEditLastCommand replaces the last message with text, or with the
+// result of editing it in $EDITOR, and resends it
+func (c *Copilot) handleEditLastCommand(text string) {
+	c.mu.RLock()
+	last, ok := c.llm.History().LastTurn()
+	c.mu.RUnlock()
+	if !ok {
+		c.cmdStyle.Printf("\nNo message to edit.\n")
+		return
+	}
+
+	message := text
+	if message == "" {
+		edited, err := c.editMessage(last)
+		if err != nil {
+			c.cmdStyle.Printf("Error: %v\n", err)
+			return
+		}
+		message = edited
+	}
+	if message == "" {
+		c.cmdStyle.Println("Empty message, nothing sent.")
+		return
+	}
+
+	if _, err := c.rewind(); err != nil {
+		c.cmdStyle.Printf("Error: %v\n", err)
+		return
+	}
+	c.sendPrompt(message, message)
+}
+
+// handleBranchCommand lists, switches or forks conversation branches
+func (c *Copilot) handleBranchCommand(args []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	history := c.llm.History()
+
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch args[0] {
+	case "list":
+		fmt.Println("\nBranches:")
+		for _, branch := range history.Branches() {
+			marker := "  "
+			if branch.Active {
+				marker = "* "
+			}
+			fmt.Printf("%s%-16s %d messages\n", marker, branch.Name, branch.Messages)
+		}
+
+	case "switch":
+		if len(args) != 2 {
+			c.cmdStyle.Printf("\nUsage: /branch switch <name>\n")
+			return
+		}
+		if err := history.Switch(args[1]); err != nil {
+			c.cmdStyle.Printf("\nFailed to switch branch: %v\n", err)
+			return
+		}
+		c.cmdStyle.Printf("\nSwitched to branch %s\n", args[1])
+
+	case "fork":
+		if len(args) < 2 || len(args) > 3 {
+			c.cmdStyle.Printf("\nUsage: /branch fork <message number> [name]\n")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			c.cmdStyle.Printf("\nInvalid message number: %s\n", args[1])
+			return
+		}
+		name := ""
+		if len(args) == 3 {
+			name = args[2]
+		}
+		name, err = history.Fork(n, name)
+		if err != nil {
+			c.cmdStyle.Printf("\nFailed to fork: %v\n", err)
+			return
+		}
+		c.cmdStyle.Printf("\nForked branch %s at message %d and switched to it\n", name, n)
+
+	default:
+		c.cmdStyle.Printf("\nUsage: /branch [list|switch <name>|fork <message number> [name]]\n")
+	}
+}
+
+// handleHistoryCommand prints the numbered messages of the active branch
+func (c *Copilot) handleHistoryCommand() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	history := c.llm.History()
+
+	messages := history.Messages()
+	if len(messages) == 0 {
+		fmt.Printf("\nBranch %s has no messages.\n", history.ActiveBranch())
+		return
+	}
+	fmt.Printf("\nBranch %s:\n", history.ActiveBranch())
+	for i, msg := range messages {
+		fmt.Printf("%3d  %-9s %s\n", i+1, msg.Role, summarize(msg.Content, 60))
+	}
+}
+
+// summarize returns the first line of s, shortened to at most max runes
+func summarize(s string, max int) string {
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(s), "\n", 2)[0])
+	if runes := []rune(line); len(runes) > max {
+		return string(runes[:max-3]) + "..."
+	}
+	return line
+}
@@ -0,0 +1,258 @@
+package copilot
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/warm3snow/tama/internal/backup"
+	"github.com/warm3snow/tama/internal/tools"
+	"github.com/warm3snow/tama/internal/workspace"
+)
+
+// maxSnapshotBytes caps the size of a file whose content is kept while a
+// command runs; changes to larger files are not rolled back
+const maxSnapshotBytes = 8 * 1024 * 1024
+
+// fileState is the content of a workspace file before a tool call
+type fileState struct {
+	exists  bool
+	content []byte
+	mode    os.FileMode
+}
+
+// toolSnapshot holds the state of the files a tool call may change, so the
+// changes it makes can be recorded in the current task
+type toolSnapshot struct {
+	tool  string
+	paths []string             // Files or directories the call names
+	files map[string]fileState // State before the call by workspace-relative path
+	git   bool                 // The call is a command; changed files are found with git status
+}
+
+// snapshotToolCall saves the state of the files a tool call may change. It
+// returns nil outside agent tasks and for read-only calls.
+func (c *Copilot) snapshotToolCall(toolCall *tools.ToolCall) *toolSnapshot {
+	if c.currentTask() == nil || toolCall.Describe().ReadOnly {
+		return nil
+	}
+
+	snapshot := &toolSnapshot{tool: toolCall.Name(), files: make(map[string]fileState)}
+	args := toolCall.Args()
+	switch toolCall.Name() {
+	case "filesystem":
+		for _, key := range []string{"path", "new_path"} {
+			if path, _ := args[key].(string); path != "" {
+				snapshot.paths = append(snapshot.paths, path)
+			}
+		}
+	case "patch":
+		diff, _ := args["patch"].(string)
+		patches, err := tools.ParseUnifiedDiff(diff)
+		if err != nil {
+			return nil // The call fails without changing anything
+		}
+		for _, p := range patches {
+			for _, path := range []string{p.OldPath, p.NewPath} {
+				if path != "" {
+					snapshot.paths = append(snapshot.paths, path)
+				}
+			}
+		}
+	default:
+		// Commands may change any file; git status tells which ones did
+		statuses, err := c.gitTool().Status(c.ctx)
+		if err != nil {
+			return nil
+		}
+		snapshot.git = true
+		for _, status := range statuses {
+			for _, path := range []string{status.Path, status.OrigPath} {
+				if path != "" {
+					snapshot.files[path] = c.readFileState(path)
+				}
+			}
+		}
+		return snapshot
+	}
+
+	for _, path := range snapshot.paths {
+		for rel, state := range c.walkFileStates(path) {
+			snapshot.files[rel] = state
+		}
+	}
+	return snapshot
+}
+
+// recordToolChanges compares the files of a snapshot with the workspace and
+// records every file the call created, changed or deleted in the current
+// task. The previous content of changed and deleted files is saved in the
+// backup store first.
+func (c *Copilot) recordToolChanges(snapshot *toolSnapshot) {
+	if snapshot == nil {
+		return
+	}
+
+	after := make(map[string]fileState)
+	staged := make(map[string]bool)
+	if snapshot.git {
+		statuses, err := c.gitTool().Status(c.ctx)
+		if err != nil {
+			return
+		}
+		for _, status := range statuses {
+			for _, path := range []string{status.Path, status.OrigPath} {
+				if path == "" {
+					continue
+				}
+				after[path] = c.readFileState(path)
+				staged[path] = status.Code[0] != ' ' && status.Code[0] != '?'
+				if _, ok := snapshot.files[path]; !ok {
+					// The file had no changes, so it had its committed content
+					snapshot.files[path] = c.headFileState(path)
+				}
+			}
+		}
+		// Files the command restored to their committed content
+		for path := range snapshot.files {
+			if _, ok := after[path]; !ok {
+				after[path] = c.readFileState(path)
+			}
+		}
+	} else {
+		for _, path := range snapshot.paths {
+			for rel, state := range c.walkFileStates(path) {
+				after[rel] = state
+			}
+		}
+		for path := range snapshot.files {
+			if _, ok := after[path]; !ok {
+				after[path] = fileState{}
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(after))
+	for path := range after {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	store := backup.Open(c.workspace.GetWorkspacePath())
+	taskID := c.currentTaskID()
+	for _, path := range paths {
+		before, now := snapshot.files[path], after[path]
+		if before.exists == now.exists && bytes.Equal(before.content, now.content) {
+			continue
+		}
+
+		change := Change{
+			FilePath:    path,
+			Description: fmt.Sprintf("changed by the %s tool", snapshot.tool),
+			Timestamp:   time.Now(),
+			Staged:      staged[path],
+		}
+		switch {
+		case !before.exists:
+			change.Operation = OpCreate
+		case !now.exists:
+			change.Operation = OpDelete
+		default:
+			change.Operation = OpModify
+		}
+		if before.exists {
+			entry, err := store.Save(path, before.content, before.mode, taskID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to back up %s: %v\n", path, err)
+				continue
+			}
+			change.Backup = entry.ID
+		}
+		c.trackChange(change)
+	}
+}
+
+// walkFileStates returns the state of a file, or of every file in a
+// directory, by workspace-relative path
+func (c *Copilot) walkFileStates(path string) map[string]fileState {
+	states := make(map[string]fileState)
+	resolver := workspace.NewResolver(c.workspace.GetWorkspacePath())
+	fullPath, err := resolver.Resolve(path)
+	if err != nil {
+		return states
+	}
+	info, err := os.Lstat(fullPath)
+	if err != nil || !info.IsDir() {
+		rel := filepath.ToSlash(resolver.Rel(fullPath))
+		states[rel] = c.readFileState(rel)
+		return states
+	}
+	filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			rel := filepath.ToSlash(resolver.Rel(p))
+			states[rel] = c.readFileState(rel)
+		}
+		return nil
+	})
+	return states
+}
+
+// readFileState reads the state of a workspace file. Missing files, files
+// that are not regular and files too large to keep count as not existing.
+func (c *Copilot) readFileState(path string) fileState {
+	fullPath := filepath.Join(c.workspace.GetWorkspacePath(), filepath.FromSlash(path))
+	info, err := os.Lstat(fullPath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxSnapshotBytes {
+		return fileState{}
+	}
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, content: content, mode: info.Mode()}
+}
+
+// headFileState returns the committed state of a file, which does not
+// exist if the file is not in HEAD
+func (c *Copilot) headFileState(path string) fileState {
+	content, err := c.gitTool().HeadContent(c.ctx, path)
+	if err != nil {
+		return fileState{}
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Lstat(filepath.Join(c.workspace.GetWorkspacePath(), filepath.FromSlash(path))); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return fileState{exists: true, content: content, mode: mode}
+}
+
+// currentTask returns the running agent task, or nil outside agent mode
+func (c *Copilot) currentTask() *TaskState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.agent == nil {
+		return nil
+	}
+	return c.agent.CurrentTask
+}
+
+// stagedPaths returns the paths of changes that were staged, so rolling
+// them back also resets their index entries
+func stagedPaths(changes []Change) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, change := range changes {
+		for _, path := range []string{change.FilePath, change.NewPath} {
+			if change.Staged && path != "" && !seen[path] {
+				seen[path] = true
+				paths = append(paths, strings.TrimSuffix(path, "/"))
+			}
+		}
+	}
+	return paths
+}
@@ -0,0 +1,120 @@
+package copilot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/warm3snow/tama/internal/commands"
+	"github.com/warm3snow/tama/internal/config"
+)
+
+// builtinCommands lists the built-in slash commands offered for completion
+var builtinCommands = []string{"reset", "profile", "theme", "export", "retry", "edit-last", "undo", "history", "branch", "edit", "exit"}
+
+// loadCustomCommands loads user-defined slash commands for the current workspace
+func (c *Copilot) loadCustomCommands() {
+	loaded, err := commands.Load(commands.Dirs(c.workspace.GetWorkspacePath()))
+	if err != nil {
+		c.cmdStyle.Printf("Warning: failed to load custom commands: %v\n", err)
+		return
+	}
+
+	// Built-in commands take precedence over custom ones with the same name
+	for _, name := range append([]string{"help"}, builtinCommands...) {
+		delete(loaded, name)
+	}
+
+	c.mu.Lock()
+	c.commands = loaded
+	c.mu.Unlock()
+}
+
+// completionCommands returns the built-in and custom command names for completion
+func (c *Copilot) completionCommands() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append(append([]string{}, builtinCommands...), commands.Names(c.commands)...)
+}
+
+// expandCustomCommand renders a user-defined slash command into a prompt.
+// It applies the command's model override and tool restriction and returns a
+// function that undoes them once the prompt has been processed. ok is false
+// when input does not name a custom command.
+func (c *Copilot) expandCustomCommand(input string) (prompt string, restore func(), ok bool, err error) {
+	name, args, _ := strings.Cut(strings.TrimPrefix(input, "/"), " ")
+
+	c.mu.RLock()
+	cmd, found := c.commands[name]
+	c.mu.RUnlock()
+	if !found {
+		return "", nil, false, nil
+	}
+
+	prompt, err = cmd.Render(commands.RenderContext{
+		Args:     strings.TrimSpace(args),
+		ReadFile: c.GetFileContext,
+		Git:      c.GetGitContext,
+	})
+	if err != nil {
+		return "", nil, true, err
+	}
+
+	previousModel := c.llm.GetModel()
+	if cmd.Model != "" {
+		c.llm.SetModel(cmd.Model)
+	}
+
+	restrictTools := len(cmd.AllowedTools) > 0
+	if restrictTools {
+		c.mu.Lock()
+		registerTools(c.tools, c.workspace, restrictPolicy(c.cfg.Tools, cmd.AllowedTools), c.policy, c.processes)
+		c.mu.Unlock()
+	}
+
+	restore = func() {
+		c.llm.SetModel(previousModel)
+		if restrictTools {
+			c.mu.Lock()
+			registerTools(c.tools, c.workspace, c.cfg.Tools, c.policy, c.processes)
+			c.mu.Unlock()
+		}
+	}
+
+	return prompt, restore, true, nil
+}
+
+// restrictPolicy narrows a tool policy to the given tools
+func restrictPolicy(policy config.ToolPolicy, allowed []string) config.ToolPolicy {
+	narrowed := policy
+	narrowed.Allow = nil
+	for _, tool := range allowed {
+		if policy.Allows(tool) {
+			narrowed.Allow = append(narrowed.Allow, tool)
+		}
+	}
+
+	// Nothing left to allow must not fall back to allowing everything
+	narrowed.DenyAll = len(narrowed.Allow) == 0
+	return narrowed
+}
+
+// showCustomCommands lists the user-defined commands in the help message
+func (c *Copilot) showCustomCommands() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.commands) == 0 {
+		return
+	}
+
+	fmt.Println("\nCustom commands:")
+	for _, name := range commands.Names(c.commands) {
+		cmd := c.commands[name]
+		description := cmd.Description
+		if description == "" {
+			description = fmt.Sprintf("Defined in %s", cmd.Path)
+		}
+		c.cmdStyle.Printf("  /%s", name)
+		fmt.Printf(" - %s\n", description)
+	}
+}
@@ -2,6 +2,8 @@ package copilot
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,25 +15,34 @@ import (
 
 	"github.com/chzyer/readline"
 	"github.com/fatih/color"
+	"github.com/warm3snow/tama/internal/commands"
 	"github.com/warm3snow/tama/internal/completion"
 	"github.com/warm3snow/tama/internal/config"
+	"github.com/warm3snow/tama/internal/ignore"
 	"github.com/warm3snow/tama/internal/llm"
+	"github.com/warm3snow/tama/internal/logging"
 	"github.com/warm3snow/tama/internal/machine"
+	"github.com/warm3snow/tama/internal/session"
 	"github.com/warm3snow/tama/internal/tools"
+	"github.com/warm3snow/tama/internal/ui"
 	"github.com/warm3snow/tama/internal/workspace"
 )
 
 // Change represents a single file change
 type Change struct {
-	FilePath    string
-	Description string
-	Timestamp   time.Time
-	Backup      string // Path to backup file
-	Status      string // Status of the change (e.g., "modified", "added", "deleted")
+	Operation   ChangeOperation `json:"operation"`
+	FilePath    string          `json:"path"`
+	NewPath     string          `json:"new_path,omitempty"` // Destination of a rename
+	Description string          `json:"description"`
+	Timestamp   time.Time       `json:"-"`
+	Backup      string          `json:"-"` // ID of the backup taken before the change
+	Staged      bool            `json:"-"` // The change was added to the git index
+	Status      string          `json:"-"` // Status of the change (e.g., "modified", "added", "deleted")
 }
 
 // TaskState represents the state of a task
 type TaskState struct {
+	ID          string // Identifies the task's backups
 	Description string
 	StartTime   time.Time
 	EndTime     time.Time
@@ -48,6 +59,12 @@ type AgentState struct {
 	LastActivity   time.Time
 }
 
+// Limits of the context GetFolderContext gathers
+const (
+	maxFolderFiles     = 200
+	maxFolderFileBytes = 32 * 1024
+)
+
 // DecisionPhase represents the current phase of decision making
 type DecisionPhase string
 
@@ -60,12 +77,13 @@ const (
 
 // Decision represents an LLM's decision about how to handle the prompt
 type Decision struct {
-	Phase     DecisionPhase
-	Action    string
-	Reasoning string
-	Context   []string // Required context files/directories
-	Tools     []string // Required tools
-	Changes   []Change // Proposed changes
+	Version   int              `json:"version"` // DecisionSchemaVersion
+	Phase     DecisionPhase    `json:"phase"`
+	Action    string           `json:"action"`
+	Reasoning string           `json:"reasoning"`
+	Context   []string         `json:"context"` // Required context files/directories
+	Tools     []ToolInvocation `json:"tools"`   // Tool calls for gathering context
+	Changes   []Change         `json:"changes"` // Proposed changes
 }
 
 // ConfirmationStatus represents the user's response to proposed changes
@@ -87,17 +105,24 @@ type ChangeConfirmation struct {
 
 // Copilot orchestrates the interaction between user, LLM, and tools
 type Copilot struct {
-	ctx       context.Context
-	cancel    context.CancelFunc
-	machine   *machine.Context
-	llm       *llm.Client
-	tools     *tools.Registry
-	workspace *workspace.Manager
-	userStyle *color.Color
-	aiStyle   *color.Color
-	cmdStyle  *color.Color
-	agent     *AgentState
-	mu        sync.RWMutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+	cfg        config.Config
+	loadConfig func(profile string) (config.Config, error)
+	machine    *machine.Context
+	llm        *llm.Client
+	tools      *tools.Registry
+	workspace  *workspace.Manager
+	userStyle  *color.Color
+	aiStyle    *color.Color
+	cmdStyle   *color.Color
+	agent      *AgentState
+	commands   map[string]*commands.Command // User-defined slash commands
+	markdown   bool                         // Render AI responses as Markdown
+	session    *session.Session             // Transcript of this session
+	policy     *tools.Policy                // Decides which tool calls run
+	processes  *tools.Processes             // Background commands of run_terminal
+	mu         sync.RWMutex
 }
 
 // New creates a new Copilot instance
@@ -112,56 +137,135 @@ func New(cfg config.Config) *Copilot {
 
 	// Create tool registry and register tools
 	tr := tools.NewRegistry()
-	tr.RegisterTool(tools.NewGrepSearchTool(ws.GetWorkspacePath()))
-	tr.RegisterTool(tools.NewRunTerminalTool(ws.GetWorkspacePath()))
-	tr.RegisterTool(tools.NewGitTool(ws.GetWorkspacePath()))
-	tr.RegisterTool(tools.NewFileSystemTool(ws.GetWorkspacePath()))
-	tr.RegisterTool(tools.NewLanguageDetector(ws.GetWorkspacePath()))
-	tr.RegisterTool(tools.NewLinterTool(ws.GetWorkspacePath()))
-
-	// Create style colors
-	userStyle := color.New(color.FgGreen).Add(color.Bold)
-	aiStyle := color.New(color.FgBlue)
-	cmdStyle := color.New(color.FgYellow).Add(color.Bold)
+	policy := tools.NewPolicy()
+	processes := tools.NewProcesses()
+	registerTools(tr, ws, cfg.Tools, policy, processes)
 
 	// Create copilot instance
+	client := llm.NewClient(cfg)
 	cop := &Copilot{
 		ctx:       ctx,
 		cancel:    cancel,
+		cfg:       cfg,
 		machine:   machineCtx,
-		llm:       llm.NewClient(cfg),
+		llm:       client,
 		tools:     tr,
 		workspace: ws,
-		userStyle: userStyle,
-		aiStyle:   aiStyle,
-		cmdStyle:  cmdStyle,
+		session:   session.New(client.GetProvider(), client.GetModel(), ws.GetWorkspacePath()),
+		policy:    policy,
+		processes: processes,
 	}
+	cop.applyTheme()
+	policy.SetApprover(cop.approveToolCall)
 
 	return cop
 }
 
+// registerTools registers the workspace tools permitted by the tool policy,
+// each checking its calls against guard. Background commands are tracked in
+// processes.
+func registerTools(tr *tools.Registry, ws *workspace.Manager, policy config.ToolPolicy, guard *tools.Policy, processes *tools.Processes) {
+	if err := guard.SetRules(policy.Rules, policy.ProjectRules); err != nil {
+		logging.LogError("Invalid tool rules", "error", err)
+	}
+
+	workspacePath := ws.GetWorkspacePath()
+	resolver := workspace.NewResolver(workspacePath, policy.ReadOnlyRoots...)
+	all := []tools.Tool{
+		tools.NewGrepSearchTool(resolver),
+		tools.NewRunTerminalTool(resolver, policy.Terminal, processes),
+		tools.NewGitTool(resolver),
+		tools.NewFileSystemTool(resolver, ws),
+		tools.NewPatchTool(resolver),
+		tools.NewLanguageDetector(resolver),
+		tools.NewLinterTool(resolver),
+	}
+
+	tr.Clear()
+	for _, tool := range all {
+		if policy.Allows(tool.Name()) {
+			tr.RegisterTool(guard.Guard(tool))
+		}
+	}
+}
+
+// SetConfigLoader sets the function used to reload the configuration
+// when switching profiles
+func (c *Copilot) SetConfigLoader(loader func(profile string) (config.Config, error)) {
+	c.loadConfig = loader
+}
+
+// SwitchProfile reloads the configuration with the named profile active
+func (c *Copilot) SwitchProfile(name string) error {
+	if c.loadConfig == nil {
+		return fmt.Errorf("profile switching is not available")
+	}
+
+	cfg, err := c.loadConfig(name)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cfg = cfg
+	c.llm.SetConfig(cfg)
+	registerTools(c.tools, c.workspace, cfg.Tools, c.policy, c.processes)
+	return nil
+}
+
+// applyTheme takes the message styles from the active theme
+func (c *Copilot) applyTheme() {
+	theme := ui.CurrentTheme()
+	c.userStyle = theme.User.Color()
+	c.aiStyle = theme.AI.Color()
+	c.cmdStyle = theme.Command.Color()
+}
+
+// prompt returns the readline prompt in the theme's user style
+func (c *Copilot) prompt() string {
+	return c.userStyle.Sprint(">") + " "
+}
+
+// SetMarkdown enables or disables Markdown rendering of AI responses
+func (c *Copilot) SetMarkdown(enabled bool) {
+	c.markdown = enabled
+}
+
 // StartInteractiveChat starts an interactive chat session
 func (c *Copilot) StartInteractiveChat() error {
 	// Show welcome message
 	c.showWelcomeMessage()
 
+	// Load user-defined slash commands
+	c.loadCustomCommands()
+
 	// Initialize readline
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt:          "\033[32m>\033[0m ",
-		HistoryFile:     "/tmp/tama_history.txt",
-		AutoComplete:    completion.NewReadlineCompleter([]string{"/help", "/reset", "/exit"}),
-		InterruptPrompt: "^C",
-		EOFPrompt:       "exit",
+		Prompt:      c.prompt(),
+		HistoryFile: "/tmp/tama_history.txt",
+		// Messages are saved whole once read, see below
+		DisableAutoSaveHistory: true,
+		AutoComplete:           completion.NewReadlineCompleter(c.completionCommands()),
+		InterruptPrompt:        "^C",
+		EOFPrompt:              "exit",
+		Stdin:                  readline.NewCancelableStdin(ui.NewPasteReader(readline.Stdin)),
 	})
 	if err != nil {
 		return fmt.Errorf("error initializing readline: %v", err)
 	}
 	defer rl.Close()
 
+	// Have the terminal mark pasted text so it is sent as one message
+	if readline.DefaultIsTerminal() {
+		defer ui.EnableBracketedPaste()()
+	}
+
 	// Main interaction loop
 	for {
-		// Get input using readline
-		input, err := rl.Readline()
+		// Get the next message, which may span several lines
+		input, err := c.readMessage(rl)
 		if err != nil {
 			if err == readline.ErrInterrupt {
 				if len(input) == 0 {
@@ -185,38 +289,87 @@ func (c *Copilot) StartInteractiveChat() error {
 			break
 		}
 
+		// Compose the message in an editor
+		if strings.Fields(input)[0] == "/edit" {
+			message, err := c.editMessage(strings.TrimSpace(strings.TrimPrefix(input, "/edit")))
+			if err != nil {
+				c.cmdStyle.Printf("Error: %v\n", err)
+				continue
+			}
+			if message == "" {
+				c.cmdStyle.Println("Empty message, nothing sent.")
+				continue
+			}
+			input = message
+		}
+
 		// Handle special commands
 		if c.handleSpecialCommands(input) {
+			rl.SetPrompt(c.prompt()) // The theme may have changed
 			continue
 		}
 
-		// Display user input
-		c.userStyle.Printf("\nYou: %s\n", input)
+		// Expand user-defined slash commands into prompts
+		prompt := input
+		restore := func() {}
+		if strings.HasPrefix(input, "/") {
+			expanded, undo, ok, err := c.expandCustomCommand(input)
+			if err != nil {
+				c.cmdStyle.Printf("Error: %v\n", err)
+				continue
+			}
+			if ok {
+				prompt, restore = expanded, undo
+			}
+		}
 
 		// Process the input
-		respChan, err := c.ProcessPrompt(input)
-		if err != nil {
-			c.cmdStyle.Printf("Error: %v\n", err)
+		sent := c.sendPrompt(input, prompt)
+		restore()
+		if !sent {
 			continue
 		}
 
-		// Print AI response
-		c.aiStyle.Print("\nAI: ")
-		for chunk := range respChan {
-			fmt.Print(chunk)
-		}
-		fmt.Print("\n\n")
-
-		// Add to readline history
-		rl.SaveHistory(input)
+		// Add to readline history, as one line so multi-line messages
+		// come back intact
+		rl.SaveHistory(ui.CollapseMarkers(input))
 	}
 
 	return nil
 }
 
+// sendPrompt displays input as the user's message, processes prompt and
+// prints the response. It reports whether the prompt was sent.
+func (c *Copilot) sendPrompt(input, prompt string) bool {
+	// Display user input
+	c.userStyle.Printf("\nYou: %s\n", input)
+
+	respChan, err := c.ProcessPrompt(prompt)
+	if err != nil {
+		c.cmdStyle.Printf("Error: %v\n", err)
+		return false
+	}
+
+	// Print AI response
+	c.aiStyle.Print("\nAI: ")
+	c.printResponse(respChan)
+	fmt.Print("\n\n")
+	return true
+}
+
+// printResponse prints a streamed response, rendering Markdown when enabled
+func (c *Copilot) printResponse(respChan <-chan string) {
+	out := ui.NewResponseWriter(os.Stdout, c.markdown)
+	for chunk := range respChan {
+		out.Write([]byte(chunk))
+	}
+	out.Flush()
+}
+
 // handleSpecialCommands handles special commands like /help and /reset
 func (c *Copilot) handleSpecialCommands(input string) bool {
-	switch input {
+	fields := strings.Fields(input)
+	switch fields[0] {
 	case "/help":
 		c.showHelpMessage()
 		return true
@@ -224,13 +377,99 @@ func (c *Copilot) handleSpecialCommands(input string) bool {
 		c.llm.ResetConversation()
 		c.cmdStyle.Printf("\nConversation has been reset.\n")
 		return true
+	case "/profile":
+		c.handleProfileCommand(fields[1:])
+		return true
+	case "/theme":
+		c.handleThemeCommand(fields[1:])
+		return true
+	case "/export":
+		c.handleExportCommand(fields[1:])
+		return true
+	case "/undo":
+		c.handleUndoCommand()
+		return true
+	case "/retry":
+		c.handleRetryCommand(fields[1:])
+		return true
+	case "/edit-last":
+		c.handleEditLastCommand(strings.TrimSpace(strings.TrimPrefix(input, "/edit-last")))
+		return true
+	case "/branch":
+		c.handleBranchCommand(fields[1:])
+		return true
+	case "/history":
+		c.handleHistoryCommand()
+		return true
 	}
 	return false
 }
 
+// handleProfileCommand lists profiles or switches to the named one
+func (c *Copilot) handleProfileCommand(args []string) {
+	if len(args) == 0 {
+		names := c.cfg.ProfileNames()
+		if len(names) == 0 {
+			fmt.Println("\nNo profiles configured.")
+			return
+		}
+		fmt.Println("\nProfiles:")
+		for _, name := range names {
+			marker := "  "
+			if name == c.cfg.Profile {
+				marker = "* "
+			}
+			fmt.Printf("%s%s\n", marker, name)
+		}
+		return
+	}
+
+	if err := c.SwitchProfile(args[0]); err != nil {
+		c.cmdStyle.Printf("\nFailed to switch profile: %v\n", err)
+		return
+	}
+	c.cmdStyle.Printf("\nSwitched to profile %s (%s model: %s)\n", args[0], c.llm.GetProvider(), c.llm.GetModel())
+}
+
+// handleThemeCommand lists themes or switches to the named one and saves it
+func (c *Copilot) handleThemeCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("\nThemes:")
+		for _, name := range ui.ThemeNames() {
+			theme, _ := ui.GetTheme(name)
+			marker := "  "
+			if theme == ui.CurrentTheme() {
+				marker = "* "
+			}
+			fmt.Printf("%s%-18s %s\n", marker, name, theme.Description)
+			ui.ShowThemePreview(theme)
+		}
+		return
+	}
+
+	if err := c.SetTheme(args[0]); err != nil {
+		c.cmdStyle.Printf("\nFailed to switch theme: %v\n", err)
+		return
+	}
+	c.cmdStyle.Printf("\nSwitched to theme %s\n", args[0])
+}
+
+// SetTheme switches the color theme and saves it to the global config file
+func (c *Copilot) SetTheme(name string) error {
+	if err := ui.SetTheme(name); err != nil {
+		return err
+	}
+	c.applyTheme()
+
+	if err := c.cfg.SetTheme(name); err != nil {
+		return fmt.Errorf("failed to save theme: %v", err)
+	}
+	return nil
+}
+
 // showWelcomeMessage displays the welcome message
 func (c *Copilot) showWelcomeMessage() {
-	modelInfo := color.New(color.FgCyan)
+	modelInfo := ui.CurrentTheme().Info.Color()
 	fmt.Println("Welcome to the Tama AI Assistant")
 	modelInfo.Printf("Connected to %s model: %s\n",
 		c.llm.GetProvider(),
@@ -246,12 +485,73 @@ func (c *Copilot) showHelpMessage() {
 	fmt.Println(" - Show this help message")
 	c.cmdStyle.Print("  /reset")
 	fmt.Println(" - Reset the conversation")
+	c.cmdStyle.Print("  /profile [name]")
+	fmt.Println(" - List profiles or switch to another one")
+	c.cmdStyle.Print("  /theme [name]")
+	fmt.Println(" - List color themes or switch to another one")
+	c.cmdStyle.Print("  /retry [--model name]")
+	fmt.Println(" - Regenerate the last answer, optionally with another model")
+	c.cmdStyle.Print("  /edit-last [text]")
+	fmt.Println(" - Rewrite the last message (in $EDITOR without text) and resend it")
+	c.cmdStyle.Print("  /undo")
+	fmt.Println(" - Drop the last exchange")
+	c.cmdStyle.Print("  /history")
+	fmt.Println(" - Show the numbered messages of the current branch")
+	c.cmdStyle.Print("  /branch [list|switch name|fork n [name]]")
+	fmt.Println(" - List branches, switch to one, or fork at message n")
+	c.cmdStyle.Print("  /export [path]")
+	fmt.Println(" - Export the conversation to Markdown, JSON or HTML (by extension)")
+	c.cmdStyle.Print("  /edit [text]")
+	fmt.Println(" - Compose the next message in $EDITOR")
+	c.cmdStyle.Print("  \"\"\"")
+	fmt.Println(" - Start or end a multi-line message (or use Alt+Enter for a newline)")
 	c.cmdStyle.Print("  exit")
 	fmt.Println(" or quit - End the session")
+	c.showCustomCommands()
 }
 
-// ProcessPrompt handles a user prompt and returns a streamed response
+// ProcessPrompt handles a user prompt and returns a streamed response. The
+// prompt and the response are recorded in the session transcript.
 func (c *Copilot) ProcessPrompt(prompt string) (<-chan string, error) {
+	c.mu.Lock()
+	c.llm.History().BeginTurn(prompt)
+	c.mu.Unlock()
+	respChan, err := c.processPrompt(prompt)
+	if err != nil {
+		c.endTurn()
+		return nil, err
+	}
+	c.record(session.Entry{Role: session.RoleUser, Content: prompt})
+
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		var response strings.Builder
+		for chunk := range respChan {
+			response.WriteString(chunk)
+			out <- chunk
+		}
+		c.endTurn()
+		c.record(session.Entry{
+			Role:    session.RoleAssistant,
+			Content: response.String(),
+			Model:   c.llm.GetModel(),
+		})
+		c.saveSession()
+	}()
+	return out, nil
+}
+
+// endTurn ends the conversation turn of a prompt once it is answered or
+// has failed
+func (c *Copilot) endTurn() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.llm.History().EndTurn()
+}
+
+// processPrompt runs the decision phases for a prompt
+func (c *Copilot) processPrompt(prompt string) (<-chan string, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -305,7 +605,7 @@ Current workspace: %s
 `, formatTools(toolDescs), wsContext["root"])
 
 	// Add system message to LLM
-	c.llm.AddSystemMessage(systemMsg)
+	c.addSystemMessage(systemMsg)
 
 	// Process in background
 	go func() {
@@ -360,7 +660,7 @@ Current workspace: %s
 			callback := func(chunk string) {
 				// Check if it's a tool call
 				if toolCall := c.tools.ParseToolCall(chunk); toolCall != nil {
-					result := toolCall.Execute(c.ctx)
+					result := c.executeToolCall(toolCall)
 					respChan <- fmt.Sprintf("\nTool result: %s\n", result)
 				} else {
 					// Stream regular response
@@ -398,6 +698,20 @@ Current workspace: %s
 	return respChan, nil
 }
 
+// Ask sends a single prompt straight to the model, without the agent phases
+// or tools, streaming the answer through callback if one is given
+func (c *Copilot) Ask(prompt string, callback func(string)) (*llm.Completion, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.llm.SendMessageWithResult(prompt, callback)
+}
+
+// GetProvider returns the name of the provider in use
+func (c *Copilot) GetProvider() string {
+	return c.llm.GetProvider()
+}
+
 // formatTools formats tool descriptions into a readable string
 func formatTools(tools []map[string]string) string {
 	var sb strings.Builder
@@ -410,6 +724,7 @@ func formatTools(tools []map[string]string) string {
 // Shutdown gracefully shuts down the copilot
 func (c *Copilot) Shutdown() {
 	c.cancel()
+	c.processes.StopAll()
 	c.llm.Close()
 	c.workspace.Cleanup()
 }
@@ -421,7 +736,7 @@ func (c *Copilot) GetContext() context.Context {
 
 // AddSystemMessage adds a system message to the conversation
 func (c *Copilot) AddSystemMessage(message string) {
-	c.llm.AddSystemMessage(message)
+	c.addSystemMessage(message)
 }
 
 // GetFileContext retrieves the content of a file
@@ -435,23 +750,75 @@ func (c *Copilot) GetFileContext(filePath string) (string, error) {
 	return "", fmt.Errorf("filesystem tool not available")
 }
 
+// GetFolderContext retrieves the files of a folder and their contents.
+// Protected files are left out.
+func (c *Copilot) GetFolderContext(folderPath string) (string, error) {
+	fsTool := c.tools.GetTool("filesystem")
+	if fsTool == nil {
+		return "", fmt.Errorf("filesystem tool not available")
+	}
+	result, err := fsTool.Execute(c.ctx, map[string]interface{}{
+		"operation": "list",
+		"path":      folderPath,
+		"recursive": true,
+		"limit":     maxFolderFiles,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var listing struct {
+		Entries   []tools.FileInfo `json:"entries"`
+		Truncated bool             `json:"truncated"`
+	}
+	if err := json.Unmarshal([]byte(result), &listing); err != nil {
+		return "", fmt.Errorf("failed to parse file list: %v", err)
+	}
+
+	var sb strings.Builder
+	for _, entry := range listing.Entries {
+		if entry.Type != "file" {
+			continue
+		}
+		content, err := fsTool.Execute(c.ctx, map[string]interface{}{
+			"operation": "read",
+			"path":      entry.Path,
+			"max_bytes": maxFolderFileBytes,
+		})
+		if err != nil {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("File: %s\n%s\n", entry.Path, content))
+	}
+	if listing.Truncated {
+		sb.WriteString(fmt.Sprintf("(only the first %d entries of %s are included)\n", maxFolderFiles, folderPath))
+	}
+	return sb.String(), nil
+}
+
 // GetCodebaseContext retrieves information about the codebase structure
 func (c *Copilot) GetCodebaseContext(depth int) (string, error) {
-	if grepTool := c.tools.GetTool("grep_search"); grepTool != nil {
-		return grepTool.Execute(c.ctx, map[string]interface{}{
-			"pattern": ".",
-			"depth":   depth,
+	if fsTool := c.tools.GetTool("filesystem"); fsTool != nil {
+		return fsTool.Execute(c.ctx, map[string]interface{}{
+			"operation": "list",
+			"path":      ".",
+			"recursive": true,
+			"max_depth": depth,
 		})
 	}
-	return "", fmt.Errorf("grep_search tool not available")
+	return "", fmt.Errorf("filesystem tool not available")
 }
 
 // GetGitContext retrieves git-related information
 func (c *Copilot) GetGitContext(command string) (string, error) {
 	if gitTool := c.tools.GetTool("git"); gitTool != nil {
-		return gitTool.Execute(c.ctx, map[string]interface{}{
-			"operation": command,
-		})
+		// Templates render without the user seeing the call, so they may
+		// only read the repository
+		args := map[string]interface{}{"operation": command}
+		if !tools.Describe(gitTool, args).ReadOnly {
+			return "", fmt.Errorf("git %s is not read-only; templates may only use read-only git operations", command)
+		}
+		return gitTool.Execute(c.ctx, args)
 	}
 	return "", fmt.Errorf("git tool not available")
 }
@@ -461,15 +828,10 @@ func (c *Copilot) SetProjectPath(path string) error {
 	if err := c.workspace.SetWorkspacePath(path); err != nil {
 		return err
 	}
+	c.session.Workspace = c.workspace.GetWorkspacePath()
 
 	// Update tool workspace paths
-	workspacePath := c.workspace.GetWorkspacePath()
-	c.tools.RegisterTool(tools.NewGrepSearchTool(workspacePath))
-	c.tools.RegisterTool(tools.NewRunTerminalTool(workspacePath))
-	c.tools.RegisterTool(tools.NewGitTool(workspacePath))
-	c.tools.RegisterTool(tools.NewFileSystemTool(workspacePath))
-	c.tools.RegisterTool(tools.NewLanguageDetector(workspacePath))
-	c.tools.RegisterTool(tools.NewLinterTool(workspacePath))
+	registerTools(c.tools, c.workspace, c.cfg.Tools, c.policy, c.processes)
 
 	// Detect languages in workspace
 	if langTool := c.tools.GetTool("language_detector"); langTool != nil {
@@ -497,8 +859,20 @@ func (c *Copilot) SetProjectPath(path string) error {
 	return nil
 }
 
-// StartAgentMode starts the AI agent mode with a specific goal
+// StartAgentMode starts the agent mode with a specific goal
 func (c *Copilot) StartAgentMode(goal string) error {
+	// Show welcome message
+	c.cmdStyle.Printf("\nStarting AI Agent mode with goal: %s\n\n", goal)
+
+	c.BeginAgent(goal)
+
+	// Start the agent loop
+	return c.runAgentLoop()
+}
+
+// BeginAgent initializes the agent state for goal and primes the LLM with
+// the agent system message
+func (c *Copilot) BeginAgent(goal string) {
 	c.mu.Lock()
 	c.agent = &AgentState{
 		Goal:           goal,
@@ -507,9 +881,7 @@ func (c *Copilot) StartAgentMode(goal string) error {
 		CompletedTasks: make([]TaskState, 0),
 	}
 	c.mu.Unlock()
-
-	// Show welcome message
-	c.cmdStyle.Printf("\nStarting AI Agent mode with goal: %s\n\n", goal)
+	c.session.SetGoal(goal)
 
 	// Create system message for agent mode
 	systemMsg := fmt.Sprintf(`You are a powerful AI coding assistant working on the following goal:
@@ -537,70 +909,224 @@ Current workspace: %s
 `, goal, formatTools(c.tools.GetToolDescriptions()), c.workspace.GetSummary()["root"])
 
 	// Add system message to LLM
-	c.llm.AddSystemMessage(systemMsg)
-
-	// Start the agent loop
-	return c.runAgentLoop()
+	c.addSystemMessage(systemMsg)
 }
 
-// runAgentLoop runs the main agent loop
-func (c *Copilot) runAgentLoop() error {
-	for {
-		// Get next action from LLM
-		respChan, err := c.ProcessPrompt("Continue working on the goal. What's your next step?")
-		if err != nil {
-			return fmt.Errorf("agent error: %v", err)
+// AgentAction is a user decision about the changes made by an agent step
+type AgentAction string
+
+const (
+	ActionAccept    AgentAction = "accept"     // Commit the current changes
+	ActionReject    AgentAction = "reject"     // Roll back the current changes
+	ActionRejectAll AgentAction = "reject_all" // Roll back the current changes and stop
+)
+
+// RunAgentStep asks the LLM for the next step towards the goal, streaming the
+// response through out. The step becomes the current task and the files it
+// changed are backed up.
+func (c *Copilot) RunAgentStep(out func(string)) error {
+	// Start the task first, so the backups the step makes and the changes
+	// it applies belong to it
+	c.mu.Lock()
+	if c.agent.CurrentTask != nil {
+		// Complete the previous task
+		c.agent.CurrentTask.EndTime = time.Now()
+		if c.agent.CurrentTask.Status == "in_progress" {
+			c.agent.CurrentTask.Status = "completed"
 		}
+		c.agent.CompletedTasks = append(c.agent.CompletedTasks, *c.agent.CurrentTask)
+	}
+	c.agent.CurrentTask = &TaskState{
+		ID:        time.Now().Format("20060102-150405.000"),
+		StartTime: time.Now(),
+		Status:    "in_progress",
+		Changes:   make([]Change, 0),
+	}
+	c.agent.LastActivity = time.Now()
+	c.mu.Unlock()
 
-		// Process response and extract task description
-		var response strings.Builder
-		taskDesc := ""
-		for chunk := range respChan {
-			response.WriteString(chunk)
-			// Extract task description from the first line
-			if taskDesc == "" && strings.HasPrefix(chunk, "Task:") {
-				taskDesc = strings.TrimSpace(strings.TrimPrefix(chunk, "Task:"))
-			}
-			// Also print the chunk to show real-time progress
-			fmt.Print(chunk)
+	// Back up the files already changed before the step
+	if err := c.backupChangedFiles(); err != nil {
+		out(fmt.Sprintf("\nWarning: Failed to create backup: %v\n", err))
+	}
+
+	// Get next action from LLM
+	respChan, err := c.ProcessPrompt("Continue working on the goal. What's your next step?")
+	if err != nil {
+		return fmt.Errorf("agent error: %v", err)
+	}
+
+	// Stream the response and extract the task description
+	var response strings.Builder
+	for chunk := range respChan {
+		response.WriteString(chunk)
+		out(chunk)
+	}
+	for _, line := range strings.Split(response.String(), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "Task:") {
+			c.mu.Lock()
+			c.agent.CurrentTask.Description = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "Task:"))
+			c.mu.Unlock()
+			break
 		}
+	}
 
-		// Update agent state with new task
-		c.mu.Lock()
-		if c.agent.CurrentTask != nil {
-			// Complete the previous task
-			c.agent.CurrentTask.EndTime = time.Now()
+	return nil
+}
+
+// gitTool creates a git tool for the workspace, which is used even when
+// the tool policy does not give git to the model
+func (c *Copilot) gitTool() *tools.GitTool {
+	resolver := workspace.NewResolver(c.workspace.GetWorkspacePath(), c.cfg.Tools.ReadOnlyRoots...)
+	return tools.NewGitTool(resolver)
+}
+
+// fileTool creates a filesystem tool for the workspace, which rolls back
+// changes even when the tool policy does not give it to the model
+func (c *Copilot) fileTool() *tools.FileSystemTool {
+	resolver := workspace.NewResolver(c.workspace.GetWorkspacePath(), c.cfg.Tools.ReadOnlyRoots...)
+	return tools.NewFileSystemTool(resolver, c.workspace)
+}
+
+// AgentDiff returns the uncommitted changes in the workspace
+func (c *Copilot) AgentDiff() (string, error) {
+	gitTool := c.gitTool()
+	return gitTool.Execute(c.ctx, map[string]interface{}{"operation": "diff"})
+}
+
+// ChangedFiles returns the git status lines of files with uncommitted changes
+func (c *Copilot) ChangedFiles() []string {
+	statuses, err := c.gitTool().Status(c.ctx)
+	if err != nil {
+		return nil
+	}
+
+	files := make([]string, len(statuses))
+	for i, status := range statuses {
+		files[i] = status.String()
+	}
+	return files
+}
+
+// ApplyAgentAction applies the user's decision about the current changes and
+// returns a message describing the outcome
+func (c *Copilot) ApplyAgentAction(action AgentAction) (string, error) {
+	gitTool := c.gitTool()
+
+	c.mu.Lock()
+	taskDesc := ""
+	var changes []Change
+	if c.agent != nil && c.agent.CurrentTask != nil {
+		taskDesc = c.agent.CurrentTask.Description
+		changes = append(changes, c.agent.CurrentTask.Changes...)
+		switch action {
+		case ActionAccept:
 			c.agent.CurrentTask.Status = "completed"
-			c.agent.CompletedTasks = append(c.agent.CompletedTasks, *c.agent.CurrentTask)
+		case ActionReject, ActionRejectAll:
+			c.agent.CurrentTask.Status = "rejected"
+		}
+	}
+	c.mu.Unlock()
+
+	switch action {
+	case ActionAccept:
+		// Record what is being applied before it is committed
+		diff, err := c.AgentDiff()
+		if err != nil {
+			diff = fmt.Sprintf("Failed to get diff: %v", err)
+		}
+		c.record(session.Entry{Role: session.RoleDiff, Content: diff})
+		c.saveSession()
+
+		if _, err := gitTool.Execute(c.ctx, map[string]interface{}{
+			"operation": "commit",
+			"message":   fmt.Sprintf("Auto commit: %s", taskDesc),
+		}); err != nil {
+			return "", fmt.Errorf("failed to commit changes: %v", err)
+		}
+		return "Changes committed successfully.", nil
+
+	case ActionReject, ActionRejectAll:
+		// Only the task's own changes are undone; other edits in the
+		// workspace are left alone
+		if err := c.restoreChanges(changes); err != nil {
+			return "", fmt.Errorf("failed to roll back changes: %v", err)
 		}
-		c.agent.CurrentTask = &TaskState{
-			Description: taskDesc,
-			StartTime:   time.Now(),
-			Status:      "in_progress",
-			Changes:     make([]Change, 0),
+		if action == ActionRejectAll {
+			return "Changes of the current task rolled back; the agent stopped.", nil
+		}
+		return "Changes rolled back successfully.", nil
+
+	default:
+		return "", fmt.Errorf("unknown agent action: %s", action)
+	}
+}
+
+// AgentStatus returns a snapshot of the agent state, or nil outside agent mode
+func (c *Copilot) AgentStatus() *AgentState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.agent == nil {
+		return nil
+	}
+	status := *c.agent
+	status.CompletedTasks = append([]TaskState(nil), c.agent.CompletedTasks...)
+	if c.agent.CurrentTask != nil {
+		task := *c.agent.CurrentTask
+		status.CurrentTask = &task
+	}
+	return &status
+}
+
+// TokenUsage returns the tokens used in this session
+func (c *Copilot) TokenUsage() llm.Usage {
+	return c.llm.TotalUsage()
+}
+
+// GetModel returns the name of the model in use
+func (c *Copilot) GetModel() string {
+	return c.llm.GetModel()
+}
+
+// runAgentLoop runs the main agent loop
+func (c *Copilot) runAgentLoop() error {
+	for {
+		// Get next action from LLM and print it to show real-time progress
+		out := ui.NewResponseWriter(os.Stdout, c.markdown)
+		err := c.RunAgentStep(func(chunk string) {
+			out.Write([]byte(chunk))
+		})
+		out.Flush()
+		if err != nil {
+			return err
 		}
-		c.agent.LastActivity = time.Now()
-		c.mu.Unlock()
 
 		// Show changes if any were made
-		gitTool := tools.NewGitTool(c.workspace.GetWorkspacePath())
-		diff, err := gitTool.Execute(c.ctx, map[string]interface{}{"operation": "diff"})
+		diff, err := c.AgentDiff()
 		if err != nil {
 			c.cmdStyle.Printf("\nError getting changes: %v\n", err)
 		} else if diff != "No changes detected" {
 			fmt.Print(diff) // Print the colored diff output with file status
 		}
 
-		// Create a backup of changed files
-		if err := c.backupChangedFiles(); err != nil {
-			c.cmdStyle.Printf("\nWarning: Failed to create backup: %v\n", err)
+		// Ask the user what to do with the changes
+		stop, err := c.promptAgentAction()
+		if err != nil || stop {
+			return err
 		}
+	}
+}
 
+// promptAgentAction shows the agent menu until the user accepts or rejects
+// the current changes. It reports whether the agent should stop.
+func (c *Copilot) promptAgentAction() (bool, error) {
+	for {
 		// Ask user for action
 		c.cmdStyle.Print("\nWhat would you like to do?\n")
 		c.cmdStyle.Println("  [a]ccept     - Accept and commit the current changes")
 		c.cmdStyle.Println("  [r]eject     - Reject and rollback the current changes")
-		c.cmdStyle.Println("  [A]ll        - Reject all changes and exit")
+		c.cmdStyle.Println("  [A]ll        - Reject the current changes and exit")
 		c.cmdStyle.Println("  [d]iff       - Show detailed changes")
 		c.cmdStyle.Println("  [s]ummary    - Show task summary")
 		c.cmdStyle.Println("  [p]rogress   - Show overall progress")
@@ -609,184 +1135,114 @@ func (c *Copilot) runAgentLoop() error {
 
 		rl, err := readline.New("")
 		if err != nil {
-			return err
+			return true, err
 		}
 		input, err := rl.Readline()
+		rl.Close()
 		if err != nil {
-			return err
+			return true, err
 		}
 
-		switch strings.ToLower(strings.TrimSpace(input)) {
-		case "a", "accept":
-			// Add the change to history before committing
-			c.mu.Lock()
-			if c.agent.CurrentTask != nil {
-				c.agent.CurrentTask.Status = "completed"
-			}
-			c.mu.Unlock()
+		switch input = strings.TrimSpace(input); {
+		case input == "a" || strings.EqualFold(input, "accept"):
+			c.printAgentAction(ActionAccept)
+			return false, nil
 
-			// Commit changes
-			if _, err := gitTool.Execute(c.ctx, map[string]interface{}{
-				"operation": "commit",
-				"message":   fmt.Sprintf("Auto commit: %s", taskDesc),
-			}); err != nil {
-				c.cmdStyle.Printf("Failed to commit changes: %v\n", err)
-			} else {
-				c.cmdStyle.Println("Changes committed successfully.")
-			}
-			continue
+		case input == "r" || strings.EqualFold(input, "reject"):
+			c.printAgentAction(ActionReject)
+			return false, nil
 
-		case "r", "reject":
-			// Update task status
-			c.mu.Lock()
-			if c.agent.CurrentTask != nil {
-				c.agent.CurrentTask.Status = "rejected"
-			}
-			c.mu.Unlock()
+		case input == "A" || strings.EqualFold(input, "all"):
+			// Reject the current changes and exit
+			c.printAgentAction(ActionRejectAll)
+			return true, nil
 
-			// Reset current changes
-			if _, err := gitTool.Execute(c.ctx, map[string]interface{}{"operation": "reset"}); err != nil {
-				c.cmdStyle.Printf("Failed to reset changes: %v\n", err)
-			} else {
-				c.cmdStyle.Println("Changes reset successfully.")
-			}
-			continue
-
-		case "d", "diff":
+		case input == "d" || strings.EqualFold(input, "diff"):
 			// Show detailed diff
-			if diff, err := gitTool.Execute(c.ctx, map[string]interface{}{"operation": "diff"}); err == nil {
+			if diff, err := c.AgentDiff(); err == nil {
 				fmt.Print("\nDetailed changes:\n", diff)
 			}
-			continue
 
-		case "s", "summary":
+		case input == "s" || strings.EqualFold(input, "summary"):
 			c.showTaskSummary()
-			continue
 
-		case "p", "progress":
+		case input == "p" || strings.EqualFold(input, "progress"):
 			c.showProgress()
-			continue
 
-		case "A", "all":
-			// Update all incomplete tasks as rejected
-			c.mu.Lock()
-			if c.agent.CurrentTask != nil {
-				c.agent.CurrentTask.Status = "rejected"
-			}
-			c.mu.Unlock()
-
-			// Reset all changes and exit
-			if _, err := gitTool.Execute(c.ctx, map[string]interface{}{"operation": "reset"}); err != nil {
-				c.cmdStyle.Printf("Failed to reset changes: %v\n", err)
-			} else {
-				c.cmdStyle.Println("All changes reset successfully.")
-			}
-			return nil
-
-		case "q", "quit":
-			return nil
+		case input == "q" || strings.EqualFold(input, "quit"):
+			return true, nil
 
 		default:
 			c.cmdStyle.Println("Invalid input. Please try again.")
-			continue
 		}
 	}
 }
 
+// printAgentAction applies an agent action and prints its outcome
+func (c *Copilot) printAgentAction(action AgentAction) {
+	message, err := c.ApplyAgentAction(action)
+	if err != nil {
+		c.cmdStyle.Printf("%v\n", err)
+		return
+	}
+	c.cmdStyle.Println(message)
+}
+
 // backupChangedFiles creates backups of modified files
 func (c *Copilot) backupChangedFiles() error {
 	// Get list of modified files
-	gitTool := c.tools.GetTool("git")
-	if gitTool == nil {
-		return fmt.Errorf("git tool not available")
-	}
-
-	output, err := gitTool.Execute(c.ctx, map[string]interface{}{
-		"operation": "status",
-		"format":    "porcelain",
-	})
+	statuses, err := c.gitTool().Status(c.ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get modified files: %v", err)
 	}
 
-	fsTool := c.tools.GetTool("filesystem")
-	if fsTool == nil {
-		return fmt.Errorf("filesystem tool not available")
-	}
-
-	// Create backup directory
-	backupDir := filepath.Join(c.workspace.GetWorkspacePath(), ".tama", "backups",
-		time.Now().Format("20060102_150405"))
-
-	_, err = fsTool.Execute(c.ctx, map[string]interface{}{
-		"operation": "mkdir",
-		"path":      backupDir,
-		"recursive": true,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create backup directory: %v", err)
-	}
-
 	// Process each modified file
-	for _, line := range strings.Split(output, "\n") {
-		if len(line) < 3 {
+	resolver := workspace.NewResolver(c.workspace.GetWorkspacePath(), c.cfg.Tools.ReadOnlyRoots...)
+	for _, status := range statuses {
+		// Skip untracked, deleted and protected files
+		if status.Code == "??" || strings.Contains(status.Code, "D") ||
+			resolver.Protected(filepath.Join(resolver.Root(), status.Path)) != nil {
 			continue
 		}
-		status := line[:2]
-		file := strings.TrimSpace(line[3:])
 
-		// Skip untracked files
-		if status == "??" {
-			continue
-		}
-
-		srcPath := filepath.Join(c.workspace.GetWorkspacePath(), file)
-		dstPath := filepath.Join(backupDir, file)
-
-		// Create destination directory if needed
-		dstDir := filepath.Dir(dstPath)
-		_, err := fsTool.Execute(c.ctx, map[string]interface{}{
-			"operation": "mkdir",
-			"path":      dstDir,
-			"recursive": true,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to create backup subdirectory for %s: %v", file, err)
-		}
-
-		// Copy file
-		if err := c.copyFile(srcPath, dstPath); err != nil {
-			return fmt.Errorf("failed to backup %s: %v", file, err)
+		if _, err := c.backupFile(status.Path); err != nil {
+			return fmt.Errorf("failed to backup %s: %v", status.Path, err)
 		}
 	}
 
 	return nil
 }
 
-// copyFile copies a file from src to dst using FileSystemTool
-func (c *Copilot) copyFile(src, dst string) error {
-	if fsTool := c.tools.GetTool("filesystem"); fsTool != nil {
-		// Read source file
-		content, err := fsTool.Execute(c.ctx, map[string]interface{}{
-			"operation": "read",
-			"path":      src,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to read source file: %v", err)
-		}
+// backupFile stores the current content of a workspace file in the backup
+// store under the current task and returns the backup ID
+func (c *Copilot) backupFile(path string) (string, error) {
+	result, err := c.fileTool().Execute(c.ctx, map[string]interface{}{
+		"operation": "backup",
+		"path":      path,
+		"task_id":   c.currentTaskID(),
+	})
+	if err != nil {
+		return "", err
+	}
 
-		// Write to destination file
-		_, err = fsTool.Execute(c.ctx, map[string]interface{}{
-			"operation": "write",
-			"path":      dst,
-			"content":   content,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to write destination file: %v", err)
-		}
-		return nil
+	var entry struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(result), &entry); err != nil {
+		return "", fmt.Errorf("failed to parse backup result: %v", err)
+	}
+	return entry.ID, nil
+}
+
+// currentTaskID returns the ID of the running agent task, or the session ID
+// outside agent mode
+func (c *Copilot) currentTaskID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.agent != nil && c.agent.CurrentTask != nil {
+		return c.agent.CurrentTask.ID
 	}
-	return fmt.Errorf("filesystem tool not available")
+	return c.session.ID
 }
 
 // showTaskSummary displays a summary of the current task and changes
@@ -836,155 +1292,6 @@ func (c *Copilot) showProgress() {
 	}
 }
 
-// getInitialDecision analyzes the prompt and returns the initial decision
-func (c *Copilot) getInitialDecision(prompt string) (*Decision, error) {
-	// Create analysis prompt
-	analysisPrompt := fmt.Sprintf(`You are an AI assistant analyzing a user request to determine the next action.
-Please analyze the following request and determine the best approach:
-
-Request: %s
-
-You MUST respond in the following format EXACTLY, including all fields:
-
-Phase: [analysis/context/modification/verification]
-Action: [specific action to take]
-Reasoning: [why this approach]
-Context: [comma-separated list of files/directories needed]
-Tools: [comma-separated list of tools needed]
-Changes: [list of file changes in the format: filepath|description]
-
-If this is a follow-up request, treat it as a new analysis phase.
-Do not reference previous responses or assume any context from previous interactions.
-Always provide ALL fields in your response, even if some are empty (use empty string or N/A).
-`, prompt)
-
-	// Get LLM response
-	var response strings.Builder
-	callback := func(chunk string) {
-		response.WriteString(chunk)
-	}
-
-	// Send message with callback
-	_, err := c.llm.SendMessageWithCallback(analysisPrompt, callback)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get initial decision: %v", err)
-	}
-
-	// Parse response into Decision struct
-	decision := &Decision{
-		Phase:   PhaseAnalysis, // Default to analysis phase
-		Context: make([]string, 0),
-		Tools:   make([]string, 0),
-		Changes: make([]Change, 0),
-	}
-
-	// Split response into lines
-	lines := strings.Split(response.String(), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
-
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-
-		switch key {
-		case "Phase":
-			if phase := DecisionPhase(value); isValidPhase(phase) {
-				decision.Phase = phase
-			}
-		case "Action":
-			if value != "" && value != "N/A" {
-				decision.Action = value
-			}
-		case "Reasoning":
-			if value != "" && value != "N/A" {
-				decision.Reasoning = value
-			}
-		case "Context":
-			if value != "" && value != "N/A" {
-				decision.Context = splitAndTrim(value, ",")
-			}
-		case "Tools":
-			if value != "" && value != "N/A" {
-				decision.Tools = splitAndTrim(value, ",")
-			}
-		case "Changes":
-			if value != "" && value != "N/A" {
-				// Split multiple changes
-				changesList := strings.Split(value, "\n")
-				for _, change := range changesList {
-					if change == "" || change == "N/A" {
-						continue
-					}
-					// Split filepath and description
-					changeParts := strings.Split(change, "|")
-					if len(changeParts) == 2 {
-						decision.Changes = append(decision.Changes, Change{
-							FilePath:    strings.TrimSpace(changeParts[0]),
-							Description: strings.TrimSpace(changeParts[1]),
-							Timestamp:   time.Now(),
-						})
-					}
-				}
-			}
-		}
-	}
-
-	// Validate decision
-	if err := validateDecision(decision); err != nil {
-		return nil, fmt.Errorf("invalid decision: %v", err)
-	}
-
-	return decision, nil
-}
-
-// isValidPhase checks if the given phase is valid
-func isValidPhase(phase DecisionPhase) bool {
-	switch phase {
-	case PhaseAnalysis, PhaseContext, PhaseModification, PhaseVerification:
-		return true
-	default:
-		return false
-	}
-}
-
-// splitAndTrim splits a string by delimiter and trims each part
-func splitAndTrim(s string, delimiter string) []string {
-	if s == "" {
-		return []string{}
-	}
-	parts := strings.Split(s, delimiter)
-	result := make([]string, 0, len(parts))
-	for _, part := range parts {
-		trimmed := strings.TrimSpace(part)
-		if trimmed != "" && trimmed != "N/A" {
-			result = append(result, trimmed)
-		}
-	}
-	return result
-}
-
-// validateDecision ensures the decision has all required fields
-func validateDecision(d *Decision) error {
-	if d.Phase == "" {
-		return fmt.Errorf("phase is required")
-	}
-	if d.Action == "" {
-		return fmt.Errorf("action is required")
-	}
-	if d.Reasoning == "" {
-		return fmt.Errorf("reasoning is required")
-	}
-	return nil
-}
-
 // handleAnalysisPhase processes the analysis phase
 func (c *Copilot) handleAnalysisPhase(decision *Decision, respChan chan<- string) error {
 	respChan <- fmt.Sprintf("Analysis:\n%s\n\nProposed action:\n%s\n",
@@ -997,7 +1304,10 @@ func (c *Copilot) handleAnalysisPhase(decision *Decision, respChan chan<- string
 				"operation": "read",
 				"path":      contextPath,
 			})
-			if err == nil {
+			var protected *ignore.ProtectedError
+			if errors.As(err, &protected) {
+				respChan <- fmt.Sprintf("\nSkipped context from %s: %v\n", contextPath, err)
+			} else if err == nil {
 				respChan <- fmt.Sprintf("\nRelevant context from %s:\n%s\n", contextPath, content)
 			}
 		}
@@ -1009,19 +1319,15 @@ func (c *Copilot) handleAnalysisPhase(decision *Decision, respChan chan<- string
 func (c *Copilot) handleContextPhase(decision *Decision, respChan chan<- string) error {
 	respChan <- "Gathering context...\n"
 
-	// Use grep tool to search through the codebase
-	if grepTool := c.tools.GetTool("grep_search"); grepTool != nil {
-		for _, pattern := range decision.Tools {
-			result, err := grepTool.Execute(c.ctx, map[string]interface{}{
-				"pattern": pattern,
-			})
-			if err != nil {
-				respChan <- fmt.Sprintf("\nError searching for pattern %s: %v\n", pattern, err)
-				continue
-			}
-			if result != "" {
-				respChan <- fmt.Sprintf("\nFound matches for pattern %s:\n%s\n", pattern, result)
-			}
+	// Run the tool invocations of the plan
+	for _, inv := range decision.Tools {
+		toolCall := c.tools.NewToolCall(inv.Tool, inv.Args)
+		if toolCall == nil {
+			respChan <- fmt.Sprintf("\nTool %s is not available\n", inv.Tool)
+			continue
+		}
+		if result := c.executeToolCall(toolCall); result != "" {
+			respChan <- fmt.Sprintf("\nResult of %s:\n%s\n", inv.Tool, result)
 		}
 	}
 	return nil
@@ -1037,13 +1343,8 @@ func (c *Copilot) handleModificationPhase(decision *Decision, respChan chan<- st
 	// Create a rollback function
 	rollback := func() {
 		respChan <- "\nRolling back changes...\n"
-		if gitTool := c.tools.GetTool("git"); gitTool != nil {
-			if _, err := gitTool.Execute(c.ctx, map[string]interface{}{
-				"operation": "reset",
-				"hard":      true,
-			}); err != nil {
-				respChan <- fmt.Sprintf("Warning: Failed to reset git changes: %v\n", err)
-			}
+		if err := c.restoreChanges(appliedChanges); err != nil {
+			respChan <- fmt.Sprintf("Warning: Failed to roll back changes: %v\n", err)
 		}
 	}
 
@@ -1054,66 +1355,41 @@ func (c *Copilot) handleModificationPhase(decision *Decision, respChan chan<- st
 	}
 
 	for _, change := range decision.Changes {
-		respChan <- fmt.Sprintf("\nProcessing change for %s:\n%s\n", change.FilePath, change.Description)
-
-		// Create backup
-		_, err := fsTool.Execute(c.ctx, map[string]interface{}{
-			"operation": "backup",
-			"path":      change.FilePath,
-		})
-		if err != nil {
-			respChan <- fmt.Sprintf("Warning: Failed to create backup: %v\n", err)
-			rollback()
-			return fmt.Errorf("backup creation failed: %v", err)
-		}
-
-		// Get current file content
-		content, err := fsTool.Execute(c.ctx, map[string]interface{}{
-			"operation": "read",
-			"path":      change.FilePath,
-		})
-		if err != nil {
-			respChan <- fmt.Sprintf("Error: Failed to read file: %v\n", err)
-			rollback()
-			return fmt.Errorf("file read failed: %v", err)
-		}
-
-		// Generate modified content
-		modificationPrompt := fmt.Sprintf(`Given the current file content and the proposed change, generate the complete modified content.
-Current content:
-%s
-
-Proposed change:
-%s
-
-Provide the complete modified content that can be written to the file. Ensure:
-1. All necessary imports are included
-2. The code follows best practices and conventions
-3. The changes are properly documented
-4. The code is properly formatted
-`, content, change.Description)
+		respChan <- fmt.Sprintf("\nProcessing %s of %s:\n%s\n", change.Operation, change.FilePath, change.Description)
 
-		var modifiedContent strings.Builder
-		callback := func(chunk string) {
-			modifiedContent.WriteString(chunk)
+		// Back up files that already exist, including ones a create
+		// would overwrite
+		if change.Operation != OpCreate || c.fileExists(change.FilePath) {
+			id, err := c.backupFile(change.FilePath)
+			if err != nil {
+				respChan <- fmt.Sprintf("Warning: Failed to create backup: %v\n", err)
+				rollback()
+				return fmt.Errorf("backup creation failed: %v", err)
+			}
+			change.Backup = id
 		}
 
-		if _, err := c.llm.SendMessageWithCallback(modificationPrompt, callback); err != nil {
-			respChan <- fmt.Sprintf("Error: Failed to generate modified content: %v\n", err)
-			rollback()
-			return fmt.Errorf("content generation failed: %v", err)
+		// Deletions and renames need no new content
+		if change.Operation == OpDelete || change.Operation == OpRename {
+			if err := c.applyFileOperation(change); err != nil {
+				respChan <- fmt.Sprintf("Error: %v\n", err)
+				rollback()
+				return err
+			}
+			respChan <- fmt.Sprintf("Successfully applied %s\n", change.Operation)
+			appliedChanges = append(appliedChanges, change)
+			c.trackChange(change)
+			continue
 		}
 
-		// Write modified content
-		_, err = fsTool.Execute(c.ctx, map[string]interface{}{
-			"operation": "write",
-			"path":      change.FilePath,
-			"content":   modifiedContent.String(),
-		})
-		if err != nil {
-			respChan <- fmt.Sprintf("Error: Failed to write file: %v\n", err)
+		// Edit the file with SEARCH/REPLACE blocks
+		instruction := "Make the following change:\n" + change.Description
+		if err := c.editFile(change.FilePath, instruction, change.Operation == OpCreate, respChan); err != nil {
+			respChan <- fmt.Sprintf("Error: %v\n", err)
+			// The failed edit may have written its file too
+			appliedChanges = append(appliedChanges, change)
 			rollback()
-			return fmt.Errorf("file write failed: %v", err)
+			return err
 		}
 		respChan <- "Successfully wrote changes to file\n"
 
@@ -1140,14 +1416,116 @@ Provide the complete modified content that can be written to the file. Ensure:
 			}); err != nil {
 				respChan <- fmt.Sprintf("Warning: Failed to stage changes: %v\n", err)
 			} else {
+				change.Staged = true
 				respChan <- "Added changes to git staging area\n"
 			}
 		}
 
 		// Track successful change
 		appliedChanges = append(appliedChanges, change)
+		c.trackChange(change)
+	}
+
+	return nil
+}
+
+// trackChange records a change applied by the current agent task, so
+// rejecting the task can roll it back
+func (c *Copilot) trackChange(change Change) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.agent != nil && c.agent.CurrentTask != nil {
+		c.agent.CurrentTask.Changes = append(c.agent.CurrentTask.Changes, change)
+	}
+}
+
+// restoreChanges rolls back applied changes from their backups, newest
+// first: created files are deleted, renamed files are moved back and
+// changed or deleted files get the content they had before. Staged changes
+// have their index entries reset to HEAD. Other edits in the workspace are
+// left alone.
+func (c *Copilot) restoreChanges(changes []Change) error {
+	fsTool := c.fileTool()
+	var failed []string
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+		var args map[string]interface{}
+		switch {
+		case change.Operation == OpCreate && change.Backup == "":
+			if !c.fileExists(change.FilePath) {
+				continue // The edit failed before writing the file
+			}
+			args = map[string]interface{}{
+				"operation": "delete",
+				"path":      change.FilePath,
+				"task_id":   c.currentTaskID(),
+			}
+		case change.Operation == OpRename:
+			args = map[string]interface{}{
+				"operation": "move",
+				"path":      change.NewPath,
+				"new_path":  change.FilePath,
+			}
+		case change.Backup != "":
+			args = map[string]interface{}{
+				"operation": "restore",
+				"path":      change.FilePath,
+				"backup_id": change.Backup,
+			}
+		default:
+			continue
+		}
+		if _, err := fsTool.Execute(c.ctx, args); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", change.FilePath, err))
+		}
+	}
+	if err := c.gitTool().Unstage(c.ctx, stagedPaths(changes)); err != nil {
+		failed = append(failed, fmt.Sprintf("index: %v", err))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to roll back %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// fileExists reports whether a workspace path exists
+func (c *Copilot) fileExists(path string) bool {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.workspace.GetWorkspacePath(), path)
 	}
+	_, err := os.Lstat(path)
+	return err == nil
+}
 
+// applyFileOperation deletes or renames a file in the workspace
+func (c *Copilot) applyFileOperation(change Change) error {
+	fsTool := c.tools.GetTool("filesystem")
+	if fsTool == nil {
+		return fmt.Errorf("filesystem tool not available")
+	}
+
+	var args map[string]interface{}
+	switch change.Operation {
+	case OpDelete:
+		// Deleted files are backed up first
+		args = map[string]interface{}{
+			"operation": "delete",
+			"path":      change.FilePath,
+			"task_id":   c.currentTaskID(),
+		}
+	case OpRename:
+		args = map[string]interface{}{
+			"operation": "move",
+			"path":      change.FilePath,
+			"new_path":  change.NewPath,
+		}
+	default:
+		return fmt.Errorf("unsupported file operation: %s", change.Operation)
+	}
+
+	if _, err := fsTool.Execute(c.ctx, args); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1192,41 +1570,13 @@ func (c *Copilot) HandleConfirmation(confirmation string, changes []Change) (*Ch
 				return nil, fmt.Errorf("failed to commit changes: %v", err)
 			}
 		}
-		// Remove backups
-		for _, change := range changes {
-			if change.Backup != "" {
-				os.Remove(change.Backup)
-			}
-		}
+		// Backups are kept until pruned with "tama backups prune"
 
 	case "no", "n":
 		conf.Status = StatusRejected
-		// Restore from backups
-		if fsTool := c.tools.GetTool("filesystem"); fsTool != nil {
-			for _, change := range changes {
-				if change.Backup != "" {
-					_, err := fsTool.Execute(c.ctx, map[string]interface{}{
-						"operation":   "restore",
-						"path":        change.FilePath,
-						"backup_path": change.Backup,
-					})
-					if err != nil {
-						return nil, fmt.Errorf("failed to restore %s: %v", change.FilePath, err)
-					}
-					// Remove backup after restore
-					os.Remove(change.Backup)
-				}
-			}
-		}
-		// Reset git changes if available
-		if gitTool := c.tools.GetTool("git"); gitTool != nil {
-			_, err := gitTool.Execute(c.ctx, map[string]interface{}{
-				"operation": "reset",
-				"hard":      true,
-			})
-			if err != nil {
-				return nil, fmt.Errorf("failed to reset changes: %v", err)
-			}
+		// Restore from backups, leaving other edits in the workspace alone
+		if err := c.restoreChanges(changes); err != nil {
+			return nil, err
 		}
 
 	default:
@@ -1286,13 +1636,17 @@ func (c *Copilot) AutoFixCode(ctx context.Context, respChan chan<- string) error
 			return fmt.Errorf("failed to scan files: %v", err)
 		}
 
+		var listing struct {
+			Entries []tools.FileInfo `json:"entries"`
+		}
+		if err := json.Unmarshal([]byte(result), &listing); err != nil {
+			return fmt.Errorf("failed to parse file list: %v", err)
+		}
+
 		// Filter source files
-		for _, line := range strings.Split(result, "\n") {
-			if line == "" {
-				continue
-			}
-			if isSourceFile(line) {
-				sourceFiles = append(sourceFiles, line)
+		for _, entry := range listing.Entries {
+			if entry.Type == "file" && isSourceFile(entry.Path) {
+				sourceFiles = append(sourceFiles, entry.Path)
 			}
 		}
 		respChan <- fmt.Sprintf("Found %d source files\n", len(sourceFiles))
@@ -1356,48 +1710,15 @@ func (c *Copilot) AutoFixCode(ctx context.Context, respChan chan<- string) error
 			respChan <- fmt.Sprintf("\nFixing %s...\n", file.Path)
 
 			// Create backup
-			_, err := fsTool.Execute(ctx, map[string]interface{}{
-				"operation": "backup",
-				"path":      file.Path,
-			})
-			if err != nil {
+			if _, err := c.backupFile(file.Path); err != nil {
 				respChan <- fmt.Sprintf("Warning: Failed to create backup: %v\n", err)
 				continue
 			}
 			respChan <- "Created backup successfully\n"
 
-			// Generate fix using LLM
-			fixPrompt := fmt.Sprintf(`Analyze the following code and its issues, then provide a fixed version:
-
-File: %s
-
-Current code:
-%s
-
-Issues found:
-%s
-
-Please provide the complete fixed code that resolves these issues:
-`, file.Path, file.Content, file.Issues)
-
-			var fixedContent strings.Builder
-			callback := func(chunk string) {
-				fixedContent.WriteString(chunk)
-			}
-
-			_, err = c.llm.SendMessageWithCallback(fixPrompt, callback)
-			if err != nil {
-				respChan <- fmt.Sprintf("Error generating fix: %v\n", err)
-				continue
-			}
-
-			// Apply the fix
-			_, err = fsTool.Execute(ctx, map[string]interface{}{
-				"operation": "write",
-				"path":      file.Path,
-				"content":   fixedContent.String(),
-			})
-			if err != nil {
+			// Generate and apply the fix using SEARCH/REPLACE blocks
+			instruction := "Fix the following issues found by the linter:\n" + file.Issues
+			if err := c.editFile(file.Path, instruction, false, respChan); err != nil {
 				respChan <- fmt.Sprintf("Error applying fix: %v\n", err)
 				continue
 			}
@@ -1420,12 +1741,19 @@ Please provide the complete fixed code that resolves these issues:
 			// Format Go files
 			if strings.HasSuffix(file.Path, ".go") {
 				if runTool := c.tools.GetTool("run_terminal"); runTool != nil {
-					_, err := runTool.Execute(ctx, map[string]interface{}{
-						"command": fmt.Sprintf("go fmt %s", file.Path),
+					output, err := runTool.Execute(ctx, map[string]interface{}{
+						"command": "go fmt " + tools.ShellQuote(file.Path),
 					})
-					if err != nil {
+					var result tools.CommandResult
+					if err == nil {
+						err = json.Unmarshal([]byte(output), &result)
+					}
+					switch {
+					case err != nil:
 						respChan <- fmt.Sprintf("Warning: Failed to format file: %v\n", err)
-					} else {
+					case result.ExitCode != 0:
+						respChan <- fmt.Sprintf("Warning: Failed to format file: %s\n", strings.TrimSpace(result.Stderr))
+					default:
 						respChan <- "Formatted Go code\n"
 					}
 				}
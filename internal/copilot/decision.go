@@ -0,0 +1,237 @@
+package copilot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DecisionSchemaVersion is the version of the decision JSON schema the model
+// is asked to follow
+const DecisionSchemaVersion = 1
+
+// ChangeOperation is the kind of a proposed file change
+type ChangeOperation string
+
+const (
+	OpCreate ChangeOperation = "create" // Create a new file
+	OpModify ChangeOperation = "modify" // Change an existing file
+	OpDelete ChangeOperation = "delete" // Delete a file
+	OpRename ChangeOperation = "rename" // Move a file to NewPath
+)
+
+// ToolInvocation is a tool call planned by a decision
+type ToolInvocation struct {
+	Tool string                 `json:"tool"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// decisionSchema describes the decision format in the prompt
+const decisionSchema = `{
+  "version": 1,
+  "phase": "analysis" | "context" | "modification" | "verification",
+  "action": "specific action to take",
+  "reasoning": "why this approach",
+  "context": ["relative/path/of/file/to/read", ...],
+  "tools": [{"tool": "<tool name>", "args": {"<name>": <value>, ...}}, ...],
+  "changes": [
+    {"operation": "create" | "modify" | "delete" | "rename",
+     "path": "relative/path",
+     "new_path": "destination path, only for rename",
+     "description": "what to change, required for create and modify"},
+    ...
+  ]
+}`
+
+// getInitialDecision asks the model how to handle the prompt. The plan is
+// validated before any phase runs; an invalid plan is sent back to the model
+// once for repair.
+func (c *Copilot) getInitialDecision(prompt string) (*Decision, error) {
+	analysisPrompt := fmt.Sprintf(`You are an AI assistant analyzing a user request to determine the next action.
+Please analyze the following request and determine the best approach:
+
+Request: %s
+
+Respond with a single JSON object and nothing else, following this schema:
+
+%s
+
+Use empty lists for context, tools or changes that are not needed.
+Only use these tools: %s.
+If this is a follow-up request, treat it as a new analysis phase.
+`, prompt, decisionSchema, strings.Join(c.toolNames(), ", "))
+
+	response, err := c.llm.SendMessage(analysisPrompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get initial decision: %v", err)
+	}
+
+	decision, problems := c.parseDecision(response)
+	if len(problems) == 0 {
+		return decision, nil
+	}
+
+	// Give the model one chance to fix its plan
+	repairPrompt := fmt.Sprintf(`Your previous response was not a valid decision:
+
+%s
+
+Problems:
+- %s
+
+Respond again with only the corrected JSON object, following this schema:
+
+%s
+`, response, strings.Join(problems, "\n- "), decisionSchema)
+
+	response, err = c.llm.SendMessage(repairPrompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to repair decision: %v", err)
+	}
+
+	decision, problems = c.parseDecision(response)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid decision: %s", strings.Join(problems, "; "))
+	}
+	return decision, nil
+}
+
+// parseDecision decodes and validates a decision, returning the problems found
+func (c *Copilot) parseDecision(response string) (*Decision, []string) {
+	data, ok := extractJSONObject(response)
+	if !ok {
+		return nil, []string{"no JSON object found"}
+	}
+
+	var decision Decision
+	if err := json.Unmarshal([]byte(data), &decision); err != nil {
+		return nil, []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+
+	problems := validateDecision(&decision, func(name string) bool {
+		return c.tools.GetTool(name) != nil
+	})
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	now := time.Now()
+	for i := range decision.Changes {
+		decision.Changes[i].Timestamp = now
+	}
+	return &decision, nil
+}
+
+// toolNames returns the names of the registered tools
+func (c *Copilot) toolNames() []string {
+	var names []string
+	for _, desc := range c.tools.GetToolDescriptions() {
+		names = append(names, desc["name"])
+	}
+	return names
+}
+
+// isValidPhase checks if the given phase is valid
+func isValidPhase(phase DecisionPhase) bool {
+	switch phase {
+	case PhaseAnalysis, PhaseContext, PhaseModification, PhaseVerification:
+		return true
+	default:
+		return false
+	}
+}
+
+// validateDecision checks a decision against the schema and returns every
+// problem found. knownTool reports whether a tool may be invoked.
+func validateDecision(d *Decision, knownTool func(string) bool) []string {
+	var problems []string
+
+	if d.Version != DecisionSchemaVersion {
+		problems = append(problems, fmt.Sprintf("version must be %d, got %d", DecisionSchemaVersion, d.Version))
+	}
+	if !isValidPhase(d.Phase) {
+		problems = append(problems, fmt.Sprintf("phase %q is not one of analysis, context, modification, verification", d.Phase))
+	}
+	if strings.TrimSpace(d.Action) == "" {
+		problems = append(problems, "action is required")
+	}
+	if strings.TrimSpace(d.Reasoning) == "" {
+		problems = append(problems, "reasoning is required")
+	}
+
+	for i, path := range d.Context {
+		if strings.TrimSpace(path) == "" {
+			problems = append(problems, fmt.Sprintf("context[%d] is empty", i))
+		}
+	}
+
+	for i, inv := range d.Tools {
+		switch {
+		case inv.Tool == "":
+			problems = append(problems, fmt.Sprintf("tools[%d].tool is required", i))
+		case !knownTool(inv.Tool):
+			problems = append(problems, fmt.Sprintf("tools[%d].tool %q is not an available tool", i, inv.Tool))
+		}
+	}
+
+	for i, change := range d.Changes {
+		if strings.TrimSpace(change.FilePath) == "" {
+			problems = append(problems, fmt.Sprintf("changes[%d].path is required", i))
+		}
+		switch change.Operation {
+		case OpCreate, OpModify:
+			if strings.TrimSpace(change.Description) == "" {
+				problems = append(problems, fmt.Sprintf("changes[%d].description is required for %s", i, change.Operation))
+			}
+		case OpRename:
+			if strings.TrimSpace(change.NewPath) == "" {
+				problems = append(problems, fmt.Sprintf("changes[%d].new_path is required for rename", i))
+			}
+		case OpDelete:
+		default:
+			problems = append(problems, fmt.Sprintf("changes[%d].operation %q is not one of create, modify, delete, rename", i, change.Operation))
+		}
+	}
+
+	return problems
+}
+
+// extractJSONObject returns the first complete JSON object in s, skipping
+// any prose or Markdown fences around it
+func extractJSONObject(s string) (string, bool) {
+	start := strings.Index(s, "{")
+	if start < 0 {
+		return "", false
+	}
+
+	depth := 0
+	inString, escaped := false, false
+	for i := start; i < len(s); i++ {
+		ch := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch ch {
+		case '"':
+			inString = true
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[start : i+1], true
+			}
+		}
+	}
+	return "", false
+}
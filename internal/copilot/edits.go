@@ -0,0 +1,152 @@
+package copilot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/warm3snow/tama/internal/edit"
+	"github.com/warm3snow/tama/internal/tools"
+)
+
+// maxEditAttempts is how many responses the model gets to produce edits that
+// apply cleanly
+const maxEditAttempts = 3
+
+// editFile asks the model for SEARCH/REPLACE blocks that carry out
+// instruction on path, applies them and writes the result. Blocks that do not
+// apply are reported back to the model for correction, and the result is
+// checked for truncated or fenced output before it is written.
+func (c *Copilot) editFile(path, instruction string, create bool, respChan chan<- string) error {
+	fsTool := c.tools.GetTool("filesystem")
+	if fsTool == nil {
+		return fmt.Errorf("filesystem tool not available")
+	}
+
+	original := ""
+	if !create {
+		content, err := fsTool.Execute(c.ctx, map[string]interface{}{
+			"operation": "read",
+			"path":      path,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		// The edits are made to the text the model sees, with secrets
+		// replaced by placeholders, and restored when the file is written
+		original = c.llm.Redact(content)
+	}
+
+	prompt := fmt.Sprintf(`%s
+
+File: %s
+
+Current content:
+%s
+
+%s
+A small unified diff of this file is accepted instead of the blocks.
+`, instruction, path, fileListing(original), edit.Format)
+
+	content := original
+	for attempt := 1; ; attempt++ {
+		response, err := c.llm.SendMessage(prompt)
+		if err != nil {
+			return fmt.Errorf("failed to generate edits: %v", err)
+		}
+
+		var problem string
+		blocks, err := edit.Parse(response)
+		if err != nil {
+			// Small unified diffs are accepted as well
+			updated, diffProblem, isDiff := applyDiffResponse(path, content, response)
+			if isDiff && diffProblem == "" {
+				content = updated
+				break
+			}
+			problem = err.Error()
+			if isDiff {
+				problem = diffProblem
+			}
+		} else {
+			matching, failures := edit.ForFile(blocks, path)
+			updated, applyFailures := edit.Apply(content, matching)
+			content = updated
+			failures = append(failures, applyFailures...)
+			if len(failures) == 0 {
+				break
+			}
+			problem = edit.DescribeFailures(failures)
+			respChan <- fmt.Sprintf("%d of %d edits did not apply\n", len(failures), len(blocks))
+		}
+
+		if attempt == maxEditAttempts {
+			return fmt.Errorf("edits for %s did not apply after %d attempts: %s", path, attempt, strings.TrimSpace(problem))
+		}
+		respChan <- "Asking the model to correct its edits...\n"
+		prompt = fmt.Sprintf(`Your edits to %s could not be applied:
+
+%s
+Current content of the file:
+%s
+
+Respond with corrected SEARCH/REPLACE blocks for the failed edits only.
+
+%s
+`, path, problem, fileListing(content), edit.Format)
+	}
+
+	if err := edit.Guard(path, original, content); err != nil {
+		return err
+	}
+
+	if _, err := fsTool.Execute(c.ctx, map[string]interface{}{
+		"operation": "write",
+		"path":      path,
+		"content":   c.llm.Restore(content),
+	}); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// applyDiffResponse applies a response written as a unified diff of the file
+// at path. isDiff is false if the response contains no diff; problem
+// describes failed hunks or a diff of another file.
+func applyDiffResponse(path, content, response string) (updated, problem string, isDiff bool) {
+	patches, err := tools.ParseUnifiedDiff(response)
+	if err != nil {
+		return "", "", false
+	}
+	if len(patches) != 1 {
+		return "", fmt.Sprintf("the diff changes %d files, expected only this one", len(patches)), true
+	}
+	patch := patches[0]
+	if patch.NewPath == "" {
+		return "", fmt.Sprintf("the diff deletes %s; change its content instead", patch.OldPath), true
+	}
+	for _, p := range []string{patch.OldPath, patch.NewPath} {
+		if p != "" && !edit.SamePath(p, path) {
+			return "", fmt.Sprintf("the diff changes %s, but only %s is being edited", p, path), true
+		}
+	}
+
+	updated, hunks := patch.Apply(content, 2)
+	var failures []string
+	for _, h := range hunks {
+		if h.Error != "" {
+			failures = append(failures, fmt.Sprintf("Hunk #%d failed: %s", h.Index, h.Error))
+		}
+	}
+	if len(failures) > 0 {
+		return "", strings.Join(failures, "\n"), true
+	}
+	return updated, "", true
+}
+
+// fileListing presents file content in a prompt
+func fileListing(content string) string {
+	if content == "" {
+		return "(the file does not exist yet)"
+	}
+	return content
+}
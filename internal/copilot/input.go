@@ -0,0 +1,103 @@
+package copilot
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/warm3snow/tama/internal/ui"
+)
+
+// multiLineDelimiter starts and ends an explicit multi-line message
+const multiLineDelimiter = `"""`
+
+// readMessage reads one message from the prompt. Pasted text and Alt+Enter
+// newlines arrive as a single line; a line starting with """ continues the
+// message until a line ending with """.
+func (c *Copilot) readMessage(rl *readline.Instance) (string, error) {
+	line, err := rl.Readline()
+	if err != nil {
+		return line, err
+	}
+	line = ui.ExpandMarkers(line)
+
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, multiLineDelimiter) {
+		return line, nil
+	}
+
+	// A single line wrapped in delimiters is complete
+	body := strings.TrimPrefix(trimmed, multiLineDelimiter)
+	if len(body) >= len(multiLineDelimiter) && strings.HasSuffix(body, multiLineDelimiter) {
+		return strings.TrimSuffix(body, multiLineDelimiter), nil
+	}
+
+	rl.SetPrompt(c.continuationPrompt())
+	defer rl.SetPrompt(c.prompt())
+
+	lines := []string{}
+	if body != "" {
+		lines = append(lines, body)
+	}
+	for {
+		line, err := rl.Readline()
+		if err != nil {
+			return "", err
+		}
+		line = ui.ExpandMarkers(line)
+
+		if strings.HasSuffix(strings.TrimRight(line, " \t"), multiLineDelimiter) {
+			last := strings.TrimSuffix(strings.TrimRight(line, " \t"), multiLineDelimiter)
+			if last != "" {
+				lines = append(lines, last)
+			}
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+// continuationPrompt returns the prompt for the lines of a multi-line message
+func (c *Copilot) continuationPrompt() string {
+	return c.userStyle.Sprint(".") + " "
+}
+
+// editMessage composes a message in $VISUAL or $EDITOR, starting from initial
+func (c *Copilot) editMessage(initial string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	file, err := os.CreateTemp("", "tama-message-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create message file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(initial); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write message file: %v", err)
+	}
+	file.Close()
+
+	// The editor command may include arguments, e.g. "code --wait"
+	cmd := exec.Command("/bin/sh", "-c", editor+` "$1"`, "sh", file.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %s failed: %v", editor, err)
+	}
+
+	content, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read message file: %v", err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
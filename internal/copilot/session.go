@@ -0,0 +1,110 @@
+package copilot
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/warm3snow/tama/internal/session"
+	"github.com/warm3snow/tama/internal/tools"
+)
+
+// record adds an entry to the session transcript
+func (c *Copilot) record(entry session.Entry) {
+	c.session.Add(entry)
+}
+
+// addSystemMessage adds a system message to the conversation and records it,
+// unless it repeats the last recorded system message
+func (c *Copilot) addSystemMessage(message string) {
+	c.llm.AddSystemMessage(message)
+	if c.session.LastContent(session.RoleSystem) != message {
+		c.record(session.Entry{Role: session.RoleSystem, Content: message})
+	}
+}
+
+// executeToolCall runs a tool call and records it with its result. Files
+// the call changes are recorded in the current task, so rejecting the task
+// rolls them back.
+func (c *Copilot) executeToolCall(toolCall *tools.ToolCall) string {
+	snapshot := c.snapshotToolCall(toolCall)
+	// The model only sees redacted text, so the placeholders in the content
+	// it writes are restored before the tool runs. The transcript keeps them.
+	result := toolCall.WithArgs(c.restoreArgs(toolCall.Name(), toolCall.Args())).Execute(c.ctx)
+	c.recordToolChanges(snapshot)
+	c.record(session.Entry{
+		Role:   session.RoleTool,
+		Tool:   toolCall.Name(),
+		Args:   toolCall.Args(),
+		Result: result,
+	})
+	return result
+}
+
+// saveSession saves the transcript once it holds at least one user message
+func (c *Copilot) saveSession() {
+	if c.session.Empty() {
+		return
+	}
+	if err := c.session.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save session: %v\n", err)
+	}
+}
+
+// SessionID returns the ID of the current session
+func (c *Copilot) SessionID() string {
+	return c.session.ID
+}
+
+// ExportSession writes the current session to path, choosing the format from
+// its extension. An empty path exports Markdown to tama-<session id>.md.
+func (c *Copilot) ExportSession(path string) (string, error) {
+	if path == "" {
+		path = fmt.Sprintf("tama-%s.%s", c.session.ID, session.FormatMarkdown)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer file.Close()
+
+	if err := session.Export(file, c.session, session.FormatFromPath(path)); err != nil {
+		return "", fmt.Errorf("failed to export session: %v", err)
+	}
+	return path, nil
+}
+
+// handleExportCommand exports the current session to the given path
+func (c *Copilot) handleExportCommand(args []string) {
+	path, err := c.ExportSession(strings.Join(args, " "))
+	if err != nil {
+		c.cmdStyle.Printf("\nFailed to export: %v\n", err)
+		return
+	}
+	c.cmdStyle.Printf("\nSession %s exported to %s\n", c.session.ID, path)
+}
+
+// restoredArgs names the arguments of each tool whose placeholders are
+// restored: only text tama writes into local files. Command lines, commit
+// messages and searches keep the placeholders, so a secret never leaves the
+// machine through them or shows up in an approval prompt.
+var restoredArgs = map[string][]string{
+	"filesystem": {"content", "old_text", "new_text"},
+	"patch":      {"patch"},
+}
+
+// restoreArgs returns a copy of a tool's arguments with the redaction
+// placeholders in its file content replaced by the values they stand for
+func (c *Copilot) restoreArgs(tool string, args map[string]interface{}) map[string]interface{} {
+	restored := make(map[string]interface{}, len(args))
+	for key, value := range args {
+		restored[key] = value
+	}
+	for _, key := range restoredArgs[tool] {
+		if text, ok := restored[key].(string); ok {
+			restored[key] = c.llm.Restore(text)
+		}
+	}
+	return restored
+}
@@ -0,0 +1,313 @@
+package edit
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Format describes the SEARCH/REPLACE edit format for prompts
+const Format = `Describe every change as one or more SEARCH/REPLACE blocks:
+
+path/to/file
+<<<<<<< SEARCH
+exact lines from the current file
+=======
+the lines that replace them
+>>>>>>> REPLACE
+
+Rules:
+- SEARCH must match the current file exactly, including comments and indentation,
+  and must be unique in the file; include a few surrounding lines if needed.
+- Keep blocks small: only the lines that change plus enough context to locate them.
+- To create a new file, use one block with an empty SEARCH section and the
+  complete file content in the REPLACE section.
+- To delete code, leave the REPLACE section empty.
+- Do not wrap the blocks in Markdown code fences and do not repeat unchanged code.`
+
+// Block is one SEARCH/REPLACE edit
+type Block struct {
+	Path    string // File the block applies to, if given
+	Search  string
+	Replace string
+}
+
+// Failure is a block that could not be applied
+type Failure struct {
+	Block  Block
+	Reason string
+}
+
+var (
+	searchMarker  = regexp.MustCompile(`^<{5,9} ?SEARCH\s*$`)
+	dividerMarker = regexp.MustCompile(`^={5,9}\s*$`)
+	replaceMarker = regexp.MustCompile(`^>{5,9} ?REPLACE\s*$`)
+)
+
+// Parse extracts the SEARCH/REPLACE blocks from a model response. Text
+// outside the blocks, including Markdown fences, is ignored.
+func Parse(response string) ([]Block, error) {
+	lines := strings.Split(strings.ReplaceAll(response, "\r\n", "\n"), "\n")
+
+	var blocks []Block
+	for i := 0; i < len(lines); i++ {
+		if !searchMarker.MatchString(lines[i]) {
+			continue
+		}
+
+		block := Block{Path: blockPath(lines[:i])}
+
+		divider := -1
+		for j := i + 1; j < len(lines); j++ {
+			if dividerMarker.MatchString(lines[j]) {
+				divider = j
+				break
+			}
+			if searchMarker.MatchString(lines[j]) {
+				break
+			}
+		}
+		if divider < 0 {
+			return nil, fmt.Errorf("SEARCH block %d has no ======= divider", len(blocks)+1)
+		}
+
+		end := -1
+		for j := divider + 1; j < len(lines); j++ {
+			if replaceMarker.MatchString(lines[j]) {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("SEARCH block %d has no >>>>>>> REPLACE marker", len(blocks)+1)
+		}
+
+		block.Search = strings.Join(lines[i+1:divider], "\n")
+		block.Replace = strings.Join(lines[divider+1:end], "\n")
+		blocks = append(blocks, block)
+		i = end
+	}
+
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no SEARCH/REPLACE blocks found")
+	}
+	return blocks, nil
+}
+
+// blockPath returns the file path on the last non-blank line before a block,
+// skipping an opening Markdown fence
+func blockPath(before []string) string {
+	for i := len(before) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(before[i])
+		if line == "" || strings.HasPrefix(line, "```") {
+			continue
+		}
+		if strings.ContainsAny(line, " \t") || replaceMarker.MatchString(line) {
+			return ""
+		}
+		return strings.Trim(line, "`*")
+	}
+	return ""
+}
+
+// Apply applies blocks to content in order. Blocks that fail are reported
+// and skipped; the others are still applied.
+func Apply(content string, blocks []Block) (string, []Failure) {
+	var failures []Failure
+	for _, block := range blocks {
+		updated, err := applyBlock(content, block)
+		if err != nil {
+			failures = append(failures, Failure{Block: block, Reason: err.Error()})
+			continue
+		}
+		content = updated
+	}
+	return content, failures
+}
+
+// ForFile returns the blocks for the file at path, including blocks that name
+// no file, and reports blocks naming another file as failures
+func ForFile(blocks []Block, path string) ([]Block, []Failure) {
+	var matching []Block
+	var failures []Failure
+	for _, block := range blocks {
+		if block.Path != "" && !SamePath(block.Path, path) {
+			failures = append(failures, Failure{
+				Block:  block,
+				Reason: fmt.Sprintf("the block is for %s, but only %s is being edited", block.Path, path),
+			})
+			continue
+		}
+		matching = append(matching, block)
+	}
+	return matching, failures
+}
+
+// SamePath reports whether a path written by the model names the same
+// workspace file as path
+func SamePath(given, want string) bool {
+	clean := func(p string) string {
+		return path.Clean(strings.TrimPrefix(filepath.ToSlash(p), "./"))
+	}
+	return clean(given) == clean(want)
+}
+
+// applyBlock applies one block, tolerating whitespace drift between the
+// SEARCH text and the file
+func applyBlock(content string, block Block) (string, error) {
+	if strings.TrimSpace(block.Search) == "" {
+		if strings.TrimSpace(content) != "" {
+			return "", fmt.Errorf("empty SEARCH is only allowed for new or empty files")
+		}
+		return ensureNewline(block.Replace), nil
+	}
+
+	lines := strings.Split(content, "\n")
+	search := trimBlankLines(strings.Split(block.Search, "\n"))
+	replace := strings.Split(block.Replace, "\n")
+	if strings.TrimSpace(block.Replace) == "" {
+		replace = nil
+	}
+
+	matchers := []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+		func(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) },
+	}
+
+	for level, match := range matchers {
+		matches := findMatches(lines, search, match)
+		if len(matches) > 1 {
+			return "", fmt.Errorf("SEARCH text matches %d places in the file; include more surrounding lines", len(matches))
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		start := matches[0]
+		if level == len(matchers)-1 {
+			replace = reindent(replace, search, lines[start:start+len(search)])
+		}
+
+		result := append([]string{}, lines[:start]...)
+		result = append(result, replace...)
+		result = append(result, lines[start+len(search):]...)
+		return strings.Join(result, "\n"), nil
+	}
+
+	return "", fmt.Errorf("SEARCH text not found in the file%s", closestHint(lines, search))
+}
+
+// findMatches returns the start lines where search matches lines
+func findMatches(lines, search []string, match func(a, b string) bool) []int {
+	var matches []int
+	for start := 0; start+len(search) <= len(lines); start++ {
+		ok := true
+		for i, line := range search {
+			if !match(lines[start+i], line) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matches = append(matches, start)
+		}
+	}
+	return matches
+}
+
+// reindent carries the indentation of the lines search matched over to the
+// replacement. Replacement lines indented like a SEARCH line get that line's
+// indentation in the file; others are shifted by the difference at the
+// first line.
+func reindent(replace, search, matched []string) []string {
+	indents := make(map[string]string)
+	want, got := "", ""
+	for i, line := range search {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if want == "" && got == "" {
+			want, got = leadingSpace(matched[i]), leadingSpace(line)
+		}
+		if _, seen := indents[leadingSpace(line)]; !seen {
+			indents[leadingSpace(line)] = leadingSpace(matched[i])
+		}
+	}
+
+	result := make([]string, len(replace))
+	for i, line := range replace {
+		indent := leadingSpace(line)
+		mapped, known := indents[indent]
+		switch {
+		case strings.TrimSpace(line) == "":
+			result[i] = line
+		case known:
+			result[i] = mapped + line[len(indent):]
+		case strings.HasPrefix(want, got):
+			result[i] = want[len(got):] + line
+		case strings.HasPrefix(got, want) && strings.HasPrefix(line, got[len(want):]):
+			result[i] = line[len(got)-len(want):]
+		default:
+			result[i] = line
+		}
+	}
+	return result
+}
+
+// closestHint points at the file line most similar to the first SEARCH line
+func closestHint(lines, search []string) string {
+	first := ""
+	for _, line := range search {
+		if strings.TrimSpace(line) != "" {
+			first = strings.TrimSpace(line)
+			break
+		}
+	}
+	for i, line := range lines {
+		if first != "" && strings.Contains(strings.TrimSpace(line), first) {
+			return fmt.Sprintf(" (the first SEARCH line appears at line %d, but the following lines differ)", i+1)
+		}
+	}
+	return ""
+}
+
+// trimBlankLines removes blank lines at the start and end
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// leadingSpace returns the indentation of a line
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// ensureNewline terminates non-empty content with a newline
+func ensureNewline(s string) string {
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		return s + "\n"
+	}
+	return s
+}
+
+// DescribeFailures formats failed blocks for the model to correct them
+func DescribeFailures(failures []Failure) string {
+	var sb strings.Builder
+	for i, failure := range failures {
+		fmt.Fprintf(&sb, "Block %d failed: %s\n", i+1, failure.Reason)
+		sb.WriteString("<<<<<<< SEARCH\n")
+		sb.WriteString(failure.Block.Search)
+		sb.WriteString("\n=======\n")
+		sb.WriteString(failure.Block.Replace)
+		sb.WriteString("\n>>>>>>> REPLACE\n\n")
+	}
+	return sb.String()
+}
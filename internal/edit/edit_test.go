@@ -0,0 +1,186 @@
+package edit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    string
+		want    []Block
+		wantErr string
+	}{
+		{
+			name: "path and block",
+			resp: "main.go\n<<<<<<< SEARCH\nold\n=======\nnew\n>>>>>>> REPLACE\n",
+			want: []Block{{Path: "main.go", Search: "old", Replace: "new"}},
+		},
+		{
+			name: "fenced with crlf",
+			resp: "Here you go:\r\n\r\n`cmd/root.go`\r\n```go\r\n<<<<<<< SEARCH\r\na\r\n=======\r\nb\r\n>>>>>>> REPLACE\r\n```\r\n",
+			want: []Block{{Path: "cmd/root.go", Search: "a", Replace: "b"}},
+		},
+		{
+			name: "prose is not a path",
+			resp: "Change the greeting:\n<<<<<<< SEARCH\nhi\n=======\nhello\n>>>>>>> REPLACE",
+			want: []Block{{Search: "hi", Replace: "hello"}},
+		},
+		{
+			name: "second block has no path",
+			resp: "a.go\n<<<<<<< SEARCH\n1\n=======\n2\n>>>>>>> REPLACE\n<<<<<<< SEARCH\n3\n=======\n4\n>>>>>>> REPLACE",
+			want: []Block{{Path: "a.go", Search: "1", Replace: "2"}, {Search: "3", Replace: "4"}},
+		},
+		{name: "no blocks", resp: "I changed the file.", wantErr: "no SEARCH/REPLACE blocks"},
+		{name: "missing divider", resp: "<<<<<<< SEARCH\nold\n>>>>>>> REPLACE", wantErr: "no ======= divider"},
+		{name: "missing replace marker", resp: "<<<<<<< SEARCH\nold\n=======\nnew\n", wantErr: "no >>>>>>> REPLACE marker"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.resp)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Parse error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	const file = "func f() {\n\tif x {\n\t\treturn 1\n\t}\n\treturn 2\n}\n"
+
+	tests := []struct {
+		name       string
+		content    string
+		search     string
+		replace    string
+		want       string
+		wantReason string
+	}{
+		{
+			name:    "exact",
+			content: file,
+			search:  "\t\treturn 1",
+			replace: "\t\treturn 3",
+			want:    "func f() {\n\tif x {\n\t\treturn 3\n\t}\n\treturn 2\n}\n",
+		},
+		{
+			name:    "trailing whitespace",
+			content: file,
+			search:  "\treturn 2   \n}",
+			replace: "\treturn 4\n}",
+			want:    "func f() {\n\tif x {\n\t\treturn 1\n\t}\n\treturn 4\n}\n",
+		},
+		{
+			name:    "indentation is carried over",
+			content: file,
+			search:  "if x {\n    return 1\n}",
+			replace: "if y {\n    return 5\n}",
+			want:    "func f() {\n\tif y {\n\t\treturn 5\n\t}\n\treturn 2\n}\n",
+		},
+		{
+			name:    "blank lines around search",
+			content: file,
+			search:  "\n\treturn 2\n\n",
+			replace: "\treturn 6",
+			want:    "func f() {\n\tif x {\n\t\treturn 1\n\t}\n\treturn 6\n}\n",
+		},
+		{
+			name:    "empty replace deletes",
+			content: "a\nb\nc\n",
+			search:  "b",
+			replace: "",
+			want:    "a\nc\n",
+		},
+		{
+			name:    "new file",
+			content: "",
+			search:  "",
+			replace: "package main",
+			want:    "package main\n",
+		},
+		{
+			name:       "empty search on existing file",
+			content:    file,
+			search:     "",
+			replace:    "package main",
+			wantReason: "only allowed for new or empty files",
+		},
+		{
+			name:       "ambiguous",
+			content:    "x\ny\nx\n",
+			search:     "x",
+			replace:    "z",
+			wantReason: "matches 2 places",
+		},
+		{
+			name:       "not found",
+			content:    file,
+			search:     "\tif x {\n\t\treturn 9",
+			replace:    "",
+			wantReason: "appears at line 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, failures := Apply(tt.content, []Block{{Search: tt.search, Replace: tt.replace}})
+			if tt.wantReason != "" {
+				if len(failures) != 1 || !strings.Contains(failures[0].Reason, tt.wantReason) {
+					t.Errorf("failures = %+v, want one containing %q", failures, tt.wantReason)
+				}
+				if got != tt.content {
+					t.Errorf("content changed by a failed block:\n%s", got)
+				}
+				return
+			}
+			if len(failures) != 0 {
+				t.Fatalf("failures = %+v", failures)
+			}
+			if got != tt.want {
+				t.Errorf("Apply =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		blockPath string
+		path      string
+		applies   bool
+	}{
+		{name: "no path", blockPath: "", path: "cmd/root.go", applies: true},
+		{name: "same path", blockPath: "cmd/root.go", path: "cmd/root.go", applies: true},
+		{name: "dot slash", blockPath: "./cmd/root.go", path: "cmd/root.go", applies: true},
+		{name: "unclean", blockPath: "cmd//x/../root.go", path: "cmd/root.go", applies: true},
+		{name: "other file", blockPath: "cmd/other.go", path: "cmd/root.go", applies: false},
+		{name: "base name only", blockPath: "root.go", path: "cmd/root.go", applies: false},
+		{name: "outside workspace", blockPath: "../etc/passwd", path: "cmd/root.go", applies: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := Block{Path: tt.blockPath, Search: "a", Replace: "b"}
+			matching, failures := ForFile([]Block{block}, tt.path)
+			if tt.applies && (len(matching) != 1 || len(failures) != 0) {
+				t.Errorf("block for %q was not kept for %s: %+v", tt.blockPath, tt.path, failures)
+			}
+			if !tt.applies && (len(matching) != 0 || len(failures) != 1) {
+				t.Errorf("block for %q was kept for %s", tt.blockPath, tt.path)
+			}
+		})
+	}
+}
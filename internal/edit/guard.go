@@ -0,0 +1,67 @@
+package edit
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// placeholderPattern matches comments models use in place of omitted code
+var placeholderPattern = regexp.MustCompile(`(?i)^\s*(//|#|/\*|<!--|--)?\s*(\.\.\.|…)\s*((the )?(rest|remainder) of|existing|remaining|unchanged|other|previous|same as)\b`)
+
+// Guard refuses to replace old with content that looks like a truncated or
+// fenced model response rather than a source file
+func Guard(path, old, content string) error {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	if ext != ".md" && ext != ".markdown" && isFenced(content) {
+		return fmt.Errorf("refusing to write %s: content is wrapped in a Markdown code fence", path)
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if searchMarker.MatchString(line) || replaceMarker.MatchString(line) {
+			return fmt.Errorf("refusing to write %s: content contains unapplied SEARCH/REPLACE markers", path)
+		}
+		if placeholderPattern.MatchString(line) && !strings.Contains(old, strings.TrimSpace(line)) {
+			return fmt.Errorf("refusing to write %s: content contains a placeholder for omitted code: %q", path, strings.TrimSpace(line))
+		}
+	}
+
+	if strings.TrimSpace(content) == "" && strings.TrimSpace(old) != "" {
+		return fmt.Errorf("refusing to write %s: content is empty", path)
+	}
+
+	switch ext {
+	case ".go":
+		// Only hold new content to the standard the old content met
+		fset := token.NewFileSet()
+		if _, err := parser.ParseFile(fset, path, old, 0); old == "" || err == nil {
+			if _, err := parser.ParseFile(fset, path, content, parser.AllErrors); err != nil {
+				return fmt.Errorf("refusing to write %s: content does not parse as Go, it may be truncated: %v", path, err)
+			}
+		}
+	case ".json":
+		if (old == "" || json.Valid([]byte(old))) && !json.Valid([]byte(content)) {
+			return fmt.Errorf("refusing to write %s: content is not valid JSON, it may be truncated", path)
+		}
+	}
+
+	if strings.HasSuffix(old, "\n") && !strings.HasSuffix(content, "\n") && len(content) < len(old)/2 {
+		return fmt.Errorf("refusing to write %s: content is less than half the original size and ends mid-line, it looks truncated", path)
+	}
+
+	return nil
+}
+
+// isFenced reports whether content starts or ends with a Markdown fence line
+func isFenced(content string) bool {
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	first := strings.TrimSpace(lines[0])
+	last := strings.TrimSpace(lines[len(lines)-1])
+	return strings.HasPrefix(first, "```") || strings.HasPrefix(first, "~~~") ||
+		(len(lines) > 1 && (strings.HasPrefix(last, "```") || strings.HasPrefix(last, "~~~")))
+}
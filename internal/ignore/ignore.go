@@ -0,0 +1,330 @@
+package ignore
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultDirs are directories skipped even without ignore files
+var DefaultDirs = []string{".git", ".hg", ".svn", ".tama", "node_modules", "vendor"}
+
+// Files are the ignore files read from each directory
+var Files = []string{".gitignore", ".tamaignore"}
+
+// rule is one pattern of an ignore file
+type rule struct {
+	base     string // Directory of the ignore file, relative to the root ("" for the root)
+	source   string // Ignore file the rule came from
+	text     string // Line as written in the ignore file
+	pattern  string
+	negate   bool // Pattern started with !
+	dirOnly  bool // Pattern ended with /
+	anchored bool // Pattern contains a slash, so it matches from base
+}
+
+// Matcher matches paths against gitignore-style rules
+type Matcher struct {
+	rules []rule
+}
+
+// New creates a matcher with the default directory rules
+func New() *Matcher {
+	m := &Matcher{}
+	for _, dir := range DefaultDirs {
+		m.rules = append(m.rules, rule{pattern: dir, dirOnly: true})
+	}
+	return m
+}
+
+// AddPatterns adds gitignore-syntax patterns relative to base, a slash
+// separated directory relative to the root
+func (m *Matcher) AddPatterns(base string, patterns []string) {
+	m.addPatterns(base, "", patterns)
+}
+
+// addPatterns adds patterns and records where they came from
+func (m *Matcher) addPatterns(base, source string, patterns []string) {
+	base = strings.Trim(filepath.ToSlash(base), "/")
+	if base == "." {
+		base = ""
+	}
+
+	for _, line := range patterns {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		r := rule{base: base, source: source, text: line}
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			r.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		r.pattern = line
+		m.rules = append(m.rules, r)
+	}
+}
+
+// AddFile adds the patterns of an ignore file located in base, a directory
+// relative to the root. A missing file is not an error.
+func (m *Matcher) AddFile(file, base string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	m.addPatterns(base, path.Join(filepath.ToSlash(base), filepath.Base(file)), patterns)
+	return nil
+}
+
+// Match reports whether rel, a path relative to the root, is ignored. As in
+// git, the last matching rule wins, and a path inside an ignored directory
+// is ignored.
+func (m *Matcher) Match(rel string, isDir bool) bool {
+	return m.matchRule(rel, isDir) != nil
+}
+
+// Rule returns the line that ignores rel and the ignore file it came from,
+// which is empty for patterns not read from a file
+func (m *Matcher) Rule(rel string, isDir bool) (text, source string, ignored bool) {
+	if r := m.matchRule(rel, isDir); r != nil {
+		return r.text, r.source, true
+	}
+	return "", "", false
+}
+
+// matchRule returns the rule ignoring rel, or nil
+func (m *Matcher) matchRule(rel string, isDir bool) *rule {
+	rel = strings.Trim(filepath.ToSlash(rel), "/")
+	if rel == "" || rel == "." {
+		return nil
+	}
+
+	// A path is ignored if any of its parent directories is
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if r := m.matchOne(strings.Join(parts[:i], "/"), true); r != nil {
+			return r
+		}
+	}
+	return m.matchOne(rel, isDir)
+}
+
+// matchOne applies the rules to a single path without checking its parents
+// and returns the last matching rule if it ignores the path
+func (m *Matcher) matchOne(rel string, isDir bool) *rule {
+	var last *rule
+	for i := range m.rules {
+		r := &m.rules[i]
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.matches(rel) {
+			last = r
+		}
+	}
+	if last == nil || last.negate {
+		return nil
+	}
+	return last
+}
+
+// matches reports whether the rule's pattern matches rel
+func (r rule) matches(rel string) bool {
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+
+	if r.anchored {
+		return globMatch(r.pattern, rel)
+	}
+	// Unanchored patterns match the name at any depth
+	return globMatch(r.pattern, path.Base(rel))
+}
+
+// globMatch matches a slash-separated path against a pattern in which **
+// matches any number of directories
+func globMatch(pattern, name string) bool {
+	if !strings.Contains(pattern, "**") {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+
+	patternParts := strings.Split(pattern, "/")
+	nameParts := strings.Split(name, "/")
+	return matchParts(patternParts, nameParts)
+}
+
+// matchParts matches path segments, letting ** consume zero or more segments
+func matchParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchParts(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Glob reports whether a slash-separated path matches a glob pattern in
+// which ** matches any number of directories
+func Glob(pattern, name string) bool {
+	return globMatch(strings.TrimPrefix(filepath.ToSlash(pattern), "./"), filepath.ToSlash(name))
+}
+
+// Checker tells whether single paths are ignored, reading the ignore files
+// of each directory on the way to a path once
+type Checker struct {
+	root   string
+	files  []string // Names of the ignore files
+	mu     sync.Mutex
+	m      *Matcher
+	loaded map[string]bool
+}
+
+// NewChecker creates a checker for paths relative to root
+func NewChecker(root string) *Checker {
+	return newChecker(root, New(), Files)
+}
+
+// newChecker creates a checker starting from the rules of m that reads the
+// named ignore files
+func newChecker(root string, m *Matcher, files []string) *Checker {
+	return &Checker{root: root, files: files, m: m, loaded: make(map[string]bool)}
+}
+
+// Ignored reports whether rel, a path relative to the root, is ignored
+func (c *Checker) Ignored(rel string, isDir bool) bool {
+	_, _, ignored := c.Rule(rel, isDir)
+	return ignored
+}
+
+// Rule is like Matcher.Rule for a path relative to the root
+func (c *Checker) Rule(rel string, isDir bool) (text, source string, ignored bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rel = strings.Trim(filepath.ToSlash(rel), "/")
+	c.load("")
+	if dir := path.Dir(rel); dir != "." {
+		base := ""
+		for _, part := range strings.Split(dir, "/") {
+			base = path.Join(base, part)
+			c.load(base)
+		}
+	}
+	return c.m.Rule(rel, isDir)
+}
+
+// load reads the ignore files of a directory relative to the root
+func (c *Checker) load(dir string) {
+	if c.loaded[dir] {
+		return
+	}
+	c.loaded[dir] = true
+	for _, name := range c.files {
+		c.m.AddFile(filepath.Join(c.root, filepath.FromSlash(dir), name), dir)
+	}
+}
+
+// Walk walks the directory dir inside root like filepath.WalkDir, skipping
+// ignored files and directories. Ignore files are read from root down to dir
+// and from each directory as it is entered. fn receives slash-separated
+// paths relative to root.
+func Walk(root, dir string, m *Matcher, fn func(rel string, d fs.DirEntry) error) error {
+	start, err := filepath.Rel(root, dir)
+	if err != nil {
+		return err
+	}
+	start = filepath.ToSlash(start)
+	if start != "." {
+		base := ""
+		for _, part := range strings.Split(start, "/") {
+			for _, name := range Files {
+				m.AddFile(filepath.Join(root, filepath.FromSlash(base), name), base)
+			}
+			base = path.Join(base, part)
+		}
+		if m.Match(start, true) {
+			return nil
+		}
+	}
+
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			return nil // Skip entries we can't access
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+
+		if p != dir && m.Match(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			for _, name := range Files {
+				m.AddFile(filepath.Join(p, name), rel)
+			}
+		}
+		if p == dir {
+			return nil
+		}
+		return fn(rel, d)
+	})
+}
@@ -0,0 +1,79 @@
+package ignore
+
+import "fmt"
+
+// ProtectFile lists, in gitignore syntax, further paths tama must never
+// read, change or send to the model
+const ProtectFile = ".tamaignore"
+
+// builtinSource names the built-in rules in errors
+const builtinSource = "tama's sensitive file rules"
+
+// SensitivePatterns are protected in every workspace: credentials, private
+// keys and large generated files
+var SensitivePatterns = []string{
+	".env",
+	".env.*",
+	"!.env.example",
+	"!.env.sample",
+	"!.env.template",
+	"*.pem",
+	"*.key",
+	"*.p12",
+	"*.pfx",
+	"*.jks",
+	"*.keystore",
+	"*.kdbx",
+	"id_rsa",
+	"id_dsa",
+	"id_ecdsa",
+	"id_ed25519",
+	".ssh/",
+	".gnupg/",
+	".aws/",
+	"secrets/",
+	".netrc",
+	".pgpass",
+	".npmrc",
+	".pypirc",
+	"credentials.json",
+	"*.tfstate",
+	"*.tfstate.*",
+	"*.min.js",
+	"*.min.css",
+	"*.map",
+}
+
+// ProtectedError reports an access to a protected path
+type ProtectedError struct {
+	Path    string // Path relative to its root
+	Pattern string // Rule that protects it
+	Source  string // Where the rule came from
+}
+
+func (e *ProtectedError) Error() string {
+	return fmt.Sprintf("access to %s is blocked by %s (rule %q)", e.Path, e.Source, e.Pattern)
+}
+
+// Protector tells which paths of a directory tree are protected by the
+// built-in sensitive file rules or by .tamaignore files in the tree
+type Protector struct {
+	c *Checker
+}
+
+// NewProtector creates a protector for paths relative to root
+func NewProtector(root string) *Protector {
+	m := &Matcher{}
+	m.addPatterns("", builtinSource, SensitivePatterns)
+	return &Protector{c: newChecker(root, m, []string{ProtectFile})}
+}
+
+// Check returns a *ProtectedError if rel, a path relative to the root, is
+// protected
+func (p *Protector) Check(rel string, isDir bool) error {
+	text, source, protected := p.c.Rule(rel, isDir)
+	if !protected {
+		return nil
+	}
+	return &ProtectedError{Path: rel, Pattern: text, Source: source}
+}
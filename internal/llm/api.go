@@ -8,25 +8,26 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/warm3snow/tama/internal/config"
 )
 
 // sendStreamingChatCompletionRequest sends a streaming request to the provider's API endpoint
-func (c *Client) sendStreamingChatCompletionRequest(provider config.Provider, request ChatCompletionRequest, callback func(string)) (string, error) {
+func (c *Client) sendStreamingChatCompletionRequest(provider config.Provider, request ChatCompletionRequest, callback func(string)) (*Completion, error) {
 	// Always try to use the OpenAI-compatible endpoint first
 	apiURL := fmt.Sprintf("%s/v1/chat/completions", provider.BaseURL)
 
 	// Convert request to JSON
 	jsonBody, err := json.Marshal(request)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
 	// Create HTTP request
 	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	// Set headers
@@ -37,38 +38,41 @@ func (c *Client) sendStreamingChatCompletionRequest(provider config.Provider, re
 
 	// Send request
 	resp, err := c.httpClient.Do(req)
-
-	// If we get a 404 or other error, the provider might not support OpenAI-compatible API
-	// Fall back to provider-specific implementation if needed
-	if err != nil || (resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode >= 400)) {
-		if resp != nil {
-			resp.Body.Close()
-		}
-
-		// Fall back to provider-specific implementation
-		switch provider.Type {
-		case config.OpenAI:
-			return c.sendStreamingChatCompletionToOpenAI(provider, request, callback)
-		case config.Ollama:
-			return c.sendStreamingChatCompletionToOllama(provider, request, callback)
-		default:
-			return "", fmt.Errorf("unsupported provider type: %s", provider.Type)
-		}
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
 	}
-
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, statusError(resp)
+	}
+
 	// For streaming responses, we need to read line by line
-	reader := bufio.NewReader(resp.Body)
+	return readCompletionStream(resp.Body, request.Model, callback)
+}
+
+// maxErrorBody caps how much of an unexpected response is quoted in errors
+const maxErrorBody = 200
+
+// readCompletionStream reads an OpenAI-compatible SSE stream, passing content
+// deltas to callback and collecting the final completion. A body without any
+// events is an error, since it cannot be an answer.
+func readCompletionStream(body io.Reader, model string, callback func(string)) (*Completion, error) {
+	reader := bufio.NewReader(body)
 	var fullResponse strings.Builder
+	var other strings.Builder // Lines that are not events
+	sawEvent := false
+	completion := &Completion{Model: model}
 
 	for {
+		// The last line may end without a newline
 		line, err := reader.ReadBytes('\n')
-		if err == io.EOF {
+		if err == io.EOF && len(line) == 0 {
 			break
 		}
-		if err != nil {
-			return fullResponse.String(), fmt.Errorf("error reading stream: %v", err)
+		if err != nil && err != io.EOF {
+			completion.Content = fullResponse.String()
+			return completion, fmt.Errorf("error reading stream: %v", err)
 		}
 
 		// Skip empty lines
@@ -79,56 +83,127 @@ func (c *Client) sendStreamingChatCompletionRequest(provider config.Provider, re
 
 		// SSE format: lines starting with "data: "
 		const prefix = "data: "
-		if strings.HasPrefix(lineStr, prefix) {
-			data := strings.TrimPrefix(lineStr, prefix)
-
-			// The final message is just "data: [DONE]"
-			if data == "[DONE]" {
-				break
+		if !strings.HasPrefix(lineStr, prefix) {
+			if !sawEvent && other.Len() <= maxErrorBody {
+				other.WriteString(lineStr)
+				other.WriteString("\n")
 			}
+			continue
+		}
+		sawEvent = true
+		data := strings.TrimPrefix(lineStr, prefix)
 
-			// Parse the chunk
-			var chunk ChatCompletionChunk
-			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-				return fullResponse.String(), fmt.Errorf("error parsing chunk: %v", err)
-			}
+		// The final message is just "data: [DONE]"
+		if data == "[DONE]" {
+			break
+		}
 
-			// Handle errors in the chunk
-			if chunk.Error != nil {
-				return fullResponse.String(), fmt.Errorf("API error: %s", chunk.Error.Message)
-			}
+		// Parse the chunk
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			completion.Content = fullResponse.String()
+			return completion, fmt.Errorf("error parsing chunk: %v", err)
+		}
+
+		// Handle errors in the chunk
+		if chunk.Error != nil {
+			completion.Content = fullResponse.String()
+			return completion, fmt.Errorf("API error: %s", chunk.Error.Message)
+		}
+
+		if chunk.Model != "" {
+			completion.Model = chunk.Model
+		}
+
+		// The final chunk carries usage when include_usage is requested
+		if chunk.Usage != nil {
+			completion.Usage = *chunk.Usage
+		}
 
-			// Check if there are choices in the chunk
-			if len(chunk.Choices) > 0 {
-				content := chunk.Choices[0].Delta.Content
-				if content != "" {
-					fullResponse.WriteString(content)
-					if callback != nil {
-						callback(content)
-					}
+		// Check if there are choices in the chunk
+		if len(chunk.Choices) > 0 {
+			if chunk.Choices[0].FinishReason != "" {
+				completion.FinishReason = chunk.Choices[0].FinishReason
+			}
+			content := chunk.Choices[0].Delta.Content
+			if content != "" {
+				fullResponse.WriteString(content)
+				if callback != nil {
+					callback(content)
 				}
 			}
 		}
 	}
 
-	return fullResponse.String(), nil
+	if !sawEvent {
+		return completion, unexpectedResponse(other.String())
+	}
+
+	completion.Content = fullResponse.String()
+	return completion, nil
+}
+
+// statusError describes a failed request by its status and the start of the
+// response body, using the API error it carries when there is one
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	var response ChatCompletionResponse
+	if err := json.Unmarshal(body, &response); err == nil && response.Error != nil {
+		return fmt.Errorf("API error (%s): %s", resp.Status, response.Error.Message)
+	}
+
+	text := clipBody(string(body))
+	if text == "" {
+		return fmt.Errorf("API request failed: %s", resp.Status)
+	}
+	return fmt.Errorf("API request failed: %s: %s", resp.Status, text)
+}
+
+// unexpectedResponse describes a response body that is not an event stream,
+// using the API error it carries when there is one
+func unexpectedResponse(body string) error {
+	var response ChatCompletionResponse
+	if err := json.Unmarshal([]byte(body), &response); err == nil && response.Error != nil {
+		return fmt.Errorf("API error: %s", response.Error.Message)
+	}
+
+	body = clipBody(body)
+	if body == "" {
+		return fmt.Errorf("empty response from provider")
+	}
+	return fmt.Errorf("response is not an event stream: %s", body)
+}
+
+// clipBody trims a response body for an error message, cutting it to
+// maxErrorBody bytes on a character boundary
+func clipBody(body string) string {
+	body = strings.TrimSpace(body)
+	if len(body) <= maxErrorBody {
+		return body
+	}
+	end := maxErrorBody
+	for end > 0 && !utf8.RuneStart(body[end]) {
+		end--
+	}
+	return body[:end] + "..."
 }
 
 // sendChatCompletionRequest sends a request to the provider's API endpoint
-func (c *Client) sendChatCompletionRequest(provider config.Provider, request ChatCompletionRequest) (string, error) {
+func (c *Client) sendChatCompletionRequest(provider config.Provider, request ChatCompletionRequest) (*Completion, error) {
 	// Always try to use the OpenAI-compatible endpoint first
 	apiURL := fmt.Sprintf("%s/v1/chat/completions", provider.BaseURL)
 
 	// Convert request to JSON
 	jsonBody, err := json.Marshal(request)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
 	// Create HTTP request
 	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	// Set headers
@@ -139,49 +214,54 @@ func (c *Client) sendChatCompletionRequest(provider config.Provider, request Cha
 
 	// Send request
 	resp, err := c.httpClient.Do(req)
-
-	// If we get a 404 or other error, the provider might not support OpenAI-compatible API
-	// Fall back to provider-specific implementation if needed
-	if err != nil || (resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode >= 400)) {
-		if resp != nil {
-			resp.Body.Close()
-		}
-
-		// Fall back to provider-specific implementation
-		switch provider.Type {
-		case config.OpenAI:
-			return c.sendChatCompletionToOpenAI(provider, request)
-		case config.Ollama:
-			return c.sendChatCompletionToOllama(provider, request)
-		default:
-			return "", fmt.Errorf("unsupported provider type: %s", provider.Type)
-		}
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
 	}
-
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, statusError(resp)
+	}
+
 	// Read response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %v", err)
+		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
 
 	// Parse response - this should work for all OpenAI-compatible APIs
 	var chatResponse ChatCompletionResponse
 	if err := json.Unmarshal(body, &chatResponse); err != nil {
-		return "", fmt.Errorf("failed to parse response: %v", err)
+		return nil, fmt.Errorf("failed to parse response: %v", err)
 	}
 
 	// Check for API errors
 	if chatResponse.Error != nil {
-		return "", fmt.Errorf("API error: %s", chatResponse.Error.Message)
+		return nil, fmt.Errorf("API error: %s", chatResponse.Error.Message)
 	}
 
+	return completionFromResponse(chatResponse, request.Model)
+}
+
+// completionFromResponse extracts the first choice of a non-streaming response
+func completionFromResponse(chatResponse ChatCompletionResponse, model string) (*Completion, error) {
 	// Check if we have any choices
 	if len(chatResponse.Choices) == 0 {
-		return "", fmt.Errorf("no response from API")
+		return nil, fmt.Errorf("no response from API")
+	}
+
+	completion := &Completion{
+		Content:      chatResponse.Choices[0].Message.Content,
+		Model:        model,
+		FinishReason: chatResponse.Choices[0].FinishReason,
+	}
+	if chatResponse.Model != "" {
+		completion.Model = chatResponse.Model
+	}
+	if chatResponse.Usage != nil {
+		completion.Usage = *chatResponse.Usage
 	}
 
 	// Return the content of the first choice
-	return chatResponse.Choices[0].Message.Content, nil
+	return completion, nil
 }
@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/warm3snow/tama/internal/config"
+)
+
+func TestRequestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "server error", status: http.StatusInternalServerError, body: "upstream exploded", wantErr: "500 Internal Server Error: upstream exploded"},
+		{name: "api error", status: http.StatusUnauthorized, body: `{"error": {"message": "invalid api key"}}`, wantErr: "API error (401 Unauthorized): invalid api key"},
+		{name: "not found", status: http.StatusNotFound, wantErr: "404 Not Found"},
+		{name: "long body", status: http.StatusBadGateway, body: strings.Repeat("é", 500), wantErr: strings.Repeat("é", maxErrorBody/2) + "..."},
+		{name: "not a stream", status: http.StatusOK, body: "<html>login</html>", wantErr: "not an event stream"},
+	}
+
+	for _, tt := range tests {
+		for _, providerType := range []config.ProviderType{config.OpenAI, config.Ollama} {
+			for _, stream := range []bool{true, false} {
+				if tt.status == http.StatusOK && !stream {
+					continue
+				}
+				t.Run(fmt.Sprintf("%s/%s/stream=%v", tt.name, providerType, stream), func(t *testing.T) {
+					requests := 0
+					server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						requests++
+						w.WriteHeader(tt.status)
+						fmt.Fprint(w, tt.body)
+					}))
+					defer server.Close()
+
+					client := NewClient(config.GetDefaultConfig())
+					provider := config.Provider{Type: providerType, BaseURL: server.URL, APIKey: "k"}
+					request := ChatCompletionRequest{Model: "m", Messages: []Message{{Role: "user", Content: "hi"}}, Stream: stream}
+
+					var err error
+					if stream {
+						_, err = client.Stream(provider, request, func(string) {})
+					} else {
+						_, err = client.Complete(provider, request)
+					}
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+					}
+					if requests != 1 {
+						t.Errorf("server got %d requests, want 1", requests)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestUnreachableProvider(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	client := NewClient(config.GetDefaultConfig())
+	provider := config.Provider{Type: config.OpenAI, BaseURL: url}
+	request := ChatCompletionRequest{Model: "m", Messages: []Message{{Role: "user", Content: "hi"}}}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Stream(provider, request, func(string) {})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "failed to send request") {
+			t.Errorf("error = %v, want a send failure", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request to an unreachable provider did not return")
+	}
+}
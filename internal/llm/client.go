@@ -4,48 +4,105 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/warm3snow/tama/internal/config"
 	"github.com/warm3snow/tama/internal/logging"
+	"github.com/warm3snow/tama/internal/redact"
 )
 
 // Client represents an LLM client that can communicate with different providers
 type Client struct {
 	cfg          config.Config
 	httpClient   *http.Client
-	conversation []Message
+	conversation *History
+	apiKeys      map[string]string // Resolved API keys by provider name
+	usage        Usage             // Tokens used by all requests of this client
+	redactor     *redact.Redactor  // Masks secrets in outgoing messages
+	redactErr    error             // Invalid redaction configuration, blocks requests
 }
 
 // NewClient creates a new LLM client
 func NewClient(cfg config.Config) *Client {
-	return &Client{
+	c := &Client{
 		cfg:          cfg,
 		httpClient:   &http.Client{},
-		conversation: make([]Message, 0),
+		conversation: NewHistory(),
+		apiKeys:      make(map[string]string),
+		redactor:     redact.New(),
 	}
+	c.redactErr = c.redactor.Configure(cfg.Redaction)
+	return c
+}
+
+// resolveProvider returns the named provider configuration with its API key
+// reference (env:, cmd:, file:, secret:) resolved. Keys are resolved once per client.
+func (c *Client) resolveProvider(name string) (config.Provider, error) {
+	providerConfig, ok := c.cfg.Providers[name]
+	if !ok {
+		return config.Provider{}, fmt.Errorf("provider %s not configured", name)
+	}
+
+	if key, ok := c.apiKeys[name]; ok {
+		providerConfig.APIKey = key
+		return providerConfig, nil
+	}
+
+	key, err := providerConfig.ResolveAPIKey()
+	if err != nil {
+		return config.Provider{}, fmt.Errorf("provider %s: %v", name, err)
+	}
+	c.apiKeys[name] = key
+	providerConfig.APIKey = key
+
+	return providerConfig, nil
 }
 
 // Stream sends a streaming chat completion request to the specified provider
-func (c *Client) Stream(provider config.Provider, request ChatCompletionRequest, callback func(string)) (string, error) {
+func (c *Client) Stream(provider config.Provider, request ChatCompletionRequest, callback func(string)) (*Completion, error) {
+	// Ask for token usage in the final chunk where the server understands
+	// it; some OpenAI-compatible servers reject unknown fields
+	if supportsStreamOptions(provider) {
+		request.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
 	switch provider.Type {
 	case config.OpenAI:
 		return c.sendStreamingChatCompletionToOpenAI(provider, request, callback)
 	case config.Ollama:
 		return c.sendStreamingChatCompletionToOllama(provider, request, callback)
 	default:
-		return "", fmt.Errorf("unsupported provider type: %s", provider.Type)
+		return nil, fmt.Errorf("unsupported provider type: %s", provider.Type)
 	}
 }
 
+// streamOptionsHosts lists the API hosts known to accept stream_options
+var streamOptionsHosts = map[string]bool{
+	"api.openai.com": true,
+}
+
+// supportsStreamOptions reports whether a provider is known to accept the
+// stream_options field of streaming requests
+func supportsStreamOptions(provider config.Provider) bool {
+	if provider.Type != config.OpenAI {
+		return false
+	}
+	u, err := url.Parse(provider.BaseURL)
+	if err != nil {
+		return false
+	}
+	return streamOptionsHosts[u.Hostname()]
+}
+
 // Complete sends a chat completion request to the specified provider
-func (c *Client) Complete(provider config.Provider, request ChatCompletionRequest) (string, error) {
+func (c *Client) Complete(provider config.Provider, request ChatCompletionRequest) (*Completion, error) {
 	switch provider.Type {
 	case config.OpenAI:
 		return c.sendChatCompletionToOpenAI(provider, request)
 	case config.Ollama:
 		return c.sendChatCompletionToOllama(provider, request)
 	default:
-		return "", fmt.Errorf("unsupported provider type: %s", provider.Type)
+		return nil, fmt.Errorf("unsupported provider type: %s", provider.Type)
 	}
 }
 
@@ -56,17 +113,33 @@ func (c *Client) SendMessage(message string) (string, error) {
 
 // SendMessageWithCallback sends a message to the LLM and streams the response through a callback
 func (c *Client) SendMessageWithCallback(message string, callback func(string)) (string, error) {
+	completion, err := c.SendMessageWithResult(message, callback)
+	if err != nil {
+		return "", err
+	}
+	return completion.Content, nil
+}
+
+// SendMessageWithResult sends a message to the LLM, streams the response through
+// the callback if one is given, and returns the completion with its metadata.
+// Configuration problems are reported as *ConfigError.
+func (c *Client) SendMessageWithResult(message string, callback func(string)) (*Completion, error) {
 	provider := c.cfg.Defaults.Provider
-	providerConfig, ok := c.cfg.Providers[provider]
-	if !ok {
-		return "", fmt.Errorf("provider %s not configured", provider)
+	providerConfig, err := c.resolveProvider(provider)
+	if err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	if c.redactErr != nil {
+		return nil, &ConfigError{Err: c.redactErr}
 	}
 
 	// Log the LLM request
 	logging.LogLLMRequest(provider, c.cfg.Defaults.Model, len(message))
 
-	// Create the chat completion request with conversation history
-	messages := append(c.conversation, Message{Role: "user", Content: message})
+	// Create the chat completion request with conversation history, with
+	// secrets replaced by placeholders
+	messages := append(c.conversation.Window(maxHistory), Message{Role: "user", Content: message})
+	messages = c.redactMessages(messages)
 	request := ChatCompletionRequest{
 		Model:       c.cfg.Defaults.Model,
 		Messages:    messages,
@@ -75,12 +148,11 @@ func (c *Client) SendMessageWithCallback(message string, callback func(string))
 		Stream:      callback != nil, // Enable streaming if callback is provided
 	}
 
-	var response string
-	var err error
+	var completion *Completion
 
 	if callback != nil {
 		// Use streaming for the response
-		response, err = c.Stream(providerConfig, request, func(chunk string) {
+		completion, err = c.Stream(providerConfig, request, func(chunk string) {
 			// Try to parse as tool call
 			var toolCall ToolCall
 			if err := json.Unmarshal([]byte(chunk), &toolCall); err == nil && toolCall.Tool != "" {
@@ -94,66 +166,109 @@ func (c *Client) SendMessageWithCallback(message string, callback func(string))
 		})
 	} else {
 		// Use regular request
-		response, err = c.Complete(providerConfig, request)
+		completion, err = c.Complete(providerConfig, request)
 	}
 
 	// Log the LLM response
-	logging.LogLLMResponse(provider, c.cfg.Defaults.Model, len(response), err)
+	responseLength := 0
+	if completion != nil {
+		responseLength = len(completion.Content)
+	}
+	logging.LogLLMResponse(provider, c.cfg.Defaults.Model, responseLength, err)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return response, nil
+	c.usage.PromptTokens += completion.Usage.PromptTokens
+	c.usage.CompletionTokens += completion.Usage.CompletionTokens
+	c.usage.TotalTokens += completion.Usage.TotalTokens
+
+	return completion, nil
+}
+
+// redactMessages returns copies of messages with secrets replaced by
+// placeholders and logs what was redacted
+func (c *Client) redactMessages(messages []Message) []Message {
+	counts := make(map[string]int)
+	redacted := make([]Message, len(messages))
+	for i, m := range messages {
+		var events, resultEvents []redact.Event
+		m.Content, events = c.redactor.Redact(m.Content)
+		m.ToolResult, resultEvents = c.redactor.Redact(m.ToolResult)
+		for _, e := range append(events, resultEvents...) {
+			counts[e.Rule]++
+		}
+		redacted[i] = m
+	}
+	for rule, count := range counts {
+		logging.LogRedaction(rule, count)
+	}
+	return redacted
+}
+
+// Redact replaces secrets in text with the placeholders the model sees
+func (c *Client) Redact(text string) string {
+	redacted, _ := c.redactor.Redact(text)
+	return redacted
+}
+
+// Restore replaces the placeholders in text, typically written by the
+// model, with the values they stand for
+func (c *Client) Restore(text string) string {
+	return c.redactor.Restore(text)
+}
+
+// TotalUsage returns the tokens used by all requests sent through the client
+func (c *Client) TotalUsage() Usage {
+	return c.usage
+}
+
+// ConfigError reports a request that could not be sent because the
+// provider configuration is missing or invalid
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
 }
 
 // UpdateConversation updates the conversation history
 func (c *Client) UpdateConversation(userMessage, aiResponse string) {
-	c.conversation = append(c.conversation,
-		Message{Role: "user", Content: userMessage},
-		Message{Role: "assistant", Content: aiResponse})
-
-	// Limit conversation history to prevent token overflow
-	if len(c.conversation) > 10 {
-		c.conversation = c.conversation[len(c.conversation)-10:]
-	}
+	c.conversation.Append(Message{Role: "user", Content: userMessage})
+	c.conversation.Append(Message{Role: "assistant", Content: aiResponse})
 }
 
 // AddSystemMessage adds a system message to the conversation history
 func (c *Client) AddSystemMessage(message string) {
-	c.conversation = append(c.conversation, Message{Role: "system", Content: message})
-
-	// Limit conversation history to prevent token overflow
-	if len(c.conversation) > 10 {
-		c.conversation = c.conversation[len(c.conversation)-10:]
-	}
+	c.conversation.Append(Message{Role: "system", Content: message})
 }
 
-// GetConversation returns the current conversation history
+// GetConversation returns the messages of the active branch. Only the most
+// recent of them are sent with each request.
 func (c *Client) GetConversation() []Message {
+	return c.conversation.Messages()
+}
+
+// History returns the conversation tree for undo, retry and branching
+func (c *Client) History() *History {
 	return c.conversation
 }
 
-// ResetConversation clears all conversation history
+// ResetConversation clears all conversation history, including all branches
 func (c *Client) ResetConversation() {
-	c.conversation = make([]Message, 0)
+	c.conversation = NewHistory()
 	logging.Logger.Info("Conversation history has been reset")
 }
 
-// ClearSystemMessages removes all system messages from the conversation history
+// ClearSystemMessages removes all system messages from the active branch
 func (c *Client) ClearSystemMessages() {
-	// Create a new slice to hold non-system messages
-	newMessages := make([]Message, 0)
-
-	// Keep only non-system messages
-	for _, msg := range c.conversation {
-		if msg.Role != "system" {
-			newMessages = append(newMessages, msg)
-		}
-	}
-
-	// Update the conversation with filtered messages
-	c.conversation = newMessages
+	c.conversation.RemoveRole("system")
 }
 
 // Close closes the client and releases resources
@@ -161,6 +276,18 @@ func (c *Client) Close() {
 	// Nothing to close for now
 }
 
+// SetConfig replaces the client configuration, keeping the conversation history
+func (c *Client) SetConfig(cfg config.Config) {
+	c.cfg = cfg
+	c.apiKeys = make(map[string]string)
+	c.redactErr = c.redactor.Configure(cfg.Redaction)
+}
+
+// SetModel changes the model for subsequent requests without persisting it
+func (c *Client) SetModel(model string) {
+	c.cfg.Defaults.Model = model
+}
+
 // GetProvider returns the current provider name
 func (c *Client) GetProvider() string {
 	return c.cfg.Defaults.Provider
@@ -173,10 +300,9 @@ func (c *Client) GetModel() string {
 
 // GetModels returns the available models
 func (c *Client) GetModels() ([]string, error) {
-	provider := c.cfg.Defaults.Provider
-	providerConfig, ok := c.cfg.Providers[provider]
-	if !ok {
-		return nil, fmt.Errorf("provider %s not configured", provider)
+	providerConfig, err := c.resolveProvider(c.cfg.Defaults.Provider)
+	if err != nil {
+		return nil, err
 	}
 
 	// Try to use OpenAI-compatible endpoint first
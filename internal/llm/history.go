@@ -0,0 +1,259 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// maxHistory is the number of recent messages sent with each request
+const maxHistory = 10
+
+// DefaultBranch is the branch a conversation starts on
+const DefaultBranch = "main"
+
+// historyNode is one message in the conversation tree
+type historyNode struct {
+	message   Message
+	parent    *historyNode
+	turnStart bool   // First message of a user turn
+	turnInput string // Input that started the turn
+}
+
+// History is a tree of conversation messages. A branch names a path from
+// the root to its head message; new messages extend the active branch.
+// Rewinding to retry or edit an exchange keeps the old path on a branch of
+// its own, so the new answer is a sibling of the old one.
+type History struct {
+	branches map[string]*historyNode // Head message of each branch, nil if empty
+	active   string
+
+	turnPending bool         // The next message starts a turn
+	turnInput   string       // Input of the pending turn
+	turnNode    *historyNode // First message of the turn in progress
+}
+
+// BranchInfo describes a branch of the conversation
+type BranchInfo struct {
+	Name     string
+	Messages int  // Messages on the path to the branch head
+	Active   bool // The branch new messages are added to
+}
+
+// NewHistory creates an empty history on the default branch
+func NewHistory() *History {
+	return &History{
+		branches: map[string]*historyNode{DefaultBranch: nil},
+		active:   DefaultBranch,
+	}
+}
+
+// Append adds a message to the active branch
+func (h *History) Append(message Message) {
+	node := &historyNode{message: message, parent: h.branches[h.active]}
+	if h.turnPending {
+		node.turnStart = true
+		node.turnInput = h.turnInput
+		h.turnPending = false
+		h.turnNode = node
+	}
+	h.branches[h.active] = node
+}
+
+// BeginTurn marks the next message as the start of a turn started by input.
+// Undo drops everything from the start of the last turn.
+func (h *History) BeginTurn(input string) {
+	h.turnPending = true
+	h.turnInput = input
+	h.turnNode = nil
+}
+
+// EndTurn ends the turn in progress. A turn that added no user message
+// failed, so its messages, such as system notes, join the turn before it.
+func (h *History) EndTurn() {
+	h.turnPending = false
+	if h.turnNode == nil {
+		return
+	}
+	failed := true
+	for node := h.branches[h.active]; node != nil; node = node.parent {
+		if node.message.Role == "user" {
+			failed = false
+		}
+		if node == h.turnNode {
+			break
+		}
+	}
+	if failed {
+		h.turnNode.turnStart = false
+		h.turnNode.turnInput = ""
+	}
+	h.turnNode = nil
+}
+
+// nodes returns the messages of the active branch from the root
+func (h *History) nodes() []*historyNode {
+	var nodes []*historyNode
+	for node := h.branches[h.active]; node != nil; node = node.parent {
+		nodes = append(nodes, node)
+	}
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+	return nodes
+}
+
+// Messages returns the messages of the active branch from the root
+func (h *History) Messages() []Message {
+	nodes := h.nodes()
+	messages := make([]Message, len(nodes))
+	for i, node := range nodes {
+		messages[i] = node.message
+	}
+	return messages
+}
+
+// Window returns at most the last n messages of the active branch
+func (h *History) Window(n int) []Message {
+	messages := h.Messages()
+	if len(messages) > n {
+		messages = messages[len(messages)-n:]
+	}
+	return messages
+}
+
+// lastTurn returns the first message of the last turn on the active branch
+func (h *History) lastTurn() *historyNode {
+	for node := h.branches[h.active]; node != nil; node = node.parent {
+		if node.turnStart {
+			return node
+		}
+	}
+	return nil
+}
+
+// LastTurn returns the input that started the last turn on the active branch
+func (h *History) LastTurn() (string, bool) {
+	node := h.lastTurn()
+	if node == nil {
+		return "", false
+	}
+	return node.turnInput, true
+}
+
+// Undo drops the last turn from the active branch and returns its input
+func (h *History) Undo() (string, bool) {
+	node := h.lastTurn()
+	if node == nil {
+		return "", false
+	}
+	h.branches[h.active] = node.parent
+	h.turnPending = false
+	return node.turnInput, true
+}
+
+// Rewind drops the last turn from the active branch like Undo, but first
+// keeps the old path on a new branch so it stays reachable. It returns the
+// turn's input and the name of that branch, which is empty if another
+// branch already ends where the active one did.
+func (h *History) Rewind() (string, string, bool) {
+	node := h.lastTurn()
+	if node == nil {
+		return "", "", false
+	}
+
+	head := h.branches[h.active]
+	kept := ""
+	for name, other := range h.branches {
+		if name != h.active && other == head {
+			kept = name
+		}
+	}
+	saved := ""
+	if kept == "" {
+		saved = h.newBranchName()
+		h.branches[saved] = head
+	}
+
+	h.branches[h.active] = node.parent
+	h.turnPending = false
+	return node.turnInput, saved, true
+}
+
+// newBranchName returns an unused branch name
+func (h *History) newBranchName() string {
+	for i := len(h.branches); ; i++ {
+		name := fmt.Sprintf("branch-%d", i)
+		if _, exists := h.branches[name]; !exists {
+			return name
+		}
+	}
+}
+
+// Fork creates a branch ending at message n (counted from 1) of the active
+// branch and switches to it. An empty name picks one.
+func (h *History) Fork(n int, name string) (string, error) {
+	nodes := h.nodes()
+	if n < 1 || n > len(nodes) {
+		return "", fmt.Errorf("message %d does not exist (the branch has %d messages)", n, len(nodes))
+	}
+
+	if name == "" {
+		name = h.newBranchName()
+	} else if _, exists := h.branches[name]; exists {
+		return "", fmt.Errorf("branch %s already exists", name)
+	}
+
+	h.branches[name] = nodes[n-1]
+	h.active = name
+	h.turnPending = false
+	return name, nil
+}
+
+// Switch makes the named branch active
+func (h *History) Switch(name string) error {
+	if _, exists := h.branches[name]; !exists {
+		return fmt.Errorf("branch %s does not exist", name)
+	}
+	h.active = name
+	h.turnPending = false
+	return nil
+}
+
+// Branches returns the branches sorted by name
+func (h *History) Branches() []BranchInfo {
+	branches := make([]BranchInfo, 0, len(h.branches))
+	for name, head := range h.branches {
+		count := 0
+		for node := head; node != nil; node = node.parent {
+			count++
+		}
+		branches = append(branches, BranchInfo{Name: name, Messages: count, Active: name == h.active})
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		return branches[i].Name < branches[j].Name
+	})
+	return branches
+}
+
+// ActiveBranch returns the name of the active branch
+func (h *History) ActiveBranch() string {
+	return h.active
+}
+
+// RemoveRole replaces the active branch with a copy of its path that leaves
+// out messages with the given role. Other branches are unchanged.
+func (h *History) RemoveRole(role string) {
+	var head *historyNode
+	turnStart, turnInput := false, ""
+	for _, node := range h.nodes() {
+		if node.turnStart {
+			turnStart, turnInput = true, node.turnInput
+		}
+		if node.message.Role == role {
+			continue
+		}
+		head = &historyNode{message: node.message, parent: head, turnStart: turnStart, turnInput: turnInput}
+		turnStart, turnInput = false, ""
+	}
+	h.branches[h.active] = head
+}
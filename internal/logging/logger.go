@@ -183,6 +183,23 @@ func LogLLMResponse(provider string, model string, responseLength int, error err
 	}
 }
 
+// LogRedaction logs how many values a rule redacted from a request. The
+// values themselves are never logged.
+func LogRedaction(rule string, count int) {
+	Logger.Info("Redacted",
+		"rule", rule,
+		"count", count)
+}
+
+// LogToolDecision logs a tool call the policy refused or the user decided
+// about
+func LogToolDecision(tool, decision, reason string) {
+	Logger.Info("Tool Permission",
+		"tool", tool,
+		"decision", decision,
+		"reason", reason)
+}
+
 // LogAppStart logs application startup
 func LogAppStart(version string) {
 	Logger.Info("App Started", "version", version)
@@ -3,6 +3,7 @@ package machine
 import (
 	"os"
 	"runtime"
+	"strconv"
 	"sync"
 )
 
@@ -38,7 +39,7 @@ func (c *Context) GetSystemInfo() map[string]string {
 		"arch":       c.Architecture,
 		"workspace":  c.WorkspacePath,
 		"shell":      c.Shell,
-		"num_cpu":    string(runtime.NumCPU()),
+		"num_cpu":    strconv.Itoa(runtime.NumCPU()),
 		"go_version": runtime.Version(),
 	}
 }
@@ -0,0 +1,333 @@
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/warm3snow/tama/internal/config"
+)
+
+// defaultEntropy is the minimum Shannon entropy, in bits per character, of
+// a token that is redacted for looking random
+const defaultEntropy = 4.0
+
+// minEntropyLength is the shortest token checked for entropy
+const minEntropyLength = 24
+
+// builtinRules detect common secrets and personal data. When a pattern has a
+// group, only the group is redacted.
+var builtinRules = []config.RedactionRule{
+	{Name: "PRIVATE_KEY", Pattern: `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`},
+	{Name: "AWS_KEY", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "GITHUB_TOKEN", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`},
+	{Name: "API_KEY", Pattern: `\bsk-[A-Za-z0-9_-]{20,}`},
+	{Name: "GOOGLE_KEY", Pattern: `\bAIza[0-9A-Za-z_-]{35}`},
+	{Name: "STRIPE_KEY", Pattern: `\b[rs]k_(?:live|test)_[0-9A-Za-z]{16,}`},
+	{Name: "SLACK_TOKEN", Pattern: `\bxox[abprs]-[A-Za-z0-9-]{10,}`},
+	{Name: "JWT", Pattern: `\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{10,}`},
+	{Name: "TOKEN", Pattern: `(?i)\bbearer\s+([A-Za-z0-9._~+/-]{16,}=*)`},
+	{Name: "PASSWORD", Pattern: `\b[A-Za-z][A-Za-z0-9+.-]*://[^\s:/@]+:([^\s@/]+)@`},
+	{Name: "PASSWORD", Pattern: `(?i)(?:password|passwd|secret|token|api_?key|access_?key)\w*["']?\s*[:=]\s*["']([^"'\s]{6,})["']`},
+	{Name: "PASSWORD", Pattern: `(?im)^\s*(?:export\s+)?\w*(?:PASSWORD|PASSWD|SECRET|TOKEN|API_?KEY)\w*\s*=\s*([^\s"'#]{6,})`},
+	{Name: "EMAIL", Pattern: `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`},
+}
+
+// tokenPattern finds candidates for entropy detection
+var tokenPattern = regexp.MustCompile(`[A-Za-z0-9+/_=-]{24,}`)
+
+// identifierPattern matches tokens shaped like identifiers
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// minWordLength is the average length of the words an identifier or path
+// is made of, above which it reads as code rather than random text
+const minWordLength = 4
+
+// hexPattern matches hex strings such as commit hashes, which are not
+// redacted for their entropy
+var hexPattern = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+// nonNameChars matches characters not allowed in rule names
+var nonNameChars = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// placeholderPattern matches the placeholders Redact inserts
+var placeholderPattern = regexp.MustCompile(`\[REDACTED_[A-Z0-9_]+?_[0-9]+\]`)
+
+// rule is a compiled redaction rule
+type rule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Event reports one redacted value, without the value itself
+type Event struct {
+	Rule        string
+	Placeholder string
+}
+
+// Redactor replaces secrets with placeholders such as [REDACTED_API_KEY_1].
+// The same value always gets the same placeholder, so placeholders the model
+// writes back can be restored.
+type Redactor struct {
+	mu       sync.Mutex
+	disabled bool
+	rules    []rule
+	allow    []*regexp.Regexp
+	entropy  float64 // 0 disables entropy detection
+
+	placeholders map[string]string // Placeholder by value
+	values       map[string]string // Value by placeholder
+	counts       map[string]int    // Placeholders made per rule
+}
+
+// New creates a redactor with the built-in rules
+func New() *Redactor {
+	r := &Redactor{
+		placeholders: make(map[string]string),
+		values:       make(map[string]string),
+		counts:       make(map[string]int),
+	}
+	r.Configure(config.RedactionConfig{})
+	return r
+}
+
+// Configure replaces the rules and allowlist. Placeholders handed out
+// before stay valid.
+func (r *Redactor) Configure(cfg config.RedactionConfig) error {
+	rules, err := compileRules(append(append([]config.RedactionRule{}, builtinRules...), cfg.Rules...))
+	if err != nil {
+		return err
+	}
+	var allow []*regexp.Regexp
+	for _, pattern := range cfg.Allow {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid redaction allow pattern %q: %v", pattern, err)
+		}
+		allow = append(allow, re)
+	}
+	entropy := cfg.Entropy
+	switch {
+	case entropy == 0:
+		entropy = defaultEntropy
+	case entropy < 0:
+		entropy = 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.disabled = cfg.Disabled
+	r.rules = rules
+	r.allow = allow
+	r.entropy = entropy
+	return nil
+}
+
+// compileRules compiles rules, naming the rule of an invalid pattern
+func compileRules(rules []config.RedactionRule) ([]rule, error) {
+	compiled := make([]rule, 0, len(rules))
+	for _, cr := range rules {
+		re, err := regexp.Compile(cr.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction rule %s: %v", cr.Name, err)
+		}
+		compiled = append(compiled, rule{name: ruleName(cr.Name), re: re})
+	}
+	return compiled, nil
+}
+
+// ruleName turns a rule name into the form used in placeholders
+func ruleName(name string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	name = nonNameChars.ReplaceAllString(name, "_")
+	if name = strings.Trim(name, "_"); name == "" {
+		return "SECRET"
+	}
+	return name
+}
+
+// span is a part of the text to redact
+type span struct {
+	start, end int
+	rule       string
+	priority   int // Index of the rule; earlier rules win
+}
+
+// Redact returns text with secrets replaced by placeholders and an event for
+// each replacement. Email matches starting with git@ are SSH remotes and stay.
+func (r *Redactor) Redact(text string) (string, []Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.disabled || text == "" {
+		return text, nil
+	}
+
+	var spans []span
+	for i, rl := range r.rules {
+		for _, m := range rl.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			if end > start {
+				spans = append(spans, span{start, end, rl.name, i})
+			}
+		}
+	}
+	if r.entropy > 0 {
+		for _, m := range tokenPattern.FindAllStringIndex(text, -1) {
+			if token := text[m[0]:m[1]]; looksRandom(token, r.entropy) {
+				spans = append(spans, span{m[0], m[1], "SECRET", len(r.rules)})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return text, nil
+	}
+
+	// Spans starting earlier, then those of earlier rules, win over the
+	// ones they overlap
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].priority < spans[j].priority
+	})
+
+	var sb strings.Builder
+	var events []Event
+	last := 0
+	for _, s := range spans {
+		if s.start < last {
+			continue
+		}
+		value := text[s.start:s.end]
+		if r.allowed(value) || (s.rule == "EMAIL" && strings.HasPrefix(value, "git@")) {
+			continue
+		}
+		placeholder := r.placeholder(value, s.rule)
+		sb.WriteString(text[last:s.start])
+		sb.WriteString(placeholder)
+		last = s.end
+		events = append(events, Event{Rule: s.rule, Placeholder: placeholder})
+	}
+	sb.WriteString(text[last:])
+	return sb.String(), events
+}
+
+// Restore replaces the placeholders in text with the values they stand for.
+// Unknown placeholders are left as they are.
+func (r *Redactor) Restore(text string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.values) == 0 {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if value, ok := r.values[placeholder]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// allowed reports whether a value is allowlisted or already a placeholder
+func (r *Redactor) allowed(value string) bool {
+	if placeholderPattern.MatchString(value) {
+		return true
+	}
+	for _, re := range r.allow {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholder returns the placeholder of a value, making one if needed
+func (r *Redactor) placeholder(value, ruleName string) string {
+	if placeholder, ok := r.placeholders[value]; ok {
+		return placeholder
+	}
+	r.counts[ruleName]++
+	placeholder := fmt.Sprintf("[REDACTED_%s_%d]", ruleName, r.counts[ruleName])
+	r.placeholders[value] = placeholder
+	r.values[placeholder] = value
+	return placeholder
+}
+
+// looksRandom reports whether a token mixes letters and digits and has at
+// least the given entropy. Hex strings such as hashes and identifiers and
+// paths made of words are not considered.
+func looksRandom(token string, minEntropy float64) bool {
+	if len(token) < minEntropyLength || hexPattern.MatchString(token) || looksLikeCode(token) {
+		return false
+	}
+	if !strings.ContainsAny(token, "0123456789") ||
+		!strings.ContainsAny(token, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+		return false
+	}
+	return entropy(token) >= minEntropy
+}
+
+// looksLikeCode reports whether every slash-separated part of a token is an
+// identifier made of words, such as TestParseDecision_InvalidJSON2 or
+// internal/tools/sandbox_linux_amd64_test. Random strings change between
+// lower and upper case and letters and digits too often to qualify.
+func looksLikeCode(token string) bool {
+	for _, part := range strings.Split(token, "/") {
+		if !identifierPattern.MatchString(part) || averageWordLength(part) < minWordLength {
+			return false
+		}
+	}
+	return true
+}
+
+// averageWordLength splits an identifier into words at underscores, lower to
+// upper case changes and letter to digit changes, and returns the average
+// number of letters and digits per word
+func averageWordLength(identifier string) float64 {
+	words, chars := 0, 0
+	var prev rune
+	for _, c := range identifier {
+		if c == '_' {
+			prev = c
+			continue
+		}
+		if prev == 0 || prev == '_' || wordBoundary(prev, c) {
+			words++
+		}
+		chars++
+		prev = c
+	}
+	if words == 0 {
+		return 0
+	}
+	return float64(chars) / float64(words)
+}
+
+// wordBoundary reports whether a new word starts between two characters
+func wordBoundary(prev, c rune) bool {
+	isDigit := func(r rune) bool { return r >= '0' && r <= '9' }
+	isUpper := func(r rune) bool { return r >= 'A' && r <= 'Z' }
+	isLower := func(r rune) bool { return r >= 'a' && r <= 'z' }
+	return (isLower(prev) && isUpper(c)) || isDigit(prev) != isDigit(c)
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, c := range s {
+		counts[c]++
+	}
+	var bits float64
+	n := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / n
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
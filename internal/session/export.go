@@ -0,0 +1,238 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	FormatMarkdown = "md"
+	FormatJSON     = "json"
+	FormatHTML     = "html"
+)
+
+// Formats lists the supported export formats
+var Formats = []string{FormatMarkdown, FormatJSON, FormatHTML}
+
+// timeFormat is how timestamps are shown in Markdown and HTML exports
+const timeFormat = "2006-01-02 15:04:05"
+
+// FormatFromPath returns the export format implied by a file extension,
+// defaulting to Markdown
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".html", ".htm":
+		return FormatHTML
+	default:
+		return FormatMarkdown
+	}
+}
+
+// Export writes the session to w in the given format
+func Export(w io.Writer, s *Session, format string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch format {
+	case FormatMarkdown, "markdown":
+		return exportMarkdown(w, s)
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(s)
+	case FormatHTML:
+		return exportHTML(w, s)
+	default:
+		return fmt.Errorf("unknown export format %q (available: %v)", format, Formats)
+	}
+}
+
+// exportMarkdown writes the session as a Markdown document
+func exportMarkdown(w io.Writer, s *Session) error {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# Tama session %s\n\n", s.ID)
+	fmt.Fprintf(&sb, "- **Started:** %s\n", s.Created.Format(timeFormat))
+	fmt.Fprintf(&sb, "- **Provider:** %s\n", s.Provider)
+	fmt.Fprintf(&sb, "- **Model:** %s\n", s.Model)
+	if s.Workspace != "" {
+		fmt.Fprintf(&sb, "- **Workspace:** `%s`\n", s.Workspace)
+	}
+	if s.Goal != "" {
+		fmt.Fprintf(&sb, "- **Goal:** %s\n", s.Goal)
+	}
+
+	for _, entry := range s.Entries {
+		fmt.Fprintf(&sb, "\n## %s · %s\n\n", entryTitle(entry), entry.Time.Format(timeFormat))
+		switch entry.Role {
+		case RoleTool:
+			sb.WriteString("Arguments:\n\n")
+			sb.WriteString(fence(formatArgs(entry.Args), "json"))
+			sb.WriteString("\nResult:\n\n")
+			sb.WriteString(fence(entry.Result, "text"))
+		case RoleDiff:
+			if entry.Content != "" {
+				sb.WriteString(fence(entry.Content, "diff"))
+			} else {
+				sb.WriteString("_No changes._\n")
+			}
+		case RoleSystem:
+			sb.WriteString(fence(entry.Content, "text"))
+		default:
+			sb.WriteString(strings.TrimSpace(entry.Content))
+			sb.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// entryTitle returns the heading of an entry
+func entryTitle(entry Entry) string {
+	switch entry.Role {
+	case RoleSystem:
+		return "System"
+	case RoleUser:
+		return "User"
+	case RoleAssistant:
+		if entry.Model != "" {
+			return fmt.Sprintf("Assistant (%s)", entry.Model)
+		}
+		return "Assistant"
+	case RoleTool:
+		return fmt.Sprintf("Tool call: %s", entry.Tool)
+	case RoleDiff:
+		if entry.Content == "" {
+			return "Changes applied"
+		}
+		return "Diff applied"
+	default:
+		return entry.Role
+	}
+}
+
+// fence wraps content in a fenced code block longer than any fence inside it
+func fence(content, lang string) string {
+	marker := "```"
+	for strings.Contains(content, marker) {
+		marker += "`"
+	}
+	return fmt.Sprintf("%s%s\n%s\n%s\n", marker, lang, strings.TrimRight(content, "\n"), marker)
+}
+
+// formatArgs formats tool arguments as indented JSON with sorted keys
+func formatArgs(args map[string]interface{}) string {
+	if len(args) == 0 {
+		return "{}"
+	}
+	data, err := json.MarshalIndent(args, "", "  ")
+	if err != nil {
+		keys := make([]string, 0, len(args))
+		for key := range args {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return strings.Join(keys, ", ")
+	}
+	return string(data)
+}
+
+// htmlTemplate renders a session as a standalone HTML page
+var htmlTemplate = template.Must(template.New("session").Funcs(template.FuncMap{
+	"title":   entryTitle,
+	"time":    func(t time.Time) string { return t.Format(timeFormat) },
+	"args":    formatArgs,
+	"diffRow": diffRowClass,
+	"lines":   func(s string) []string { return strings.Split(strings.TrimRight(s, "\n"), "\n") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Tama session {{.ID}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #1f2328; }
+header dl { display: grid; grid-template-columns: max-content auto; gap: .25em 1em; }
+header dt { font-weight: bold; }
+section { border: 1px solid #d0d7de; border-radius: 6px; margin: 1em 0; padding: .5em 1em; }
+section h2 { font-size: 1em; margin: .5em 0; }
+section h2 time { font-weight: normal; color: #656d76; margin-left: .5em; }
+section.user { background: #f6f8fa; }
+section.tool, section.system { border-style: dashed; }
+pre { background: #f6f8fa; padding: .75em; overflow-x: auto; white-space: pre-wrap; }
+.message { white-space: pre-wrap; }
+.add { color: #1a7f37; }
+.del { color: #cf222e; }
+.hunk { color: #8250df; }
+</style>
+</head>
+<body>
+<header>
+<h1>Tama session {{.ID}}</h1>
+<dl>
+<dt>Started</dt><dd>{{time .Created}}</dd>
+<dt>Provider</dt><dd>{{.Provider}}</dd>
+<dt>Model</dt><dd>{{.Model}}</dd>
+{{- if .Workspace}}
+<dt>Workspace</dt><dd><code>{{.Workspace}}</code></dd>
+{{- end}}
+{{- if .Goal}}
+<dt>Goal</dt><dd>{{.Goal}}</dd>
+{{- end}}
+</dl>
+</header>
+{{- range .Entries}}
+<section class="{{.Role}}">
+<h2>{{title .}}<time>{{time .Time}}</time></h2>
+{{- if eq .Role "tool"}}
+<p>Arguments:</p>
+<pre>{{args .Args}}</pre>
+<p>Result:</p>
+<pre>{{.Result}}</pre>
+{{- else if eq .Role "diff"}}
+{{- if .Content}}
+<pre>{{range lines .Content}}<span class="{{diffRow .}}">{{.}}</span>
+{{end}}</pre>
+{{- else}}
+<p><em>No changes.</em></p>
+{{- end}}
+{{- else if eq .Role "system"}}
+<details><summary>System prompt</summary><pre>{{.Content}}</pre></details>
+{{- else}}
+<div class="message">{{.Content}}</div>
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+// exportHTML writes the session as a standalone HTML page
+func exportHTML(w io.Writer, s *Session) error {
+	return htmlTemplate.Execute(w, s)
+}
+
+// diffRowClass returns the CSS class of a diff line
+func diffRowClass(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		return ""
+	case strings.HasPrefix(line, "+"):
+		return "add"
+	case strings.HasPrefix(line, "-"):
+		return "del"
+	case strings.HasPrefix(line, "@@"):
+		return "hunk"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,240 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+	RoleDiff      = "diff"
+)
+
+// Entry is one item of a session transcript
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Role    string                 `json:"role"`
+	Content string                 `json:"content"`
+	Model   string                 `json:"model,omitempty"`  // Model that produced an assistant entry
+	Tool    string                 `json:"tool,omitempty"`   // Tool name of a tool entry
+	Args    map[string]interface{} `json:"args,omitempty"`   // Tool arguments of a tool entry
+	Result  string                 `json:"result,omitempty"` // Tool result of a tool entry
+}
+
+// Session is the transcript of a chat or agent session
+type Session struct {
+	ID        string    `json:"id"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	Provider  string    `json:"provider"`
+	Model     string    `json:"model"`
+	Workspace string    `json:"workspace,omitempty"`
+	Goal      string    `json:"goal,omitempty"` // Agent goal, if any
+	Entries   []Entry   `json:"entries"`
+
+	mu sync.Mutex
+}
+
+// New creates an empty session
+func New(provider, model, workspace string) *Session {
+	now := time.Now()
+	return &Session{
+		ID:        newID(now),
+		Created:   now,
+		Updated:   now,
+		Provider:  provider,
+		Model:     model,
+		Workspace: workspace,
+		Entries:   make([]Entry, 0),
+	}
+}
+
+// newID returns a sortable session ID with a random suffix
+func newID(t time.Time) string {
+	suffix := make([]byte, 2)
+	rand.Read(suffix)
+	return t.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// Add appends an entry, stamping it with the current time if it has none
+func (s *Session) Add(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Content = StripANSI(entry.Content)
+	entry.Result = StripANSI(entry.Result)
+	s.Entries = append(s.Entries, entry)
+	s.Updated = entry.Time
+}
+
+// SetGoal records the agent goal of the session
+func (s *Session) SetGoal(goal string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Goal = goal
+}
+
+// LastContent returns the content of the most recent entry with the given role
+func (s *Session) LastContent(role string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.Entries) - 1; i >= 0; i-- {
+		if s.Entries[i].Role == role {
+			return s.Entries[i].Content
+		}
+	}
+	return ""
+}
+
+// Empty reports whether the session has no user messages yet
+func (s *Session) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.Entries {
+		if entry.Role == RoleUser {
+			return false
+		}
+	}
+	return true
+}
+
+// Title returns the first line of the first user message
+func (s *Session) Title() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Goal != "" {
+		return s.Goal
+	}
+	for _, entry := range s.Entries {
+		if entry.Role == RoleUser {
+			title := strings.TrimSpace(strings.SplitN(strings.TrimSpace(entry.Content), "\n", 2)[0])
+			if len(title) > 60 {
+				title = title[:57] + "..."
+			}
+			return title
+		}
+	}
+	return ""
+}
+
+// Save writes the session to the sessions directory
+func (s *Session) Save() error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create sessions directory: %v", err)
+	}
+
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %v", err)
+	}
+
+	// Transcripts may contain secrets from files or tool output
+	path := filepath.Join(dir, s.ID+".json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write session: %v", err)
+	}
+	return nil
+}
+
+// Dir returns the directory sessions are saved in
+func Dir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".config", "tama", "sessions"), nil
+}
+
+// Load reads the session with the given ID. A unique prefix of an ID is accepted.
+func Load(id string) (*Session, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, id+".json")
+	if _, err := os.Stat(path); err != nil {
+		matches, _ := filepath.Glob(filepath.Join(dir, id+"*.json"))
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("session %s not found", id)
+		case 1:
+			path = matches[0]
+		default:
+			return nil, fmt.Errorf("session ID %s is ambiguous (%d matches)", id, len(matches))
+		}
+	}
+	return loadFile(path)
+}
+
+// loadFile reads a session file
+func loadFile(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %v", err)
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %v", filepath.Base(path), err)
+	}
+	return &s, nil
+}
+
+// List returns all saved sessions, most recent first
+func List() ([]*Session, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %v", err)
+	}
+
+	sessions := make([]*Session, 0, len(paths))
+	for _, path := range paths {
+		s, err := loadFile(path)
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Updated.After(sessions[j].Updated)
+	})
+	return sessions, nil
+}
+
+// ansiPattern matches terminal escape sequences
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// StripANSI removes terminal escape sequences, such as the colors of a git diff
+func StripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
@@ -0,0 +1,292 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/warm3snow/tama/internal/workspace"
+)
+
+// readArgs are the arguments of the read operation
+type readArgs struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	MaxBytes  int    `json:"max_bytes"`
+}
+
+// lineEditArgs are the arguments of insert_at_line, replace_lines and append
+type lineEditArgs struct {
+	Path      string  `json:"path"`
+	Line      int     `json:"line"`
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Content   *string `json:"content"`
+}
+
+// replaceTextArgs are the arguments of the replace_text operation
+type replaceTextArgs struct {
+	Path    string  `json:"path"`
+	OldText string  `json:"old_text"`
+	NewText *string `json:"new_text"`
+}
+
+// editResult reports which lines of a file an edit produced
+type editResult struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"` // First line of the new content
+	EndLine   int    `json:"end_line"`   // Last line of the new content, before start_line if it was empty
+	Lines     int    `json:"lines"`      // Lines in the file after the edit
+}
+
+// numberedLines returns lines start to end of content, counted from 1, each
+// prefixed with its number. end 0 means the end of the file.
+func numberedLines(content string, start, end, maxBytes int) (string, error) {
+	lines := splitLines(content)
+	if start < 1 {
+		start = 1
+	}
+	if end == 0 || end > len(lines) {
+		end = len(lines)
+	}
+	if start > len(lines) {
+		return "", fmt.Errorf("start_line %d is past the end of the file (%d lines)", start, len(lines))
+	}
+	if end < start {
+		return "", fmt.Errorf("end_line %d is before start_line %d", end, start)
+	}
+
+	var sb strings.Builder
+	width := len(strconv.Itoa(end))
+	last := start - 1
+	for i := start; i <= end; i++ {
+		line := fmt.Sprintf("%*d\t%s\n", width, i, lines[i-1])
+		if maxBytes > 0 && sb.Len()+len(line) > maxBytes && last >= start {
+			break
+		}
+		sb.WriteString(line)
+		last = i
+	}
+
+	fmt.Fprintf(&sb, "(lines %d-%d of %d", start, last, len(lines))
+	if last < end {
+		fmt.Fprintf(&sb, ", truncated at %d bytes", maxBytes)
+	}
+	sb.WriteString(")\n")
+	return sb.String(), nil
+}
+
+// truncateContent cuts content to at most maxBytes, at a line boundary where
+// possible, and notes how to read the rest
+func truncateContent(content string, maxBytes int) string {
+	// Without a newline to cut at, back up to the start of a character
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(content[end]) {
+		end--
+	}
+	cut := content[:end]
+	if i := strings.LastIndex(cut, "\n"); i > 0 {
+		cut = cut[:i+1]
+	} else {
+		cut += "\n"
+	}
+	shown := len(splitLines(cut))
+	return fmt.Sprintf("%s... truncated at %d of %d bytes; read from start_line %d to see more\n",
+		cut, len(cut), len(content), shown+1)
+}
+
+// insertAtLine inserts content before line, counted from 1; the line after
+// the last one appends
+func (t *FileSystemTool) insertAtLine(args map[string]interface{}) (string, error) {
+	var a lineEditArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Content == nil {
+		return "", fmt.Errorf("content not specified")
+	}
+
+	return t.editLines(a.Path, false, func(lines []string) ([]string, int, int, error) {
+		if a.Line < 1 || a.Line > len(lines)+1 {
+			return nil, 0, 0, fmt.Errorf("line %d is out of range, the file has %d lines", a.Line, len(lines))
+		}
+		inserted := splitLines(*a.Content)
+		result := append(append(append([]string{}, lines[:a.Line-1]...), inserted...), lines[a.Line-1:]...)
+		return result, a.Line, a.Line + len(inserted) - 1, nil
+	})
+}
+
+// replaceLines replaces lines start_line to end_line, counted from 1, with
+// content. Empty content deletes the lines.
+func (t *FileSystemTool) replaceLines(args map[string]interface{}) (string, error) {
+	var a lineEditArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Content == nil {
+		return "", fmt.Errorf("content not specified")
+	}
+	if a.EndLine == 0 {
+		a.EndLine = a.StartLine
+	}
+
+	return t.editLines(a.Path, false, func(lines []string) ([]string, int, int, error) {
+		if a.StartLine < 1 || a.EndLine > len(lines) {
+			return nil, 0, 0, fmt.Errorf("lines %d-%d are out of range, the file has %d lines", a.StartLine, a.EndLine, len(lines))
+		}
+		if a.EndLine < a.StartLine {
+			return nil, 0, 0, fmt.Errorf("end_line %d is before start_line %d", a.EndLine, a.StartLine)
+		}
+		replacement := splitLines(*a.Content)
+		result := append(append(append([]string{}, lines[:a.StartLine-1]...), replacement...), lines[a.EndLine:]...)
+		return result, a.StartLine, a.StartLine + len(replacement) - 1, nil
+	})
+}
+
+// appendFile adds content to the end of a file, creating it if needed
+func (t *FileSystemTool) appendFile(args map[string]interface{}) (string, error) {
+	var a lineEditArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Content == nil {
+		return "", fmt.Errorf("content not specified")
+	}
+
+	return t.editLines(a.Path, true, func(lines []string) ([]string, int, int, error) {
+		appended := splitLines(*a.Content)
+		return append(lines, appended...), len(lines) + 1, len(lines) + len(appended), nil
+	})
+}
+
+// replaceText replaces old_text with new_text. old_text must occur exactly
+// once so the edit cannot land in the wrong place.
+func (t *FileSystemTool) replaceText(args map[string]interface{}) (string, error) {
+	var a replaceTextArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.OldText == "" {
+		return "", fmt.Errorf("old_text not specified")
+	}
+	if a.NewText == nil {
+		return "", fmt.Errorf("new_text not specified")
+	}
+
+	fullPath, content, mode, err := t.readForEdit(a.Path, false)
+	if err != nil {
+		return "", err
+	}
+
+	switch n := strings.Count(content, a.OldText); n {
+	case 0:
+		return "", fmt.Errorf("old_text not found in %s", a.Path)
+	case 1:
+	default:
+		return "", fmt.Errorf("old_text occurs %d times in %s; include more surrounding text to make it unique", n, a.Path)
+	}
+
+	offset := strings.Index(content, a.OldText)
+	updated := content[:offset] + *a.NewText + content[offset+len(a.OldText):]
+	if err := t.writeEdit(fullPath, updated, mode); err != nil {
+		return "", err
+	}
+
+	start := strings.Count(content[:offset], "\n") + 1
+	return encodeResult(editResult{
+		Path:      a.Path,
+		StartLine: start,
+		EndLine:   start + strings.Count(*a.NewText, "\n"),
+		Lines:     len(splitLines(updated)),
+	})
+}
+
+// editLines applies a line-based edit to a file. edit returns the new lines
+// and the range the new content occupies. The file keeps its line endings,
+// CRLF or LF, and a last line without a newline stays without one.
+func (t *FileSystemTool) editLines(path string, create bool, edit func(lines []string) ([]string, int, int, error)) (string, error) {
+	fullPath, content, mode, err := t.readForEdit(path, create)
+	if err != nil {
+		return "", err
+	}
+
+	newline := "\n"
+	if strings.Contains(content, "\r\n") {
+		newline = "\r\n"
+	}
+	finalNewline := content == "" || strings.HasSuffix(content, "\n")
+
+	lines, start, end, err := edit(splitLines(strings.ReplaceAll(content, "\r\n", "\n")))
+	if err != nil {
+		return "", err
+	}
+
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	updated := strings.Join(lines, newline)
+	if len(lines) > 0 && finalNewline {
+		updated += newline
+	}
+	if err := t.writeEdit(fullPath, updated, mode); err != nil {
+		return "", err
+	}
+
+	return encodeResult(editResult{Path: path, StartLine: start, EndLine: end, Lines: len(lines)})
+}
+
+// readForEdit resolves and reads a file to be edited. A missing file reads
+// as empty if create is set.
+func (t *FileSystemTool) readForEdit(path string, create bool) (string, string, os.FileMode, error) {
+	if path == "" {
+		return "", "", 0, fmt.Errorf("path not specified")
+	}
+	fullPath, err := t.resolver.Resolve(path)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) && create {
+		return fullPath, "", 0644, nil
+	}
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to read file: %v", err)
+	}
+	if info.IsDir() {
+		return "", "", 0, fmt.Errorf("%s is a directory", path)
+	}
+
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to read file: %v", err)
+	}
+	return fullPath, string(content), info.Mode().Perm(), nil
+}
+
+// writeEdit atomically writes edited content, keeping the file mode, and
+// updates the open file cache
+func (t *FileSystemTool) writeEdit(fullPath, content string, mode os.FileMode) error {
+	if err := workspace.WriteFileAtomic(fullPath, []byte(content), mode); err != nil {
+		return err
+	}
+	t.cacheFile(fullPath, content)
+	return nil
+}
+
+// cacheFile records written content in the workspace's open file cache
+func (t *FileSystemTool) cacheFile(fullPath, content string) {
+	if t.files != nil {
+		t.files.UpdateFile(t.resolver.Rel(fullPath), []byte(content))
+	}
+}
+
+// forgetFile drops a deleted or moved file from the open file cache
+func (t *FileSystemTool) forgetFile(fullPath string) {
+	if t.files != nil {
+		t.files.ForgetFile(t.resolver.Rel(fullPath))
+	}
+}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warm3snow/tama/internal/workspace"
+)
+
+func TestLineEditsKeepLineEndings(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		args    map[string]interface{}
+		want    string
+	}{
+		{
+			name:    "replace in crlf file",
+			content: "a\r\nb\r\nc\r\n",
+			args:    map[string]interface{}{"operation": "replace_lines", "start_line": 2, "content": "B\n"},
+			want:    "a\r\nB\r\nc\r\n",
+		},
+		{
+			name:    "insert crlf content into lf file",
+			content: "a\nc\n",
+			args:    map[string]interface{}{"operation": "insert_at_line", "line": 2, "content": "b\r\n"},
+			want:    "a\nb\nc\n",
+		},
+		{
+			name:    "no final newline",
+			content: "a\nb",
+			args:    map[string]interface{}{"operation": "replace_lines", "start_line": 1, "content": "A"},
+			want:    "A\nb",
+		},
+		{
+			name:    "append to crlf file without final newline",
+			content: "a\r\nb",
+			args:    map[string]interface{}{"operation": "append", "content": "c\n"},
+			want:    "a\r\nb\r\nc",
+		},
+		{
+			name: "append to new file",
+			args: map[string]interface{}{"operation": "append", "content": "a"},
+			want: "a\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			path := filepath.Join(root, "f.txt")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tool := NewFileSystemTool(workspace.NewResolver(root), nil)
+			tt.args["path"] = "f.txt"
+			if _, err := tool.Execute(context.Background(), tt.args); err != nil {
+				t.Fatalf("%s: %v", tt.args["operation"], err)
+			}
+			got, _ := os.ReadFile(path)
+			if string(got) != tt.want {
+				t.Errorf("file = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/warm3snow/tama/internal/ignore"
+)
+
+// defaultListLimit caps the entries returned by list and glob
+const defaultListLimit = 1000
+
+// FileInfo describes a file in list, stat and glob results
+type FileInfo struct {
+	Path    string    `json:"path"`
+	Type    string    `json:"type"` // "file", "dir" or "symlink"
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// listArgs are the arguments of the list operation
+type listArgs struct {
+	Path          string `json:"path"`
+	Recursive     bool   `json:"recursive"`
+	MaxDepth      int    `json:"max_depth"`
+	IncludeHidden bool   `json:"include_hidden"`
+	Limit         int    `json:"limit"`
+}
+
+// listResult is the result of the list operation
+type listResult struct {
+	Path      string     `json:"path"`
+	Entries   []FileInfo `json:"entries"`
+	Truncated bool       `json:"truncated"`
+}
+
+// pathArgs are the arguments of operations on a single path
+type pathArgs struct {
+	Path      string `json:"path"`
+	Recursive bool   `json:"recursive"`
+}
+
+// moveArgs are the arguments of the move operation
+type moveArgs struct {
+	Path      string `json:"path"`
+	NewPath   string `json:"new_path"`
+	Overwrite bool   `json:"overwrite"`
+}
+
+// globArgs are the arguments of the glob operation
+type globArgs struct {
+	Pattern string `json:"pattern"`
+	Limit   int    `json:"limit"`
+}
+
+// globResult is the result of the glob operation
+type globResult struct {
+	Pattern   string     `json:"pattern"`
+	Matches   []FileInfo `json:"matches"`
+	Truncated bool       `json:"truncated"`
+}
+
+// decodeArgs decodes tool arguments into a typed struct, reporting
+// arguments of the wrong type
+func decodeArgs(args map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			return fmt.Errorf("argument %s must be a %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// encodeResult formats a structured result as indented JSON
+func encodeResult(v interface{}) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode result: %v", err)
+	}
+	return string(data), nil
+}
+
+// fileInfo describes a file at a workspace-relative path
+func fileInfo(rel string, info os.FileInfo) FileInfo {
+	kind := "file"
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		kind = "symlink"
+	case info.IsDir():
+		kind = "dir"
+	}
+	return FileInfo{
+		Path:    filepath.ToSlash(rel),
+		Type:    kind,
+		Size:    info.Size(),
+		Mode:    info.Mode().Perm().String(),
+		ModTime: info.ModTime(),
+	}
+}
+
+// list lists a directory, skipping ignored and hidden files
+func (t *FileSystemTool) list(args map[string]interface{}) (string, error) {
+	a := listArgs{Path: ".", Limit: defaultListLimit}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Path == "" {
+		a.Path = "."
+	}
+
+	dir, err := t.resolver.ResolveRead(a.Path)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("failed to list %s: %v", a.Path, err)
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", a.Path)
+	}
+
+	// Directories in read-only roots are listed with absolute paths
+	root := t.workspacePath
+	if !t.resolver.Contains(dir) {
+		root = dir
+	}
+
+	result := listResult{Path: a.Path, Entries: make([]FileInfo, 0)}
+	startDepth := depth(relPath(root, dir))
+
+	err = ignore.Walk(root, dir, ignore.New(), func(rel string, d fs.DirEntry) error {
+		if !a.IncludeHidden && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if t.resolver.Protected(filepath.Join(root, filepath.FromSlash(rel))) != nil {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		level := depth(rel) - startDepth
+		if (!a.Recursive && level > 1) || (a.MaxDepth > 0 && level > a.MaxDepth) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if len(result.Entries) >= a.Limit {
+			result.Truncated = true
+			return filepath.SkipAll
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if root != t.workspacePath {
+			rel = filepath.Join(root, rel)
+		}
+		result.Entries = append(result.Entries, fileInfo(rel, info))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list %s: %v", a.Path, err)
+	}
+
+	return encodeResult(result)
+}
+
+// mkdir creates a directory and any missing parents
+func (t *FileSystemTool) mkdir(args map[string]interface{}) (string, error) {
+	var a pathArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Path == "" {
+		return "", fmt.Errorf("path not specified")
+	}
+
+	fullPath, err := t.resolver.Resolve(a.Path)
+	if err != nil {
+		return "", err
+	}
+	_, statErr := os.Stat(fullPath)
+	if err := os.MkdirAll(fullPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	return encodeResult(map[string]interface{}{
+		"path":    a.Path,
+		"created": os.IsNotExist(statErr),
+	})
+}
+
+// delete deletes a file, or a directory if recursive is set, after backing
+// up every file in it so it can be restored
+func (t *FileSystemTool) delete(args map[string]interface{}) (string, error) {
+	var a pathArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Path == "" {
+		return "", fmt.Errorf("path not specified")
+	}
+
+	fullPath, err := t.resolver.Resolve(a.Path)
+	if err != nil {
+		return "", err
+	}
+	if fullPath == t.workspacePath {
+		return "", fmt.Errorf("refusing to delete the workspace root")
+	}
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete %s: %v", a.Path, err)
+	}
+	if info.IsDir() && !a.Recursive {
+		return "", fmt.Errorf("%s is a directory; set recursive to delete it", a.Path)
+	}
+	if err := t.protectedWithin(fullPath); err != nil {
+		return "", err
+	}
+
+	taskID, _ := args["task_id"].(string)
+	backups := []string{}
+	err = filepath.WalkDir(fullPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		entry, err := t.backups.Save(t.resolver.Rel(path), content, info.Mode(), taskID)
+		if err != nil {
+			return err
+		}
+		backups = append(backups, entry.ID)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to back up %s: %v", a.Path, err)
+	}
+	if err := os.RemoveAll(fullPath); err != nil {
+		return "", fmt.Errorf("failed to delete %s: %v", a.Path, err)
+	}
+	t.forgetFile(fullPath)
+
+	return encodeResult(map[string]interface{}{
+		"path":    a.Path,
+		"deleted": true,
+		"backups": backups,
+	})
+}
+
+// move moves or renames a file or directory
+func (t *FileSystemTool) move(args map[string]interface{}) (string, error) {
+	var a moveArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Path == "" || a.NewPath == "" {
+		return "", fmt.Errorf("path and new_path must be specified")
+	}
+
+	src, err := t.resolver.Resolve(a.Path)
+	if err != nil {
+		return "", err
+	}
+	dst, err := t.resolver.Resolve(a.NewPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(src); err != nil {
+		return "", fmt.Errorf("failed to move %s: %v", a.Path, err)
+	}
+	if err := t.protectedWithin(src); err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(dst); err == nil && !a.Overwrite {
+		return "", fmt.Errorf("%s already exists; set overwrite to replace it", a.NewPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return "", fmt.Errorf("failed to move %s to %s: %v", a.Path, a.NewPath, err)
+	}
+	t.forgetFile(src)
+
+	return encodeResult(map[string]interface{}{
+		"path":     a.Path,
+		"new_path": a.NewPath,
+	})
+}
+
+// stat describes a file, reporting exists: false if it is missing
+func (t *FileSystemTool) stat(args map[string]interface{}) (string, error) {
+	var a pathArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Path == "" {
+		return "", fmt.Errorf("path not specified")
+	}
+
+	fullPath, err := t.resolver.ResolveRead(a.Path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		return encodeResult(map[string]interface{}{"path": a.Path, "exists": false})
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %v", a.Path, err)
+	}
+
+	return encodeResult(struct {
+		FileInfo
+		Exists bool `json:"exists"`
+	}{fileInfo(a.Path, info), true})
+}
+
+// glob finds files matching a pattern, where ** matches any number of
+// directories. Ignored files are skipped.
+func (t *FileSystemTool) glob(args map[string]interface{}) (string, error) {
+	a := globArgs{Limit: defaultListLimit}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Pattern == "" {
+		return "", fmt.Errorf("pattern not specified")
+	}
+
+	result := globResult{Pattern: a.Pattern, Matches: make([]FileInfo, 0)}
+	err := ignore.Walk(t.workspacePath, t.workspacePath, ignore.New(), func(rel string, d fs.DirEntry) error {
+		if !ignore.Glob(a.Pattern, rel) {
+			return nil
+		}
+		if t.resolver.Protected(filepath.Join(t.workspacePath, filepath.FromSlash(rel))) != nil {
+			return nil
+		}
+		if len(result.Matches) >= a.Limit {
+			result.Truncated = true
+			return filepath.SkipAll
+		}
+		if info, err := d.Info(); err == nil {
+			result.Matches = append(result.Matches, fileInfo(rel, info))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to search for %s: %v", a.Pattern, err)
+	}
+
+	return encodeResult(result)
+}
+
+// protectedWithin returns the error for the first protected path inside a
+// directory, so deleting or moving it cannot carry protected files along
+func (t *FileSystemTool) protectedWithin(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		return t.resolver.Protected(path)
+	})
+}
+
+// relPath returns path relative to root, or path itself if it is not inside root
+func relPath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// depth returns the number of segments of a slash-separated relative path
+func depth(rel string) int {
+	if rel == "" || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, "/") + 1
+}
@@ -5,22 +5,28 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
-	"time"
+
+	"github.com/warm3snow/tama/internal/backup"
+	"github.com/warm3snow/tama/internal/workspace"
 )
 
 // FileSystemTool provides file system operations
 type FileSystemTool struct {
 	workspacePath string
-	backupPath    string
+	backups       *backup.Store
+	resolver      *workspace.Resolver
+	files         *workspace.Manager // Open file cache kept in sync with edits, may be nil
 }
 
-// NewFileSystemTool creates a new file system tool
-func NewFileSystemTool(workspacePath string) *FileSystemTool {
-	backupPath := filepath.Join(workspacePath, ".tama", "backups")
+// NewFileSystemTool creates a new file system tool confined to the
+// resolver's workspace. Writes are reported to files if it is not nil.
+func NewFileSystemTool(resolver *workspace.Resolver, files *workspace.Manager) *FileSystemTool {
+	workspacePath := resolver.Root()
 	return &FileSystemTool{
 		workspacePath: workspacePath,
-		backupPath:    backupPath,
+		backups:       backup.Open(workspacePath),
+		resolver:      resolver,
+		files:         files,
 	}
 }
 
@@ -39,6 +45,26 @@ func (t *FileSystemTool) Execute(ctx context.Context, args map[string]interface{
 		return t.createBackup(args)
 	case "restore":
 		return t.restoreBackup(args)
+	case "list":
+		return t.list(args)
+	case "mkdir":
+		return t.mkdir(args)
+	case "delete":
+		return t.delete(args)
+	case "move", "rename":
+		return t.move(args)
+	case "stat":
+		return t.stat(args)
+	case "glob":
+		return t.glob(args)
+	case "insert_at_line":
+		return t.insertAtLine(args)
+	case "replace_lines":
+		return t.replaceLines(args)
+	case "append":
+		return t.appendFile(args)
+	case "replace_text":
+		return t.replaceText(args)
 	default:
 		return "", fmt.Errorf("unknown operation: %s", operation)
 	}
@@ -55,104 +81,141 @@ func (t *FileSystemTool) writeFile(args map[string]interface{}) (string, error)
 		return "", fmt.Errorf("content not specified")
 	}
 
-	fullPath := filepath.Join(t.workspacePath, path)
-
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-		return "", fmt.Errorf("failed to create directory: %v", err)
+	fullPath, err := t.resolver.Resolve(path)
+	if err != nil {
+		return "", err
 	}
 
-	// Write file
-	if err := ioutil.WriteFile(fullPath, []byte(content), 0644); err != nil {
-		return "", fmt.Errorf("failed to write file: %v", err)
+	// Replace the file atomically, keeping its mode
+	if err := workspace.WriteFileAtomic(fullPath, []byte(content), 0644); err != nil {
+		return "", err
 	}
+	t.cacheFile(fullPath, content)
 
 	return fmt.Sprintf("Successfully wrote %d bytes to %s", len(content), path), nil
 }
 
+// readFile returns the content of a file. With start_line or end_line only
+// that range is returned, with line numbers; max_bytes caps the output.
 func (t *FileSystemTool) readFile(args map[string]interface{}) (string, error) {
-	path, ok := args["path"].(string)
-	if !ok {
+	var a readArgs
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Path == "" {
 		return "", fmt.Errorf("path not specified")
 	}
 
-	fullPath := filepath.Join(t.workspacePath, path)
+	fullPath, err := t.resolver.ResolveRead(a.Path)
+	if err != nil {
+		return "", err
+	}
 	content, err := ioutil.ReadFile(fullPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %v", err)
 	}
 
-	return string(content), nil
+	if a.StartLine == 0 && a.EndLine == 0 {
+		if a.MaxBytes > 0 && len(content) > a.MaxBytes {
+			return truncateContent(string(content), a.MaxBytes), nil
+		}
+		return string(content), nil
+	}
+	return numberedLines(string(content), a.StartLine, a.EndLine, a.MaxBytes)
 }
 
+// createBackup stores the current content of a file in the backup store
 func (t *FileSystemTool) createBackup(args map[string]interface{}) (string, error) {
 	path, ok := args["path"].(string)
 	if !ok {
 		return "", fmt.Errorf("path not specified")
 	}
+	taskID, _ := args["task_id"].(string)
 
-	// Create backup directory with timestamp
-	timestamp := time.Now().Format("20060102_150405")
-	backupDir := filepath.Join(t.backupPath, timestamp)
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	fullPath, err := t.resolver.Resolve(path)
+	if err != nil {
+		return "", err
 	}
-
-	// Copy file to backup
-	srcPath := filepath.Join(t.workspacePath, path)
-	dstPath := filepath.Join(backupDir, path)
-
-	// Create destination directory
-	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-		return "", fmt.Errorf("failed to create backup subdirectory: %v", err)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read source file: %v", err)
 	}
-
-	// Read source file
-	content, err := ioutil.ReadFile(srcPath)
+	content, err := os.ReadFile(fullPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read source file: %v", err)
 	}
 
-	// Write to backup
-	if err := ioutil.WriteFile(dstPath, content, 0644); err != nil {
-		return "", fmt.Errorf("failed to write backup file: %v", err)
+	entry, err := t.backups.Save(t.resolver.Rel(fullPath), content, info.Mode(), taskID)
+	if err != nil {
+		return "", err
 	}
-
-	return dstPath, nil
+	return encodeResult(entry)
 }
 
+// restoreBackup restores a backup, given by backup_id or as the latest
+// backup of path, after checking its hash
 func (t *FileSystemTool) restoreBackup(args map[string]interface{}) (string, error) {
-	path, ok := args["path"].(string)
-	if !ok {
-		return "", fmt.Errorf("path not specified")
+	path, _ := args["path"].(string)
+	ref, _ := args["backup_id"].(string)
+	if ref == "" {
+		ref = path
 	}
-
-	backupPath, ok := args["backup_path"].(string)
-	if !ok {
-		return "", fmt.Errorf("backup_path not specified")
+	if ref == "" {
+		return "", fmt.Errorf("backup_id or path must be specified")
 	}
 
-	// Read backup file
-	content, err := ioutil.ReadFile(backupPath)
+	entry, err := t.backups.Find(ref)
 	if err != nil {
-		return "", fmt.Errorf("failed to read backup file: %v", err)
+		return "", err
+	}
+	if path == "" {
+		path = entry.Path
 	}
 
-	// Restore to original location
-	destPath := filepath.Join(t.workspacePath, path)
-	if err := ioutil.WriteFile(destPath, content, 0644); err != nil {
-		return "", fmt.Errorf("failed to restore file: %v", err)
+	destPath, err := t.resolver.Resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if err := t.backups.Restore(entry, t.resolver.Rel(destPath)); err != nil {
+		return "", err
+	}
+	if content, err := t.backups.Read(entry); err == nil {
+		t.cacheFile(destPath, string(content))
 	}
 
-	return fmt.Sprintf("Successfully restored %s from backup", path), nil
+	return fmt.Sprintf("Successfully restored %s from backup %s", path, entry.ID), nil
 }
 
 // Description returns the tool description
 func (t *FileSystemTool) Description() string {
-	return "Provides file system operations (read, write, backup, restore)"
+	return "Provides file system operations: read (path, start_line, end_line, max_bytes; " +
+		"a line range is returned with line numbers), write, backup (path, task_id), " +
+		"restore (backup_id or path; the content hash is verified), " +
+		"insert_at_line (path, line, content), replace_lines (path, start_line, end_line, content), " +
+		"append (path, content), replace_text (path, old_text, new_text; old_text must be unique), " +
+		"list (path, recursive, max_depth, include_hidden, limit), mkdir (path), " +
+		"delete (path, recursive, task_id; files are backed up first), move (path, new_path, overwrite), " +
+		"stat (path) and glob (pattern, limit; ** matches directories). " +
+		"list, stat and glob return JSON"
 }
 
 // Name returns the tool name
 func (t *FileSystemTool) Name() string {
 	return "filesystem"
 }
+
+// Describe describes a call by its operation and paths
+func (t *FileSystemTool) Describe(args map[string]interface{}) Invocation {
+	operation, _ := args["operation"].(string)
+	subject := operation
+	for _, key := range []string{"path", "new_path", "pattern"} {
+		if value, _ := args[key].(string); value != "" {
+			subject += " " + value
+		}
+	}
+	switch operation {
+	case "read", "list", "stat", "glob":
+		return Invocation{Subject: subject, ReadOnly: true}
+	}
+	return Invocation{Subject: subject}
+}
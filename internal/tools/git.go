@@ -6,18 +6,30 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/warm3snow/tama/internal/ignore"
+	"github.com/warm3snow/tama/internal/ui"
+	"github.com/warm3snow/tama/internal/workspace"
 )
 
 // GitTool implements git operations
 type GitTool struct {
 	workspacePath string
+	resolver      *workspace.Resolver
 }
 
-// NewGitTool creates a new git tool
-func NewGitTool(workspacePath string) *GitTool {
+// ansiEscape matches the color sequences of colored git output
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// NewGitTool creates a new git tool. Changes to files the resolver protects
+// are left out of diffs.
+func NewGitTool(resolver *workspace.Resolver) *GitTool {
 	return &GitTool{
-		workspacePath: workspacePath,
+		workspacePath: resolver.Root(),
+		resolver:      resolver,
 	}
 }
 
@@ -26,7 +38,41 @@ func (t *GitTool) Name() string {
 }
 
 func (t *GitTool) Description() string {
-	return "Execute git operations in the workspace"
+	return "Execute git operations in the workspace: status, diff, add (path), commit (message) and reset"
+}
+
+// FileStatus is the git status of a changed file
+type FileStatus struct {
+	Code     string // Two-letter porcelain status such as " M", "A " or "??"
+	Path     string // Relative to the repository root
+	OrigPath string // Path before a rename or copy
+}
+
+// String formats the status like a line of git status --porcelain
+func (s FileStatus) String() string {
+	if s.OrigPath != "" {
+		return fmt.Sprintf("%s %s -> %s", s.Code, s.OrigPath, s.Path)
+	}
+	return fmt.Sprintf("%s %s", s.Code, s.Path)
+}
+
+// Describe describes a call by the git command it runs. Status and diff are
+// read-only.
+func (t *GitTool) Describe(args map[string]interface{}) Invocation {
+	operation, _ := args["operation"].(string)
+	switch operation {
+	case "reset":
+		return Invocation{Subject: "reset --hard HEAD"}
+	case "commit":
+		message, _ := args["message"].(string)
+		return Invocation{Subject: fmt.Sprintf("commit -m %q", message)}
+	case "add":
+		path, _ := args["path"].(string)
+		return Invocation{Subject: "add " + path}
+	case "status", "diff":
+		return Invocation{Subject: operation, ReadOnly: true}
+	}
+	return Invocation{Subject: operation}
 }
 
 func (t *GitTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
@@ -37,8 +83,24 @@ func (t *GitTool) Execute(ctx context.Context, args map[string]interface{}) (str
 	}
 
 	switch operation {
+	case "status":
+		files, err := t.Status(ctx)
+		if err != nil {
+			return "", err
+		}
+		if len(files) == 0 {
+			return "No changes detected", nil
+		}
+		lines := make([]string, len(files))
+		for i, file := range files {
+			lines[i] = file.String()
+		}
+		return strings.Join(lines, "\n"), nil
 	case "diff":
 		return t.getDiff(ctx)
+	case "add":
+		path, _ := args["path"].(string)
+		return t.add(ctx, path)
 	case "commit":
 		message, _ := args["message"].(string)
 		return t.commit(ctx, message)
@@ -49,26 +111,65 @@ func (t *GitTool) Execute(ctx context.Context, args map[string]interface{}) (str
 	}
 }
 
+// Status returns the files in the workspace with uncommitted changes,
+// including untracked ones. Paths are relative to the workspace.
+func (t *GitTool) Status(ctx context.Context) ([]FileStatus, error) {
+	prefixCmd := exec.CommandContext(ctx, "git", "rev-parse", "--show-prefix")
+	prefixCmd.Dir = t.workspacePath
+	prefix, err := prefixCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-parse failed: %v", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "status", "--porcelain", "-z", "--untracked-files=all", "--", ".")
+	cmd.Dir = t.workspacePath
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status failed: %v", err)
+	}
+	return parseStatus(string(output), strings.TrimSpace(string(prefix))), nil
+}
+
+// parseStatus parses the output of git status --porcelain -z, in which each
+// entry ends with a NUL and renames and copies are followed by the old path.
+// Paths are made relative to the workspace by removing its prefix in the
+// repository.
+func parseStatus(output, prefix string) []FileStatus {
+	var files []FileStatus
+	fields := strings.Split(output, "\x00")
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if len(field) < 4 {
+			continue
+		}
+		status := FileStatus{Code: field[:2], Path: strings.TrimPrefix(field[3:], prefix)}
+		if strings.ContainsAny(status.Code, "RC") && i+1 < len(fields) {
+			i++
+			status.OrigPath = strings.TrimPrefix(fields[i], prefix)
+		}
+		files = append(files, status)
+	}
+	return files
+}
+
 // getDiff returns the current changes in the workspace
 func (t *GitTool) getDiff(ctx context.Context) (string, error) {
 	// First check if there are any changes
-	statusCmd := exec.CommandContext(ctx, "git", "status", "--porcelain")
-	statusCmd.Dir = t.workspacePath
-	status, err := statusCmd.Output()
+	statuses, err := t.Status(ctx)
 	if err != nil {
-		return "", fmt.Errorf("git status failed: %v", err)
+		return "", err
 	}
 
 	// Process status output to show file states
 	var result strings.Builder
-	if len(status) > 0 {
+	if len(statuses) > 0 {
 		result.WriteString("\nChanged files:\n")
-		for _, line := range strings.Split(string(status), "\n") {
-			if len(line) < 3 {
-				continue
+		for _, status := range statuses {
+			state := status.Code
+			file := status.Path
+			if status.OrigPath != "" {
+				file = status.OrigPath + " -> " + status.Path
 			}
-			state := line[:2]
-			file := strings.TrimSpace(line[3:])
 			switch state {
 			case "M ":
 				result.WriteString(fmt.Sprintf("  Modified:   %s\n", file))
@@ -91,8 +192,9 @@ func (t *GitTool) getDiff(ctx context.Context) (string, error) {
 		return "No changes detected", nil
 	}
 
-	// Get both staged and unstaged changes
-	cmd := exec.CommandContext(ctx, "git", "diff", "--color")
+	// Get both staged and unstaged changes, with paths relative to the
+	// workspace like the status
+	cmd := exec.CommandContext(ctx, "git", ui.GitDiffArgs("--relative")...)
 	cmd.Dir = t.workspacePath
 
 	// Capture both stdout and stderr
@@ -109,7 +211,7 @@ func (t *GitTool) getDiff(ctx context.Context) (string, error) {
 	}
 
 	// Get staged changes
-	stagedCmd := exec.CommandContext(ctx, "git", "diff", "--cached", "--color")
+	stagedCmd := exec.CommandContext(ctx, "git", ui.GitDiffArgs("--relative", "--cached")...)
 	stagedCmd.Dir = t.workspacePath
 
 	var stagedOut strings.Builder
@@ -127,20 +229,28 @@ func (t *GitTool) getDiff(ctx context.Context) (string, error) {
 	// Show staged changes
 	if stagedOut.Len() > 0 {
 		result.WriteString("\nStaged changes:\n")
-		result.WriteString(stagedOut.String())
+		result.WriteString(t.filterDiff(stagedOut.String()))
 	}
 
 	// Show unstaged changes
 	if stdout.Len() > 0 {
 		result.WriteString("\nUnstaged changes:\n")
-		result.WriteString(stdout.String())
+		result.WriteString(t.filterDiff(stdout.String()))
 	}
 
 	// Get untracked files content
-	for _, line := range strings.Split(string(status), "\n") {
-		if strings.HasPrefix(line, "??") {
-			file := strings.TrimSpace(line[3:])
-			content, err := os.ReadFile(filepath.Join(t.workspacePath, file))
+	for _, status := range statuses {
+		if status.Code == "??" {
+			file := status.Path
+			fullPath, err := t.resolver.ResolveRead(file)
+			if _, ok := err.(*ignore.ProtectedError); ok {
+				result.WriteString(fmt.Sprintf("\nNew file: %s (content omitted: %v)\n", file, err))
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			content, err := os.ReadFile(fullPath)
 			if err == nil {
 				result.WriteString(fmt.Sprintf("\nNew file: %s\n", file))
 				result.WriteString(string(content))
@@ -152,6 +262,133 @@ func (t *GitTool) getDiff(ctx context.Context) (string, error) {
 	return result.String(), nil
 }
 
+// filterDiff replaces the changes to protected files in a git diff with a
+// note saying why they were left out. Changes whose file names cannot be
+// read from their header are left out too.
+func (t *GitTool) filterDiff(diff string) string {
+	var out strings.Builder
+	skipping := false
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		plain := ansiEscape.ReplaceAllString(line, "")
+		if header, ok := strings.CutPrefix(plain, "diff --git "); ok {
+			skipping = false
+			paths := diffHeaderPaths(header)
+			if paths == nil {
+				out.WriteString(plain)
+				out.WriteString("(changes omitted: could not read the file names)\n")
+				skipping = true
+			}
+			for _, file := range paths {
+				if err := t.resolver.Protected(filepath.Join(t.workspacePath, filepath.FromSlash(file))); err != nil {
+					out.WriteString(plain)
+					out.WriteString(fmt.Sprintf("(changes omitted: %v)\n", err))
+					skipping = true
+					break
+				}
+			}
+		}
+		if !skipping {
+			out.WriteString(line)
+		}
+	}
+	return out.String()
+}
+
+// diffHeaderPaths returns the old and new paths of a "diff --git a/x b/y"
+// header, given the part after "diff --git ". Paths with special characters
+// are quoted by git. It returns nil if the header cannot be split into two
+// paths without guessing.
+func diffHeaderPaths(header string) []string {
+	header = strings.TrimRight(header, "\r\n")
+
+	var oldPath, newPath string
+	switch {
+	case strings.HasPrefix(header, `"`):
+		quoted, err := strconv.QuotedPrefix(header)
+		if err != nil {
+			return nil
+		}
+		oldPath, _ = strconv.Unquote(quoted)
+		newPath = strings.TrimPrefix(header[len(quoted):], " ")
+		if strings.HasPrefix(newPath, `"`) {
+			if newPath, err = strconv.Unquote(newPath); err != nil {
+				return nil
+			}
+		}
+	case strings.HasSuffix(header, `"`):
+		i := strings.LastIndex(header, ` "`)
+		if i < 0 {
+			return nil
+		}
+		var err error
+		oldPath = header[:i]
+		if newPath, err = strconv.Unquote(header[i+1:]); err != nil {
+			return nil
+		}
+	default:
+		// Both paths are the same unless the file was renamed, and a
+		// renamed path must not contain the separator
+		if l := (len(header) - 5) / 2; len(header) >= 5 && len(header)%2 == 1 &&
+			header[2+l:5+l] == " b/" && header[2:2+l] == header[5+l:] {
+			oldPath, newPath = header[:2+l], header[3+l:]
+			break
+		}
+		if strings.Count(header, " b/") != 1 {
+			return nil
+		}
+		i := strings.Index(header, " b/")
+		oldPath, newPath = header[:i], header[i+1:]
+	}
+
+	if !strings.HasPrefix(oldPath, "a/") || !strings.HasPrefix(newPath, "b/") {
+		return nil
+	}
+	return []string{oldPath[2:], newPath[2:]}
+}
+
+// add stages the changes of a file or directory in the workspace
+func (t *GitTool) add(ctx context.Context, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path argument required")
+	}
+	fullPath, err := t.resolver.Resolve(path)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "add", "--", t.resolver.Rel(fullPath))
+	cmd.Dir = t.workspacePath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git add failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return fmt.Sprintf("Staged %s", path), nil
+}
+
+// HeadContent returns the committed content of a workspace file
+func (t *GitTool) HeadContent(ctx context.Context, path string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", "show", "HEAD:./"+filepath.ToSlash(path))
+	cmd.Dir = t.workspacePath
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git show failed for %s: %v", path, err)
+	}
+	return output, nil
+}
+
+// Unstage resets the index entries of workspace files to HEAD, leaving the
+// files alone
+func (t *GitTool) Unstage(ctx context.Context, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "git", append([]string{"reset", "-q", "--"}, paths...)...)
+	cmd.Dir = t.workspacePath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git reset failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
 // commit stages and commits all changes
 func (t *GitTool) commit(ctx context.Context, message string) (string, error) {
 	if message == "" {
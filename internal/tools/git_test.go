@@ -0,0 +1,33 @@
+package tools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffHeaderPaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []string
+	}{
+		{name: "plain", header: "a/main.go b/main.go\n", want: []string{"main.go", "main.go"}},
+		{name: "rename", header: "a/old.go b/new.go", want: []string{"old.go", "new.go"}},
+		{name: "separator in path", header: "a/x b/y.env b/x b/y.env", want: []string{"x b/y.env", "x b/y.env"}},
+		{name: "ambiguous rename", header: "a/x b/y b/z", want: nil},
+		{name: "quoted", header: `"a/tab\there.env" "b/tab\there.env"`, want: []string{"tab\there.env", "tab\there.env"}},
+		{name: "quoted octal", header: `"a/\303\251.env" "b/\303\251.env"`, want: []string{"é.env", "é.env"}},
+		{name: "new path quoted", header: `a/plain "b/new\"quote"`, want: []string{"plain", `new"quote`}},
+		{name: "other prefixes", header: "i/main.go w/main.go", want: nil},
+		{name: "no prefixes", header: "main.go main.go", want: nil},
+		{name: "bad quoting", header: `"a/unterminated b/x`, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffHeaderPaths(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffHeaderPaths(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
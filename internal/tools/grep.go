@@ -2,22 +2,51 @@ package tools
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/warm3snow/tama/internal/ignore"
+	"github.com/warm3snow/tama/internal/workspace"
+)
+
+const (
+	// defaultMaxResults caps the matches returned by one search
+	defaultMaxResults = 100
+	// maxGrepWorkers bounds how many files are searched at once
+	maxGrepWorkers = 8
+	// maxMatchText caps the length of a reported line
+	maxMatchText = 500
+	// binarySniffSize is how much of a file is checked for NUL bytes
+	binarySniffSize = 8000
 )
 
 // GrepSearchTool implements code search functionality
 type GrepSearchTool struct {
 	workspacePath string
+	resolver      *workspace.Resolver
 }
 
-// NewGrepSearchTool creates a new grep search tool
-func NewGrepSearchTool(workspacePath string) *GrepSearchTool {
+// NewGrepSearchTool creates a new grep search tool confined to the
+// resolver's workspace
+func NewGrepSearchTool(resolver *workspace.Resolver) *GrepSearchTool {
 	return &GrepSearchTool{
-		workspacePath: workspacePath,
+		workspacePath: resolver.Root(),
+		resolver:      resolver,
 	}
 }
 
@@ -26,124 +55,359 @@ func (t *GrepSearchTool) Name() string {
 }
 
 func (t *GrepSearchTool) Description() string {
-	return "Search for patterns in files"
+	return "Search file contents (args: pattern, regex, case_sensitive, path, include and exclude globs, " +
+		"context or before/after lines, max_per_file, max_results, depth, hidden). " +
+		"Respects .gitignore and .tamaignore, skips binary and protected files and returns JSON matches"
+}
+
+// Describe describes a call by its pattern. Searches only read.
+func (t *GrepSearchTool) Describe(args map[string]interface{}) Invocation {
+	pattern, _ := args["pattern"].(string)
+	return Invocation{Subject: pattern, ReadOnly: true}
+}
+
+// globList is a list of globs given as an array or a comma-separated string
+type globList []string
+
+func (g *globList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*g = list
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	for _, glob := range strings.Split(s, ",") {
+		if glob = strings.TrimSpace(glob); glob != "" {
+			*g = append(*g, glob)
+		}
+	}
+	return nil
+}
+
+// grepArgs are the arguments of a search
+type grepArgs struct {
+	Pattern       string   `json:"pattern"`
+	Regex         bool     `json:"regex"`
+	CaseSensitive bool     `json:"case_sensitive"`
+	Path          string   `json:"path"`
+	Include       globList `json:"include"`
+	Exclude       globList `json:"exclude"`
+	Context       int      `json:"context"`
+	Before        int      `json:"before"`
+	After         int      `json:"after"`
+	MaxPerFile    int      `json:"max_per_file"`
+	MaxResults    int      `json:"max_results"`
+	Depth         int      `json:"depth"`
+	Hidden        bool     `json:"hidden"`
+	Engine        string   `json:"engine"` // "auto", "ripgrep" or "builtin"
+}
+
+// GrepMatch is one matching line
+type GrepMatch struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line"`
+	Column int      `json:"column"` // Byte column of the first match, counted from 1
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// grepResult is the result of a search
+type grepResult struct {
+	Pattern      string      `json:"pattern"`
+	Engine       string      `json:"engine"`
+	Matches      []GrepMatch `json:"matches"`
+	FilesMatched int         `json:"files_matched"`
+	Truncated    bool        `json:"truncated"`
+}
+
+// grepSearch describes a search shared by both engines
+type grepSearch struct {
+	grepArgs
+	re   *regexp.Regexp
+	root string // Directory paths are reported relative to
+	dir  string // Directory or file searched
 }
 
 func (t *GrepSearchTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
-	// Extract arguments
-	pattern, ok := args["pattern"].(string)
-	if !ok {
+	a := grepArgs{MaxResults: defaultMaxResults}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Pattern == "" {
 		return "", fmt.Errorf("pattern argument required")
 	}
+	if a.MaxResults <= 0 {
+		a.MaxResults = defaultMaxResults
+	}
+	if a.Context > 0 {
+		a.Before = max(a.Before, a.Context)
+		a.After = max(a.After, a.Context)
+	}
 
-	// Optional arguments
-	includePattern, _ := args["include"].(string)
-	excludePattern, _ := args["exclude"].(string)
-	caseSensitive, _ := args["case_sensitive"].(bool)
-	maxDepth, _ := args["depth"].(float64)
-
-	// Convert maxDepth to int
-	depth := -1
-	if maxDepth > 0 {
-		depth = int(maxDepth)
+	expr := a.Pattern
+	if !a.Regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if !a.CaseSensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return "", fmt.Errorf("invalid regular expression: %v", err)
 	}
 
-	// Store results
-	var results []string
-	resultCount := 0
+	dir, err := t.resolver.ResolveRead(a.Path)
+	if err != nil {
+		return "", err
+	}
+	s := &grepSearch{grepArgs: a, re: re, root: t.workspacePath, dir: dir}
+	if !t.resolver.Contains(dir) {
+		s.root = dir
+	}
 
-	// Walk through workspace
-	err := filepath.Walk(t.workspacePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip files we can't access
+	var result *grepResult
+	switch a.Engine {
+	case "ripgrep":
+		result, err = t.searchRipgrep(ctx, s)
+	case "builtin":
+		result, err = t.searchBuiltin(ctx, s)
+	case "", "auto":
+		if _, lookErr := exec.LookPath("rg"); lookErr == nil {
+			result, err = t.searchRipgrep(ctx, s)
 		}
-
-		// Get relative path
-		relPath, err := filepath.Rel(t.workspacePath, path)
-		if err != nil {
-			return nil
+		if result == nil {
+			result, err = t.searchBuiltin(ctx, s)
 		}
+	default:
+		return "", fmt.Errorf("unknown engine: %s", a.Engine)
+	}
+	if err != nil {
+		return "", fmt.Errorf("search failed: %v", err)
+	}
+	return encodeResult(result)
+}
 
-		// Check depth
-		if depth > 0 {
-			if strings.Count(relPath, string(os.PathSeparator)) > depth {
-				if info.IsDir() {
-					return filepath.SkipDir
+// searchBuiltin walks the files itself and searches them in parallel
+func (t *GrepSearchTool) searchBuiltin(ctx context.Context, s *grepSearch) (*grepResult, error) {
+	files, err := t.candidateFiles(s)
+	if err != nil {
+		return nil, err
+	}
+
+	perFile := make([][]GrepMatch, len(files))
+	var found atomic.Int64
+	var truncated atomic.Bool
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	workers := min(runtime.NumCPU(), maxGrepWorkers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if found.Load() >= int64(s.MaxResults) {
+					truncated.Store(true)
+					continue
 				}
-				return nil
+				matches, err := searchFile(filepath.Join(s.root, filepath.FromSlash(files[i])), files[i], s)
+				if err != nil {
+					continue
+				}
+				perFile[i] = matches
+				found.Add(int64(len(matches)))
 			}
+		}()
+	}
+
+feed:
+	for i := range files {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- i:
 		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-		// Skip directories and hidden files
-		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
-			return nil
+	result := &grepResult{Pattern: s.Pattern, Engine: "builtin", Matches: make([]GrepMatch, 0)}
+	result.Truncated = truncated.Load()
+	for _, matches := range perFile {
+		if len(matches) == 0 {
+			continue
+		}
+		result.FilesMatched++
+		for _, m := range matches {
+			if len(result.Matches) >= s.MaxResults {
+				result.Truncated = true
+				break
+			}
+			result.Matches = append(result.Matches, m)
 		}
+	}
+	return result, nil
+}
 
-		// Check include/exclude patterns
-		if includePattern != "" {
-			matched, err := filepath.Match(includePattern, info.Name())
-			if err != nil || !matched {
-				return nil
+// candidateFiles lists the files to search, sorted, relative to s.root
+func (t *GrepSearchTool) candidateFiles(s *grepSearch) ([]string, error) {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		rel, err := filepath.Rel(s.root, s.dir)
+		if err != nil {
+			return nil, err
+		}
+		return []string{filepath.ToSlash(rel)}, nil
+	}
+
+	startDepth := depth(relPath(s.root, s.dir))
+	var files []string
+	err = ignore.Walk(s.root, s.dir, ignore.New(), func(rel string, d fs.DirEntry) error {
+		name := d.Name()
+		if !s.Hidden && strings.HasPrefix(name, ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
 		}
-		if excludePattern != "" {
-			matched, err := filepath.Match(excludePattern, info.Name())
-			if err == nil && matched {
-				return nil
+		if t.resolver.Protected(filepath.Join(s.root, filepath.FromSlash(rel))) != nil {
+			if d.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
 		}
-
-		// If pattern is ".", just return the file path
-		if pattern == "." {
-			results = append(results, relPath)
-			resultCount++
-			if resultCount >= 50 {
-				return fmt.Errorf("max results reached")
+		if s.Depth > 0 && depth(rel)-startDepth > s.Depth {
+			if d.IsDir() {
+				return filepath.SkipDir
 			}
 			return nil
 		}
-
-		// Open and scan file
-		file, err := os.Open(path)
-		if err != nil {
+		if matchesAny(s.Exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		defer file.Close()
-
-		scanner := bufio.NewScanner(file)
-		lineNum := 0
-		for scanner.Scan() {
-			lineNum++
-			line := scanner.Text()
-
-			// Check if line contains pattern
-			found := false
-			if caseSensitive {
-				found = strings.Contains(line, pattern)
-			} else {
-				found = strings.Contains(strings.ToLower(line), strings.ToLower(pattern))
+		if d.IsDir() {
+			return nil
+		}
+		if len(s.Include) > 0 && !matchesAny(s.Include, rel) {
+			return nil
+		}
+		// Symlinked files must not lead out of the workspace
+		if d.Type()&fs.ModeSymlink != 0 {
+			if _, err := t.resolver.ResolveRead(filepath.Join(s.root, filepath.FromSlash(rel))); err != nil {
+				return nil
 			}
+		}
+		files = append(files, rel)
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
 
-			if found {
-				result := fmt.Sprintf("%s:%d:%s", relPath, lineNum, line)
-				results = append(results, result)
-				resultCount++
-				if resultCount >= 50 {
-					return fmt.Errorf("max results reached")
-				}
+// matchesAny reports whether a slash-separated path matches one of the
+// globs. Globs without a slash match the file name.
+func matchesAny(globs []string, rel string) bool {
+	for _, glob := range globs {
+		glob = strings.TrimSuffix(glob, "/")
+		if !strings.Contains(glob, "/") {
+			if ok, _ := path.Match(glob, path.Base(rel)); ok {
+				return true
 			}
+			continue
+		}
+		if ignore.Glob(glob, rel) {
+			return true
 		}
+	}
+	return false
+}
 
-		return nil
-	})
+// searchFile returns the matching lines of one file, or nothing if the
+// file is binary
+func searchFile(fullPath, rel string, s *grepSearch) ([]GrepMatch, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
 
-	if err != nil && err.Error() != "max results reached" {
-		return "", fmt.Errorf("search failed: %v", err)
+	reader := bufio.NewReaderSize(f, 64*1024)
+	head, err := reader.Peek(binarySniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
 	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, nil
+	}
+
+	var matches []GrepMatch
+	var before []string // Lines preceding the current one, at most s.Before
+	var pending []int   // Matches still collecting lines after them
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
 
-	if len(results) == 0 {
-		return "No matches found", nil
+		for len(pending) > 0 && len(matches[pending[0]].After) >= s.After {
+			pending = pending[1:]
+		}
+		for _, i := range pending {
+			matches[i].After = append(matches[i].After, clipLine(line))
+		}
+
+		full := s.MaxPerFile > 0 && len(matches) >= s.MaxPerFile
+		if loc := s.re.FindStringIndex(line); loc != nil && !full {
+			m := GrepMatch{
+				Path:   rel,
+				Line:   lineNum,
+				Column: loc[0] + 1,
+				Text:   clipLine(line),
+				Before: append([]string(nil), before...),
+			}
+			matches = append(matches, m)
+			if s.After > 0 {
+				pending = append(pending, len(matches)-1)
+			}
+		} else if full && len(pending) == 0 {
+			break
+		}
+
+		if s.Before > 0 {
+			before = append(before, clipLine(line))
+			if len(before) > s.Before {
+				before = before[1:]
+			}
+		}
 	}
+	// Files with overlong lines are searched up to that line
+	return matches, nil
+}
 
-	return strings.Join(results, "\n"), nil
+// clipLine shortens very long lines, such as minified code, without
+// splitting a character
+func clipLine(line string) string {
+	if len(line) > maxMatchText {
+		end := maxMatchText
+		for end > 0 && !utf8.RuneStart(line[end]) {
+			end--
+		}
+		return line[:end] + "..."
+	}
+	return line
 }
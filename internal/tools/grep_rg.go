@@ -0,0 +1,190 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/warm3snow/tama/internal/ignore"
+)
+
+// rgEvent is one line of ripgrep's --json output
+type rgEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		Path       rgText `json:"path"`
+		Lines      rgText `json:"lines"`
+		LineNumber int    `json:"line_number"`
+		Submatches []struct {
+			Start int `json:"start"`
+		} `json:"submatches"`
+	} `json:"data"`
+}
+
+// rgText is text in ripgrep's JSON output, which is base64 encoded if it is
+// not valid UTF-8
+type rgText struct {
+	Text string `json:"text"`
+}
+
+// rgFile collects the events of one file
+type rgFile struct {
+	matches []GrepMatch
+	lines   map[int]string // Matching and context lines by number
+}
+
+// searchRipgrep runs the search with ripgrep
+func (t *GrepSearchTool) searchRipgrep(ctx context.Context, s *grepSearch) (*grepResult, error) {
+	target, err := filepath.Rel(s.root, s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"--json", "--no-require-git", "--no-follow"}
+	if !s.Regex {
+		args = append(args, "--fixed-strings")
+	}
+	if s.CaseSensitive {
+		args = append(args, "--case-sensitive")
+	} else {
+		args = append(args, "--ignore-case")
+	}
+	if s.Before > 0 {
+		args = append(args, "--before-context", strconv.Itoa(s.Before))
+	}
+	if s.After > 0 {
+		args = append(args, "--after-context", strconv.Itoa(s.After))
+	}
+	if s.MaxPerFile > 0 {
+		args = append(args, "--max-count", strconv.Itoa(s.MaxPerFile))
+	}
+	if s.Depth > 0 {
+		args = append(args, "--max-depth", strconv.Itoa(s.Depth))
+	}
+	if s.Hidden {
+		args = append(args, "--hidden")
+	}
+	for _, dir := range ignore.DefaultDirs {
+		args = append(args, "--glob", "!"+dir+"/")
+	}
+	for _, name := range ignore.Files {
+		// ripgrep reads .gitignore itself; other ignore files of nested
+		// directories are applied to its results below
+		file := filepath.Join(s.root, name)
+		if _, err := os.Stat(file); err == nil && name != ".gitignore" {
+			args = append(args, "--ignore-file", file)
+		}
+	}
+	for _, glob := range s.Include {
+		args = append(args, "--glob", glob)
+	}
+	for _, glob := range s.Exclude {
+		args = append(args, "--glob", "!"+glob)
+	}
+	args = append(args, "--regexp", s.Pattern, "--", target)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "rg", args...)
+	cmd.Dir = s.root
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*rgFile)
+	skipped := make(map[string]bool)
+	checker := ignore.NewChecker(s.root)
+	found := 0
+	truncated := false
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var ev rgEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			continue
+		}
+		if ev.Type != "match" && ev.Type != "context" {
+			continue
+		}
+
+		rel := filepath.ToSlash(filepath.Clean(ev.Data.Path.Text))
+		if skipped[rel] {
+			continue
+		}
+		f := files[rel]
+		if f == nil {
+			// Symlinked files must not lead out of the workspace, and
+			// protected files are never searched
+			_, err := t.resolver.ResolveRead(filepath.Join(s.root, rel))
+			if err != nil || checker.Ignored(rel, false) {
+				skipped[rel] = true
+				continue
+			}
+			f = &rgFile{lines: make(map[int]string)}
+			files[rel] = f
+		}
+		line := clipLine(strings.TrimRight(ev.Data.Lines.Text, "\r\n"))
+		f.lines[ev.Data.LineNumber] = line
+
+		if ev.Type == "match" {
+			if found >= s.MaxResults {
+				truncated = true
+				cancel()
+				break
+			}
+			column := 1
+			if len(ev.Data.Submatches) > 0 {
+				column = ev.Data.Submatches[0].Start + 1
+			}
+			f.matches = append(f.matches, GrepMatch{Path: rel, Line: ev.Data.LineNumber, Column: column, Text: line})
+			found++
+		}
+	}
+
+	// Exit status 1 means no matches
+	if err := cmd.Wait(); err != nil && !truncated {
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+			return nil, fmt.Errorf("ripgrep failed: %v %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	result := &grepResult{Pattern: s.Pattern, Engine: "ripgrep", Matches: make([]GrepMatch, 0), Truncated: truncated}
+	paths := make([]string, 0, len(files))
+	for rel, f := range files {
+		if len(f.matches) > 0 {
+			paths = append(paths, rel)
+		}
+	}
+	sort.Strings(paths)
+	for _, rel := range paths {
+		f := files[rel]
+		result.FilesMatched++
+		for _, m := range f.matches {
+			for n := m.Line - s.Before; n < m.Line; n++ {
+				if line, ok := f.lines[n]; ok {
+					m.Before = append(m.Before, line)
+				}
+			}
+			for n := m.Line + 1; n <= m.Line+s.After; n++ {
+				if line, ok := f.lines[n]; ok {
+					m.After = append(m.After, line)
+				}
+			}
+			result.Matches = append(result.Matches, m)
+		}
+	}
+	return result, nil
+}
@@ -7,17 +7,22 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/warm3snow/tama/internal/workspace"
 )
 
 // LanguageDetector implements language detection functionality
 type LanguageDetector struct {
 	workspacePath string
+	resolver      *workspace.Resolver
 }
 
-// NewLanguageDetector creates a new language detector tool
-func NewLanguageDetector(workspacePath string) *LanguageDetector {
+// NewLanguageDetector creates a new language detector tool that skips the
+// resolver's protected files
+func NewLanguageDetector(resolver *workspace.Resolver) *LanguageDetector {
 	return &LanguageDetector{
-		workspacePath: workspacePath,
+		workspacePath: resolver.Root(),
+		resolver:      resolver,
 	}
 }
 
@@ -29,6 +34,11 @@ func (t *LanguageDetector) Description() string {
 	return "Detect programming languages in the workspace"
 }
 
+// Describe describes a call, which only reads the workspace
+func (t *LanguageDetector) Describe(args map[string]interface{}) Invocation {
+	return Invocation{ReadOnly: true}
+}
+
 // LanguageInfo contains information about a detected language
 type LanguageInfo struct {
 	Name       string  // Language name
@@ -108,7 +118,14 @@ func (t *LanguageDetector) Execute(ctx context.Context, args map[string]interfac
 			return nil
 		}
 
-		// Skip directories and hidden files
+		// Skip protected paths, directories and hidden files
+		if t.resolver.Protected(path) != nil {
+			debugInfo.WriteString(fmt.Sprintf("Skipping protected path: %s\n", relPath))
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		if info.IsDir() {
 			if strings.HasPrefix(info.Name(), ".") || info.Name() == "vendor" || info.Name() == "node_modules" {
 				debugInfo.WriteString(fmt.Sprintf("Skipping directory: %s\n", relPath))
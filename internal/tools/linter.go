@@ -4,19 +4,22 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
-	"path/filepath"
 	"strings"
+
+	"github.com/warm3snow/tama/internal/workspace"
 )
 
 // LinterTool implements code linting functionality
 type LinterTool struct {
 	workspacePath string
+	resolver      *workspace.Resolver
 }
 
-// NewLinterTool creates a new linter tool
-func NewLinterTool(workspacePath string) *LinterTool {
+// NewLinterTool creates a new linter tool confined to the resolver's workspace
+func NewLinterTool(resolver *workspace.Resolver) *LinterTool {
 	return &LinterTool{
-		workspacePath: workspacePath,
+		workspacePath: resolver.Root(),
+		resolver:      resolver,
 	}
 }
 
@@ -28,6 +31,17 @@ func (t *LinterTool) Description() string {
 	return "Check and fix high priority code issues using linters"
 }
 
+// Describe describes a call by its operation and path. Only check is
+// read-only.
+func (t *LinterTool) Describe(args map[string]interface{}) Invocation {
+	operation, _ := args["operation"].(string)
+	path, _ := args["path"].(string)
+	if path == "" {
+		path = "."
+	}
+	return Invocation{Subject: operation + " " + path, ReadOnly: operation == "check"}
+}
+
 func (t *LinterTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	// Extract arguments
 	operation, ok := args["operation"].(string)
@@ -59,7 +73,10 @@ func (t *LinterTool) Execute(ctx context.Context, args map[string]interface{}) (
 
 // checkCode runs linters to check the code
 func (t *LinterTool) checkCode(ctx context.Context, path string, severity string) (string, error) {
-	fullPath := filepath.Join(t.workspacePath, path)
+	fullPath, err := t.resolver.ResolveRead(path)
+	if err != nil {
+		return "", err
+	}
 
 	// Run golangci-lint for Go files
 	if isGoFile(path) {
@@ -92,7 +109,10 @@ func (t *LinterTool) checkCode(ctx context.Context, path string, severity string
 
 // fixCode attempts to automatically fix linter issues
 func (t *LinterTool) fixCode(ctx context.Context, path string, severity string) (string, error) {
-	fullPath := filepath.Join(t.workspacePath, path)
+	fullPath, err := t.resolver.Resolve(path)
+	if err != nil {
+		return "", err
+	}
 
 	// Fix Go files
 	if isGoFile(path) {
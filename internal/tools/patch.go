@@ -0,0 +1,267 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/warm3snow/tama/internal/workspace"
+)
+
+// defaultFuzz is how many context lines a hunk may ignore at each end by default
+const defaultFuzz = 2
+
+// PatchTool applies unified diffs to workspace files
+type PatchTool struct {
+	resolver *workspace.Resolver
+}
+
+// NewPatchTool creates a new patch tool confined to the resolver's workspace
+func NewPatchTool(resolver *workspace.Resolver) *PatchTool {
+	return &PatchTool{
+		resolver: resolver,
+	}
+}
+
+func (t *PatchTool) Name() string {
+	return "patch"
+}
+
+func (t *PatchTool) Description() string {
+	return "Apply a unified diff to workspace files (args: patch, fuzz, reverse, dry_run). All files are changed or none are."
+}
+
+// Describe describes a call by the files the patch changes. A dry run is
+// read-only.
+func (t *PatchTool) Describe(args map[string]interface{}) Invocation {
+	diff, _ := args["patch"].(string)
+	dryRun, _ := args["dry_run"].(bool)
+	subject := "apply"
+	if patches, err := ParseUnifiedDiff(diff); err == nil {
+		for _, p := range patches {
+			if p.NewPath != "" {
+				subject += " " + p.NewPath
+			} else {
+				subject += " " + p.OldPath
+			}
+		}
+	}
+	return Invocation{Subject: subject, ReadOnly: dryRun}
+}
+
+// patchedFile is the planned result of patching one file
+type patchedFile struct {
+	path     string // Workspace-relative path to write, or to delete if content is nil
+	fullPath string
+	original []byte // Content before patching, nil if the file is new
+	content  *string
+	mode     os.FileMode
+	removed  string // Path deleted by a rename
+}
+
+func (t *PatchTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	diff, ok := args["patch"].(string)
+	if !ok || strings.TrimSpace(diff) == "" {
+		return "", fmt.Errorf("patch argument required")
+	}
+	fuzz := defaultFuzz
+	if f, ok := args["fuzz"].(float64); ok && f >= 0 {
+		fuzz = int(f)
+	}
+	reverse, _ := args["reverse"].(bool)
+	dryRun, _ := args["dry_run"].(bool)
+
+	patches, err := ParseUnifiedDiff(diff)
+	if err != nil {
+		return "", fmt.Errorf("invalid patch: %v", err)
+	}
+
+	// Work out every result before touching any file
+	var planned []patchedFile
+	var report strings.Builder
+	failed := false
+	for _, p := range patches {
+		if reverse {
+			p = p.Reverse()
+		}
+		fmt.Fprintf(&report, "%s:\n", patchName(p))
+		file, err := t.plan(p, fuzz, &report)
+		if err != nil {
+			failed = true
+			fmt.Fprintf(&report, "  %s\n", err)
+			continue
+		}
+		planned = append(planned, file)
+	}
+
+	if failed {
+		return "", fmt.Errorf("patch not applied, no files were changed:\n%s", strings.TrimRight(report.String(), "\n"))
+	}
+
+	if dryRun {
+		report.WriteString("\nDry run, no files were changed. Resulting files:\n")
+		for _, file := range planned {
+			if file.content == nil {
+				fmt.Fprintf(&report, "\n%s: deleted\n", file.path)
+				continue
+			}
+			fmt.Fprintf(&report, "\n=== %s ===\n%s", file.path, *file.content)
+		}
+		return report.String(), nil
+	}
+
+	if err := t.write(planned); err != nil {
+		return "", err
+	}
+	return report.String(), nil
+}
+
+// plan applies a file patch in memory, reporting each hunk
+func (t *PatchTool) plan(p *FilePatch, fuzz int, report *strings.Builder) (patchedFile, error) {
+	sourcePath := p.OldPath
+	if sourcePath == "" {
+		sourcePath = p.NewPath
+	}
+	targetPath := p.NewPath
+	if targetPath == "" {
+		targetPath = p.OldPath
+	}
+	if targetPath == "" {
+		return patchedFile{}, fmt.Errorf("patch names no file")
+	}
+
+	sourceFull, err := t.resolve(sourcePath)
+	if err != nil {
+		return patchedFile{}, err
+	}
+	targetFull, err := t.resolve(targetPath)
+	if err != nil {
+		return patchedFile{}, err
+	}
+
+	file := patchedFile{path: targetPath, fullPath: targetFull, mode: 0644}
+
+	var content string
+	if p.OldPath == "" {
+		if _, err := os.Stat(targetFull); err == nil {
+			return patchedFile{}, fmt.Errorf("patch creates the file, but it already exists")
+		}
+	} else {
+		data, err := os.ReadFile(sourceFull)
+		if err != nil {
+			return patchedFile{}, fmt.Errorf("failed to read file: %v", err)
+		}
+		info, err := os.Stat(sourceFull)
+		if err == nil {
+			file.mode = info.Mode().Perm()
+		}
+		content = string(data)
+		file.original = data
+	}
+	if p.OldPath != "" && p.NewPath != "" && p.OldPath != p.NewPath {
+		file.removed = sourceFull
+		file.original = nil
+		if _, err := os.Stat(targetFull); err == nil {
+			return patchedFile{}, fmt.Errorf("rename target %s already exists", targetPath)
+		}
+	}
+
+	result, hunks := p.Apply(content, fuzz)
+	var failures []string
+	for _, h := range hunks {
+		switch {
+		case h.Error != "":
+			failures = append(failures, fmt.Sprintf("  Hunk #%d FAILED: %s", h.Index, indent(h.Error)))
+		case h.Offset != 0 || h.Fuzz != 0:
+			fmt.Fprintf(report, "  Hunk #%d applied at line %d (offset %d lines, fuzz %d)\n", h.Index, h.Line, h.Offset, h.Fuzz)
+		default:
+			fmt.Fprintf(report, "  Hunk #%d applied at line %d\n", h.Index, h.Line)
+		}
+	}
+	if len(failures) > 0 {
+		return patchedFile{}, fmt.Errorf("%d of %d hunks failed:\n%s", len(failures), len(hunks), strings.Join(failures, "\n"))
+	}
+
+	if p.NewPath == "" {
+		if strings.TrimSpace(result) != "" {
+			return patchedFile{}, fmt.Errorf("patch deletes the file, but content would remain")
+		}
+		return file, nil
+	}
+	file.content = &result
+	return file, nil
+}
+
+// write applies planned changes, restoring the originals if any write fails
+func (t *PatchTool) write(planned []patchedFile) error {
+	var done []patchedFile
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			file := done[i]
+			if file.original != nil {
+				workspace.WriteFileAtomic(file.fullPath, file.original, file.mode)
+			} else if file.content != nil {
+				os.Remove(file.fullPath)
+			}
+			if file.removed != "" {
+				os.Rename(file.fullPath+".tama-renamed", file.removed)
+			}
+		}
+	}
+
+	for _, file := range planned {
+		var err error
+		switch {
+		case file.content == nil:
+			err = os.Remove(file.fullPath)
+		default:
+			err = workspace.WriteFileAtomic(file.fullPath, []byte(*file.content), file.mode)
+			if err == nil && file.removed != "" {
+				// Keep the source until every file is written so it can be restored
+				err = os.Rename(file.removed, file.fullPath+".tama-renamed")
+			}
+		}
+		if err != nil {
+			rollback()
+			return fmt.Errorf("failed to write %s, no files were changed: %v", file.path, err)
+		}
+		done = append(done, file)
+	}
+
+	for _, file := range done {
+		if file.removed != "" {
+			os.Remove(file.fullPath + ".tama-renamed")
+		}
+	}
+	return nil
+}
+
+// resolve returns the absolute path of a workspace-relative path, refusing
+// paths outside the workspace
+func (t *PatchTool) resolve(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("path %s must be relative to the workspace", path)
+	}
+	return t.resolver.Resolve(path)
+}
+
+// patchName describes the file a patch applies to
+func patchName(p *FilePatch) string {
+	switch {
+	case p.OldPath == "":
+		return p.NewPath + " (new file)"
+	case p.NewPath == "":
+		return p.OldPath + " (deleted)"
+	case p.OldPath != p.NewPath:
+		return p.OldPath + " -> " + p.NewPath
+	default:
+		return p.NewPath
+	}
+}
+
+// indent indents continuation lines of a multi-line message
+func indent(s string) string {
+	return strings.ReplaceAll(s, "\n", "\n    ")
+}
@@ -0,0 +1,361 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/warm3snow/tama/internal/config"
+	"github.com/warm3snow/tama/internal/logging"
+)
+
+// Permission is what a policy decides about a tool call
+type Permission string
+
+const (
+	PermissionAllow Permission = "allow" // Run the call
+	PermissionAsk   Permission = "ask"   // Run the call if the user approves it
+	PermissionDeny  Permission = "deny"  // Refuse the call
+)
+
+// Mode changes how a policy treats calls
+type Mode string
+
+const (
+	ModeNormal   Mode = "normal"    // Apply the rules
+	ModeYolo     Mode = "yolo"      // Allow calls that would be asked about; deny rules still apply
+	ModeReadOnly Mode = "read-only" // Deny every call that could change something
+)
+
+// Approval is the user's answer to a call that needs approval
+type Approval int
+
+const (
+	Reject         Approval = iota // Refuse the call
+	ApproveOnce                    // Run this call
+	ApproveSession                 // Run this call and identical ones for the rest of the session
+)
+
+// Invocation describes a tool call for the policy and the user
+type Invocation struct {
+	Tool     string
+	Subject  string // Command line or operation and path that rules match
+	Args     map[string]interface{}
+	ReadOnly bool // The call cannot change anything
+	Shell    bool // Subject is a command line run by a shell
+}
+
+// Describer is implemented by tools that describe their calls. Calls of other
+// tools have an empty subject and are not read-only.
+type Describer interface {
+	Describe(args map[string]interface{}) Invocation
+}
+
+// Approver asks the user about a call
+type Approver func(inv Invocation) Approval
+
+// shellOperators are the characters that let a command line run more than
+// the command an allow rule names
+const shellOperators = ";&|$`<>()\n"
+
+// unsafeFlags matches the flags that let an allowed command write files
+// anywhere or run other programs, such as git diff --output, go test -exec
+// and -coverprofile, and gofmt -w. Allow rules do not apply to command lines
+// using them.
+var unsafeFlags = regexp.MustCompile(`(^|\s)(--output|--ext-diff|--textconv|--?(o|w|exec|toolexec|vettool|overlay|modfile|` +
+	`(test\.)?(coverprofile|cpuprofile|memprofile|blockprofile|mutexprofile|trace|outputdir)))(=|\s|$)`)
+
+// defaultRules apply after the configured ones. Commands that destroy data
+// beyond the workspace are denied, common read-only commands are allowed and
+// every other command and git's destructive operations need approval. go
+// build and go test are asked about, because the model can write the code
+// they compile and run.
+var defaultRules = []config.ToolRule{
+	{Tool: "run_terminal", Match: `re:\brm\s+(-\S*\s+)*-\S*[rR]\S*\s+(-\S*\s+)*("?(/|~|\$HOME)/?\*?"?)(\s|$)`, Action: "deny"},
+	{Tool: "run_terminal", Match: `re:\bmkfs(\.\w+)?\b`, Action: "deny"},
+	{Tool: "run_terminal", Match: `re:\bdd\b.*\bof=/dev/`, Action: "deny"},
+	{Tool: "run_terminal", Match: `re:>\s*/dev/(sd|hd|nvme|vd|disk)`, Action: "deny"},
+	{Tool: "run_terminal", Match: `re::\(\)\s*\{\s*:\|:&\s*\};:`, Action: "deny"},
+	{Tool: "run_terminal", Match: "go vet*", Action: "allow"},
+	{Tool: "run_terminal", Match: "go fmt*", Action: "allow"},
+	{Tool: "run_terminal", Match: "gofmt*", Action: "allow"},
+	{Tool: "run_terminal", Match: "git status*", Action: "allow"},
+	{Tool: "run_terminal", Match: "git diff*", Action: "allow"},
+	{Tool: "run_terminal", Match: "git log*", Action: "allow"},
+	{Tool: "run_terminal", Match: "git show*", Action: "allow"},
+	{Tool: "run_terminal", Match: "ls", Action: "allow"},
+	{Tool: "run_terminal", Match: "ls *", Action: "allow"},
+	{Tool: "run_terminal", Match: "pwd", Action: "allow"},
+	{Tool: "run_terminal", Action: "ask"},
+	{Tool: "git", Match: "reset*", Action: "ask"},
+	{Tool: "git", Match: "commit*", Action: "ask"},
+}
+
+// rule is a compiled tool rule
+type rule struct {
+	tool   string
+	text   string // Rule as written, for messages
+	match  func(subject string) bool
+	action Permission
+}
+
+// PolicyError reports a call the policy refused
+type PolicyError struct {
+	Tool    string
+	Subject string
+	Reason  string
+}
+
+func (e *PolicyError) Error() string {
+	if e.Subject == "" {
+		return fmt.Sprintf("%s call refused: %s", e.Tool, e.Reason)
+	}
+	return fmt.Sprintf("%s %q refused: %s", e.Tool, e.Subject, e.Reason)
+}
+
+// Policy decides which tool calls run. It remembers calls the user approved
+// for the session.
+type Policy struct {
+	mu       sync.Mutex
+	rules    []rule
+	project  []rule // Ask and deny rules of the project, which only tighten
+	mode     Mode
+	approver Approver
+	approved map[string]bool // Calls approved for the session, by tool and subject
+}
+
+// NewPolicy creates a policy with the built-in rules in normal mode
+func NewPolicy() *Policy {
+	p := &Policy{
+		mode:     ModeNormal,
+		approved: make(map[string]bool),
+	}
+	p.SetRules(nil, nil)
+	return p
+}
+
+// SetRules replaces the configured rules, after which the built-in rules
+// apply, and the project rules. A project rule only counts when it is
+// stricter than what the other rules decide, so a project cannot loosen the
+// user's policy.
+func (p *Policy) SetRules(rules, projectRules []config.ToolRule) error {
+	compiled, err := compileRules(rules, "configured")
+	if err != nil {
+		return err
+	}
+	defaults, err := compileRules(defaultRules, "built-in")
+	if err != nil {
+		return err
+	}
+	compiled = append(compiled, defaults...)
+	project, err := compileRules(projectRules, "project")
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = compiled
+	p.project = project
+	return nil
+}
+
+// SetMode sets the mode of the policy
+func (p *Policy) SetMode(mode Mode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mode = mode
+}
+
+// Mode returns the mode of the policy
+func (p *Policy) Mode() Mode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mode
+}
+
+// SetApprover sets the function that asks the user about calls. Without
+// one, calls that need approval are refused.
+func (p *Policy) SetApprover(approver Approver) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.approver = approver
+}
+
+// Decide returns the permission for a call and the rule that decided it,
+// without asking the user
+func (p *Policy) Decide(inv Invocation) (Permission, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.decide(inv)
+}
+
+func (p *Policy) decide(inv Invocation) (Permission, string) {
+	if p.mode == ModeReadOnly && !inv.ReadOnly {
+		return PermissionDeny, "read-only mode"
+	}
+
+	permission, text := firstMatch(p.rules, inv)
+	if projectPermission, projectText := firstMatch(p.project, inv); strictness[projectPermission] > strictness[permission] {
+		permission, text = projectPermission, projectText
+	}
+
+	if permission == PermissionAsk && p.mode == ModeYolo {
+		return PermissionAllow, "yolo mode"
+	}
+	return permission, text
+}
+
+// strictness orders permissions from the loosest to the strictest
+var strictness = map[Permission]int{PermissionAllow: 0, PermissionAsk: 1, PermissionDeny: 2}
+
+// firstMatch returns the action of the first rule matching a call and the
+// rule's text. Calls no rule matches are allowed.
+func firstMatch(rules []rule, inv Invocation) (Permission, string) {
+	for _, r := range rules {
+		if r.tool != "*" && r.tool != inv.Tool {
+			continue
+		}
+		// An allow rule names one command, not a command line chaining others
+		// or one whose flags write files or run programs
+		if r.action == PermissionAllow && inv.Shell &&
+			(strings.ContainsAny(inv.Subject, shellOperators) || unsafeFlags.MatchString(inv.Subject)) {
+			continue
+		}
+		if r.match(inv.Subject) {
+			return r.action, r.text
+		}
+	}
+	return PermissionAllow, ""
+}
+
+// Check returns nil if a call may run, asking the user when a rule requires
+// it, or a *PolicyError
+func (p *Policy) Check(inv Invocation) error {
+	p.mu.Lock()
+	permission, text := p.decide(inv)
+	key := inv.Tool + "\x00" + inv.Subject
+	if permission == PermissionAsk && p.approved[key] {
+		permission = PermissionAllow
+	}
+	approver := p.approver
+	p.mu.Unlock()
+
+	switch permission {
+	case PermissionAllow:
+		return nil
+	case PermissionDeny:
+		logging.LogToolDecision(inv.Tool, string(permission), text)
+		return &PolicyError{Tool: inv.Tool, Subject: inv.Subject, Reason: "denied by " + text}
+	}
+
+	if approver == nil {
+		logging.LogToolDecision(inv.Tool, "deny", "no approver")
+		return &PolicyError{Tool: inv.Tool, Subject: inv.Subject,
+			Reason: "needs the user's approval, which cannot be asked for here; allow it with a tools.rules entry or run with --yolo"}
+	}
+
+	approval := approver(inv)
+	switch approval {
+	case ApproveSession:
+		p.mu.Lock()
+		p.approved[key] = true
+		p.mu.Unlock()
+		logging.LogToolDecision(inv.Tool, "allow", "approved for this session")
+		return nil
+	case ApproveOnce:
+		logging.LogToolDecision(inv.Tool, "allow", "approved once")
+		return nil
+	default:
+		logging.LogToolDecision(inv.Tool, "deny", "rejected by the user")
+		return &PolicyError{Tool: inv.Tool, Subject: inv.Subject, Reason: "rejected by the user"}
+	}
+}
+
+// Guard returns a tool that checks the policy before every call
+func (p *Policy) Guard(tool Tool) Tool {
+	return &guardedTool{Tool: tool, policy: p}
+}
+
+// guardedTool is a tool whose calls are checked against a policy
+type guardedTool struct {
+	Tool
+	policy *Policy
+}
+
+func (g *guardedTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	if err := g.policy.Check(Describe(g.Tool, args)); err != nil {
+		return "", err
+	}
+	return g.Tool.Execute(ctx, args)
+}
+
+// Describe describes a call by the wrapped tool's description
+func (g *guardedTool) Describe(args map[string]interface{}) Invocation {
+	return Describe(g.Tool, args)
+}
+
+// Describe describes a call of a tool
+func Describe(tool Tool, args map[string]interface{}) Invocation {
+	if describer, ok := tool.(Describer); ok {
+		inv := describer.Describe(args)
+		inv.Tool, inv.Args = tool.Name(), args
+		return inv
+	}
+	return Invocation{Tool: tool.Name(), Args: args}
+}
+
+// compileRules compiles tool rules, in order. Source names them in messages.
+func compileRules(rules []config.ToolRule, source string) ([]rule, error) {
+	compiled := make([]rule, 0, len(rules))
+	for _, cr := range rules {
+		action := Permission(cr.Action)
+		switch action {
+		case PermissionAllow, PermissionAsk, PermissionDeny:
+		default:
+			return nil, fmt.Errorf("tool rule for %s has invalid action %q (want allow, ask or deny)", cr.Tool, cr.Action)
+		}
+		match, err := compileMatch(cr.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tool rule pattern for %s: %v", cr.Tool, err)
+		}
+		text := fmt.Sprintf("%s rule %s for %s", source, cr.Action, cr.Tool)
+		if cr.Match != "" {
+			text += fmt.Sprintf(" %q", cr.Match)
+		}
+		compiled = append(compiled, rule{tool: cr.Tool, text: text, match: match, action: action})
+	}
+	return compiled, nil
+}
+
+// compileMatch compiles a glob, in which * matches any text including
+// slashes and spaces, or a regular expression after "re:"
+func compileMatch(pattern string) (func(string) bool, error) {
+	if pattern == "" {
+		return func(string) bool { return true }, nil
+	}
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	re := regexp.MustCompile(sb.String())
+	return re.MatchString, nil
+}
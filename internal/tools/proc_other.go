@@ -0,0 +1,16 @@
+//go:build !unix
+
+package tools
+
+import "os/exec"
+
+// setProcessGroup does nothing on systems without process groups
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills a started command
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,248 @@
+package tools
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxBackground is how many background commands may run at once
+const maxBackground = 8
+
+// maxFinished is how many finished background commands are kept until
+// their output is read; the oldest are dropped beyond it
+const maxFinished = 16
+
+// outputBuffer keeps the head and the tail of a command's output within a
+// byte limit. It is safe for concurrent use.
+type outputBuffer struct {
+	mu    sync.Mutex
+	limit int
+	head  []byte
+	tail  []byte
+	total int64
+}
+
+// newOutputBuffer creates a buffer keeping at most limit bytes
+func newOutputBuffer(limit int) *outputBuffer {
+	return &outputBuffer{limit: limit}
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	b.total += int64(n)
+	if room := b.limit/2 - len(b.head); room > 0 {
+		take := min(room, len(p))
+		b.head = append(b.head, p[:take]...)
+		p = p[take:]
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	tailLimit := b.limit - b.limit/2
+	b.tail = append(b.tail, p...)
+	if len(b.tail) > 2*tailLimit {
+		b.tail = append([]byte(nil), b.tail[len(b.tail)-tailLimit:]...)
+	}
+	return n, nil
+}
+
+// String returns the kept output, marking where bytes were left out
+func (b *outputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tail := b.tail
+	if tailLimit := b.limit - b.limit/2; len(tail) > tailLimit {
+		tail = tail[len(tail)-tailLimit:]
+	}
+	omitted := b.total - int64(len(b.head)) - int64(len(tail))
+	if omitted <= 0 {
+		return string(b.head) + string(tail)
+	}
+	return fmt.Sprintf("%s\n... [%d bytes omitted] ...\n%s", b.head, omitted, tail)
+}
+
+// process is a background command
+type process struct {
+	id      int
+	command string
+	cmd     *exec.Cmd
+	output  *outputBuffer
+	started time.Time
+	done    chan struct{} // Closed when the command has exited
+}
+
+// ProcessInfo describes a background command
+type ProcessInfo struct {
+	ID       int       `json:"id"`
+	Command  string    `json:"command"`
+	PID      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+	Running  bool      `json:"running"`
+	ExitCode int       `json:"exit_code"` // -1 while running or if killed by a signal
+}
+
+// Processes tracks the background commands of a session
+type Processes struct {
+	mu    sync.Mutex
+	next  int
+	procs map[int]*process
+}
+
+// NewProcesses creates an empty process table
+func NewProcesses() *Processes {
+	return &Processes{procs: make(map[int]*process)}
+}
+
+// Start starts cmd in the background, writing its output to output, and
+// returns its ID
+func (p *Processes) Start(cmd *exec.Cmd, command string, output *outputBuffer) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	running := 0
+	for _, proc := range p.procs {
+		if proc.running() {
+			running++
+		}
+	}
+	if running >= maxBackground {
+		return 0, fmt.Errorf("too many background commands (%d); kill one first", running)
+	}
+	p.dropFinished(maxFinished - 1)
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start command: %v", err)
+	}
+	p.next++
+	proc := &process{
+		id:      p.next,
+		command: command,
+		cmd:     cmd,
+		output:  output,
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	p.procs[proc.id] = proc
+	go func() {
+		cmd.Wait()
+		close(proc.done)
+	}()
+	return proc.id, nil
+}
+
+// List describes the background commands, oldest first
+func (p *Processes) List() []ProcessInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	infos := make([]ProcessInfo, 0, len(p.procs))
+	for _, proc := range p.procs {
+		infos = append(infos, proc.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Output returns the description and the kept output of a background
+// command. A finished command is forgotten once its output is returned.
+func (p *Processes) Output(id int) (ProcessInfo, string, error) {
+	proc, err := p.get(id)
+	if err != nil {
+		return ProcessInfo{}, "", err
+	}
+	info, output := proc.info(), proc.output.String()
+	if !info.Running {
+		p.mu.Lock()
+		delete(p.procs, id)
+		p.mu.Unlock()
+	}
+	return info, output, nil
+}
+
+// dropFinished forgets the oldest finished commands beyond keep. The caller
+// holds p.mu.
+func (p *Processes) dropFinished(keep int) {
+	var finished []int
+	for id, proc := range p.procs {
+		if !proc.running() {
+			finished = append(finished, id)
+		}
+	}
+	if len(finished) <= keep {
+		return
+	}
+	sort.Ints(finished)
+	for _, id := range finished[:len(finished)-keep] {
+		delete(p.procs, id)
+	}
+}
+
+// Kill stops a background command and everything it started
+func (p *Processes) Kill(id int) error {
+	proc, err := p.get(id)
+	if err != nil {
+		return err
+	}
+	if !proc.running() {
+		return nil
+	}
+	if err := killProcessGroup(proc.cmd); err != nil {
+		return fmt.Errorf("failed to kill process %d: %v", id, err)
+	}
+	<-proc.done
+	return nil
+}
+
+// StopAll kills every running background command
+func (p *Processes) StopAll() {
+	for _, info := range p.List() {
+		if info.Running {
+			p.Kill(info.ID)
+		}
+	}
+}
+
+// get returns the process with the given ID
+func (p *Processes) get(id int) (*process, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	proc, ok := p.procs[id]
+	if !ok {
+		return nil, fmt.Errorf("no background process with id %d", id)
+	}
+	return proc, nil
+}
+
+// running reports whether the process has not exited yet
+func (proc *process) running() bool {
+	select {
+	case <-proc.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// info describes the process
+func (proc *process) info() ProcessInfo {
+	info := ProcessInfo{
+		ID:       proc.id,
+		Command:  proc.command,
+		PID:      proc.cmd.Process.Pid,
+		Started:  proc.started,
+		Running:  proc.running(),
+		ExitCode: -1,
+	}
+	if !info.Running {
+		info.ExitCode = proc.cmd.ProcessState.ExitCode()
+	}
+	return info
+}
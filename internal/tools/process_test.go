@@ -0,0 +1,67 @@
+//go:build unix
+
+package tools
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// startFinished starts a background command and waits for it to exit
+func startFinished(t *testing.T, p *Processes, code string) int {
+	t.Helper()
+	output := newOutputBuffer(1024)
+	cmd := exec.Command("sh", "-c", "echo done; exit "+code)
+	cmd.Stdout = output
+	id, err := p.Start(cmd, "exit "+code, output)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	proc, err := p.get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-proc.done
+	return id
+}
+
+func TestProcessesForgetFinished(t *testing.T) {
+	tests := []struct {
+		name     string
+		started  int
+		read     bool
+		wantKept int
+	}{
+		{name: "output read", started: 1, read: true, wantKept: 0},
+		{name: "output not read", started: 3, wantKept: 3},
+		{name: "capped", started: maxFinished + 5, wantKept: maxFinished},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcesses()
+			var last int
+			for i := 0; i < tt.started; i++ {
+				last = startFinished(t, p, "3")
+			}
+			if tt.read {
+				info, output, err := p.Output(last)
+				if err != nil {
+					t.Fatalf("Output: %v", err)
+				}
+				if info.Running || info.ExitCode != 3 || output != "done\n" {
+					t.Errorf("Output = %+v, %q; want exit code 3 and the output", info, output)
+				}
+				if _, _, err := p.Output(last); err == nil {
+					t.Error("finished process still known after its output was read")
+				}
+			}
+			if got := len(p.List()); got != tt.wantKept {
+				t.Errorf("kept %d processes, want %d", got, tt.wantKept)
+			}
+			if _, _, err := p.Output(last); !tt.read && err != nil {
+				t.Errorf("newest process was dropped: %v", err)
+			}
+		})
+	}
+}
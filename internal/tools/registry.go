@@ -29,6 +29,11 @@ func (r *Registry) RegisterTool(tool Tool) {
 	r.tools[tool.Name()] = tool
 }
 
+// Clear removes all registered tools
+func (r *Registry) Clear() {
+	r.tools = make(map[string]Tool)
+}
+
 // GetTool returns a tool by name
 func (r *Registry) GetTool(name string) Tool {
 	return r.tools[name]
@@ -58,14 +63,20 @@ func (r *Registry) ParseToolCall(response string) *ToolCall {
 		return nil
 	}
 
-	tool, exists := r.tools[call.Tool]
+	return r.NewToolCall(call.Tool, call.Args)
+}
+
+// NewToolCall prepares a call of the named tool, or returns nil if no such
+// tool is registered
+func (r *Registry) NewToolCall(name string, args map[string]interface{}) *ToolCall {
+	tool, exists := r.tools[name]
 	if !exists {
 		return nil
 	}
 
 	return &ToolCall{
 		tool: tool,
-		args: call.Args,
+		args: args,
 	}
 }
 
@@ -83,3 +94,23 @@ func (tc *ToolCall) Execute(ctx context.Context) string {
 	}
 	return result
 }
+
+// WithArgs returns a call of the same tool with other arguments
+func (tc *ToolCall) WithArgs(args map[string]interface{}) *ToolCall {
+	return &ToolCall{tool: tc.tool, args: args}
+}
+
+// Name returns the name of the tool being called
+func (tc *ToolCall) Name() string {
+	return tc.tool.Name()
+}
+
+// Describe describes the call for the tool policy
+func (tc *ToolCall) Describe() Invocation {
+	return Describe(tc.tool, tc.args)
+}
+
+// Args returns the arguments of the call
+func (tc *ToolCall) Args() map[string]interface{} {
+	return tc.args
+}
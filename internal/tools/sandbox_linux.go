@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/warm3snow/tama/internal/config"
+)
+
+// unshareScript runs as root of a new user and mount namespace. It keeps
+// the writable directories given before "--" writable, makes every mount
+// but /proc read-only, gives the command a private /tmp unless a writable
+// directory is in it, and runs the command after "--" in a nested user
+// namespace that cannot undo the read-only mounts.
+const unshareScript = `dir=$1; shift
+keep=
+while [ "$1" != -- ]; do
+	mount --bind "$1" "$1" || exit 125
+	keep="$keep
+$1"
+	shift
+done
+shift
+awk '{print $2}' /proc/self/mounts | while read -r m; do
+	m=$(printf '%b' "$m")
+	case "$m" in /proc|/proc/*) continue ;; esac
+	case "$keep
+" in *"
+$m
+"*) continue ;; esac
+	mount -o remount,bind,ro "$m" 2>/dev/null
+done
+case "$keep" in *"
+/tmp"*) ;; *) mount -t tmpfs tmpfs /tmp ;; esac
+cd "$dir" || exit 125
+exec unshare -r -- "$@"`
+
+// sandboxCommand returns argv wrapped to run isolated as cfg asks: with a
+// read-only root, writable workspace and writable directories, and without
+// network access if cfg.NoNetwork is set. dir is the working directory.
+func sandboxCommand(cfg config.TerminalConfig, workspace, dir string, writable, argv []string) ([]string, error) {
+	mode := cfg.Sandbox
+	if mode == config.SandboxAuto {
+		switch {
+		case hasCommand("bwrap"):
+			mode = config.SandboxBwrap
+		case hasCommand("unshare"):
+			mode = config.SandboxUnshare
+		default:
+			return nil, fmt.Errorf("no sandbox available: install bubblewrap or util-linux unshare, or set tools.terminal.sandbox to none")
+		}
+	}
+
+	switch mode {
+	case config.SandboxBwrap:
+		if !hasCommand("bwrap") {
+			return nil, fmt.Errorf("sandbox bwrap needs bubblewrap, which is not installed")
+		}
+		wrapped := []string{"bwrap", "--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp"}
+		for _, path := range append([]string{workspace}, writable...) {
+			wrapped = append(wrapped, "--bind", path, path)
+		}
+		wrapped = append(wrapped, "--unshare-pid", "--die-with-parent", "--new-session")
+		if cfg.NoNetwork {
+			wrapped = append(wrapped, "--unshare-net")
+		}
+		wrapped = append(wrapped, "--chdir", dir, "--")
+		return append(wrapped, argv...), nil
+
+	case config.SandboxUnshare:
+		if !hasCommand("unshare") {
+			return nil, fmt.Errorf("sandbox unshare needs util-linux unshare, which is not installed")
+		}
+		wrapped := []string{"unshare", "--user", "--map-root-user", "--mount"}
+		if cfg.NoNetwork {
+			wrapped = append(wrapped, "--net")
+		}
+		wrapped = append(wrapped, "--", "/bin/sh", "-c", unshareScript, "tama-sandbox", dir, workspace)
+		wrapped = append(wrapped, writable...)
+		wrapped = append(wrapped, "--")
+		return append(wrapped, argv...), nil
+	}
+
+	// Without a sandbox, only the network can be cut off
+	if cfg.NoNetwork {
+		if !hasCommand("unshare") {
+			return nil, fmt.Errorf("no_network needs util-linux unshare, which is not installed")
+		}
+		return append([]string{"unshare", "--user", "--map-root-user", "--net", "--"}, argv...), nil
+	}
+	return argv, nil
+}
+
+// hasCommand reports whether a program is on the PATH
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
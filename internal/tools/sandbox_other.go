@@ -0,0 +1,20 @@
+//go:build !linux
+
+package tools
+
+import (
+	"fmt"
+
+	"github.com/warm3snow/tama/internal/config"
+)
+
+// sandboxCommand returns argv unchanged; isolation needs Linux namespaces
+func sandboxCommand(cfg config.TerminalConfig, workspace, dir string, writable, argv []string) ([]string, error) {
+	switch {
+	case cfg.Sandbox != "" && cfg.Sandbox != config.SandboxNone:
+		return nil, fmt.Errorf("sandbox %s is only available on Linux", cfg.Sandbox)
+	case cfg.NoNetwork:
+		return nil, fmt.Errorf("no_network is only available on Linux")
+	}
+	return argv, nil
+}
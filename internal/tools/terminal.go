@@ -2,63 +2,374 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/warm3snow/tama/internal/config"
+	"github.com/warm3snow/tama/internal/workspace"
 )
 
+// safeEnv are the environment variables commands get by default. Globs are
+// allowed.
+var safeEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "COLORTERM", "NO_COLOR",
+	"LANG", "LANGUAGE", "LC_*", "TZ", "TMPDIR", "EDITOR", "VISUAL", "XDG_*",
+	"GOPATH", "GOROOT", "GOBIN", "GOCACHE", "GOMODCACHE", "GOFLAGS", "GOPROXY",
+	"GOPRIVATE", "GONOSUMDB", "GOSUMDB", "GOOS", "GOARCH", "GOTOOLCHAIN", "GOWORK",
+	"CGO_*", "CC", "CXX", "PKG_CONFIG_PATH", "NODE_PATH", "NODE_ENV",
+	"PYTHONPATH", "VIRTUAL_ENV", "CONDA_PREFIX", "JAVA_HOME", "CARGO_HOME", "RUSTUP_HOME",
+}
+
+// secretEnv matches the names of variables that likely hold credentials.
+// They are dropped unless configured by their exact name.
+var secretEnv = regexp.MustCompile(`(?i)(KEY|TOKEN|SECRET|PASSW|PASSPHRASE|CREDENTIAL|AUTH)`)
+
+// envName matches valid environment variable names
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// shellSafe matches words that need no quoting in a shell
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
 // RunTerminalTool implements terminal command execution functionality
 type RunTerminalTool struct {
 	workspacePath string
+	resolver      *workspace.Resolver
+	cfg           config.TerminalConfig
+	processes     *Processes
 }
 
-// NewRunTerminalTool creates a new terminal command execution tool
-func NewRunTerminalTool(workspacePath string) *RunTerminalTool {
+// NewRunTerminalTool creates a new terminal command execution tool confined
+// to the resolver's workspace and limited by cfg. Background commands are
+// tracked in processes.
+func NewRunTerminalTool(resolver *workspace.Resolver, cfg config.TerminalConfig, processes *Processes) *RunTerminalTool {
 	return &RunTerminalTool{
-		workspacePath: workspacePath,
+		workspacePath: resolver.Root(),
+		resolver:      resolver,
+		cfg:           cfg,
+		processes:     processes,
 	}
 }
 
+// CommandResult is the result of a command run in the foreground
+type CommandResult struct {
+	Command    string `json:"command"`
+	Cwd        string `json:"cwd"`       // Relative to the workspace
+	ExitCode   int    `json:"exit_code"` // -1 if the command was killed
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
 func (t *RunTerminalTool) Name() string {
 	return "run_terminal"
 }
 
 func (t *RunTerminalTool) Description() string {
-	return "Execute a terminal command in the workspace"
+	return "Run a shell command line in the workspace; pipes, quoting, redirects and && work " +
+		"(args: command, cwd inside the workspace, env object, stdin, timeout in seconds, background). " +
+		"Returns JSON with exit_code, stdout, stderr and duration_ms; long output keeps its head and tail. " +
+		"Background commands return an id; operation list, output (id) and kill (id) manage them. " +
+		"A finished command is forgotten once its output is read"
+}
+
+// Describe describes a call by its command line, preceded by the variables
+// the env argument sets. Managing background commands only reads, except
+// kill.
+func (t *RunTerminalTool) Describe(args map[string]interface{}) Invocation {
+	operation, _ := args["operation"].(string)
+	switch operation {
+	case "list", "output":
+		return Invocation{Subject: operation, ReadOnly: true}
+	case "kill":
+		return Invocation{Subject: fmt.Sprintf("kill %v", args["id"])}
+	}
+	command, _ := args["command"].(string)
+	subject := strings.TrimSpace(command)
+	if env, ok := args["env"].(map[string]interface{}); ok && len(env) > 0 {
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var assignments []string
+		for _, name := range names {
+			assignments = append(assignments, name+"="+ShellQuote(envValue(env[name])))
+		}
+		subject = strings.Join(assignments, " ") + " " + subject
+	}
+	return Invocation{Subject: subject, Shell: true}
 }
 
 func (t *RunTerminalTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	operation, _ := args["operation"].(string)
+	switch operation {
+	case "", "run":
+		return t.run(ctx, args)
+	case "list":
+		return encodeResult(t.processes.List())
+	case "output":
+		id, err := processID(args)
+		if err != nil {
+			return "", err
+		}
+		info, output, err := t.processes.Output(id)
+		if err != nil {
+			return "", err
+		}
+		status := "running"
+		if !info.Running {
+			status = fmt.Sprintf("exited with code %d", info.ExitCode)
+		}
+		return fmt.Sprintf("Process %d (%s) %s\nOutput:\n%s", info.ID, info.Command, status, output), nil
+	case "kill":
+		id, err := processID(args)
+		if err != nil {
+			return "", err
+		}
+		if err := t.processes.Kill(id); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Killed process %d", id), nil
+	default:
+		return "", fmt.Errorf("unknown operation: %s", operation)
+	}
+}
+
+// run runs a command line through the shell, in the background if asked
+func (t *RunTerminalTool) run(ctx context.Context, args map[string]interface{}) (string, error) {
 	// Extract arguments
 	command, ok := args["command"].(string)
-	if !ok {
+	if !ok || strings.TrimSpace(command) == "" {
 		return "", fmt.Errorf("command argument required")
 	}
 
 	// Optional arguments
 	background, _ := args["background"].(bool)
+	stdin, _ := args["stdin"].(string)
+	timeout, err := t.timeout(args)
+	if err != nil {
+		return "", err
+	}
+	dir, err := t.dir(args)
+	if err != nil {
+		return "", err
+	}
+	env, err := commandArgsEnv(args)
+	if err != nil {
+		return "", err
+	}
 
-	// Split command into parts
-	parts := strings.Fields(command)
-	if len(parts) == 0 {
-		return "", fmt.Errorf("empty command")
+	argv, err := sandboxCommand(t.cfg, t.workspacePath, dir, t.writable(), []string{t.shell(), "-c", command})
+	if err != nil {
+		return "", err
 	}
 
-	// Create command
-	cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
-	cmd.Dir = t.workspacePath
+	maxOutput := t.cfg.OutputLimit()
 
-	// Run command
+	// Background commands outlive the call and are stopped with kill
 	if background {
-		if err := cmd.Start(); err != nil {
-			return "", fmt.Errorf("failed to start command: %v", err)
+		output := newOutputBuffer(maxOutput)
+		cmd := t.command(context.Background(), argv, dir, env, stdin, output, output)
+		id, err := t.processes.Start(cmd, command, output)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Started command in background with id %d: %s", id, command), nil
+	}
+
+	stdout, stderr := newOutputBuffer(maxOutput), newOutputBuffer(maxOutput)
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := t.command(runCtx, argv, dir, env, stdin, stdout, stderr)
+
+	start := time.Now()
+	err = cmd.Run()
+	result := CommandResult{
+		Command:    command,
+		Cwd:        filepath.ToSlash(t.resolver.Rel(dir)),
+		ExitCode:   -1,
+		TimedOut:   errors.Is(runCtx.Err(), context.DeadlineExceeded),
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+
+	// A command that ran is reported with its exit code, even if it failed
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !result.TimedOut {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", fmt.Errorf("command canceled: %v", ctxErr)
 		}
-		return fmt.Sprintf("Started command in background: %s", command), nil
+		return "", fmt.Errorf("failed to run command: %v", err)
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	if result.TimedOut {
+		if result.Stderr != "" && !strings.HasSuffix(result.Stderr, "\n") {
+			result.Stderr += "\n"
+		}
+		result.Stderr += fmt.Sprintf("command timed out after %s", timeout)
+	}
+	return encodeResult(result)
+}
+
+// command prepares argv to run in dir with the scrubbed environment and the
+// extra variables env, stopping it and its children when ctx is done
+func (t *RunTerminalTool) command(ctx context.Context, argv []string, dir string, env []string, stdin string, stdout, stderr *outputBuffer) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(commandEnv(os.Environ(), t.cfg.Env), env...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = time.Second
+	return cmd
+}
+
+// shell returns the program that runs command lines: the configured shell,
+// $SHELL or /bin/sh
+func (t *RunTerminalTool) shell() string {
+	if t.cfg.Shell != "" {
+		return t.cfg.Shell
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
 	}
+	return "/bin/sh"
+}
 
-	output, err := cmd.CombinedOutput()
+// dir returns the working directory of a call: the cwd argument, which must
+// be a directory inside the workspace, or the workspace root
+func (t *RunTerminalTool) dir(args map[string]interface{}) (string, error) {
+	cwd, _ := args["cwd"].(string)
+	if cwd == "" {
+		return t.workspacePath, nil
+	}
+	dir, err := t.resolver.Resolve(cwd)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(dir)
 	if err != nil {
-		return "", fmt.Errorf("command failed: %v\nOutput: %s", err, string(output))
+		return "", fmt.Errorf("invalid cwd: %v", err)
 	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("cwd %s is not a directory", cwd)
+	}
+	return dir, nil
+}
+
+// timeout returns the time limit of a call: the timeout argument in seconds
+// or the configured default
+func (t *RunTerminalTool) timeout(args map[string]interface{}) (time.Duration, error) {
+	if seconds, ok := args["timeout"].(float64); ok {
+		if seconds <= 0 {
+			return 0, fmt.Errorf("timeout must be positive")
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return t.cfg.CommandTimeout(), nil
+}
+
+// writable returns the existing directories a sandboxed command may write
+// besides the workspace
+func (t *RunTerminalTool) writable() []string {
+	var dirs []string
+	for _, dir := range t.cfg.Writable {
+		if strings.HasPrefix(dir, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				dir = filepath.Join(home, dir[2:])
+			}
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(t.workspacePath, dir)
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, filepath.Clean(dir))
+		}
+	}
+	return dirs
+}
 
-	return string(output), nil
+// commandEnv returns the variables of environ whose names are safe or
+// allowed. Names that look like credentials are dropped unless allowed by
+// their exact name.
+func commandEnv(environ, allowed []string) []string {
+	var env []string
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if slices.Contains(allowed, name) ||
+			(!secretEnv.MatchString(name) && (matchesAny(safeEnv, name) || matchesAny(allowed, name))) {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// commandArgsEnv returns the variables of the env argument as NAME=value
+// pairs
+func commandArgsEnv(args map[string]interface{}) ([]string, error) {
+	raw, ok := args["env"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	vars, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("env must be an object of variable names and values")
+	}
+	env := make([]string, 0, len(vars))
+	for name, value := range vars {
+		if !envName.MatchString(name) {
+			return nil, fmt.Errorf("invalid environment variable name %q", name)
+		}
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			return nil, fmt.Errorf("environment variable %s must be a string", name)
+		}
+		env = append(env, name+"="+envValue(value))
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// envValue formats an environment variable value from the tool arguments.
+// Numbers are written out in full, 1000000 rather than 1e+06.
+func envValue(value interface{}) string {
+	if v, ok := value.(float64); ok {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// ShellQuote quotes a word for a POSIX shell if it needs quoting
+func ShellQuote(word string) string {
+	if shellSafe.MatchString(word) {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// processID returns the id argument of a background command operation
+func processID(args map[string]interface{}) (int, error) {
+	id, ok := args["id"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("id argument required")
+	}
+	return int(id), nil
 }
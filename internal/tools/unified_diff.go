@@ -0,0 +1,307 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// devNull is the path diffs use for a missing side of a created or deleted file
+const devNull = "/dev/null"
+
+// FilePatch is the part of a unified diff that applies to one file
+type FilePatch struct {
+	OldPath string // Empty for a created file
+	NewPath string // Empty for a deleted file
+	Hunks   []*Hunk
+}
+
+// Hunk is one @@ section of a unified diff
+type Hunk struct {
+	OldStart int      // First old line, counted from 1
+	NewStart int      // First new line, counted from 1
+	Lines    []string // Hunk body lines, each starting with ' ', '-' or '+'
+}
+
+// HunkResult reports how a hunk was applied
+type HunkResult struct {
+	Index  int    // Hunk number, counted from 1
+	Line   int    // Line the hunk was applied at, counted from 1
+	Offset int    // Distance from the line given in the hunk header
+	Fuzz   int    // Context lines ignored to make the hunk fit
+	Error  string // Why the hunk failed, empty on success
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// ParseUnifiedDiff parses a unified diff with one or more files
+func ParseUnifiedDiff(diff string) ([]*FilePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+
+	var patches []*FilePatch
+	var current *FilePatch
+	var hunk *Hunk
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			current = &FilePatch{
+				OldPath: diffPath(line[4:]),
+				NewPath: diffPath(lines[i+1][4:]),
+			}
+			patches = append(patches, current)
+			hunk = nil
+			i++
+
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk before any --- / +++ file header", i+1)
+			}
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: malformed hunk header %q", i+1, line)
+			}
+			oldStart, _ := strconv.Atoi(m[1])
+			newStart, _ := strconv.Atoi(m[3])
+			hunk = &Hunk{OldStart: oldStart, NewStart: newStart}
+			current.Hunks = append(current.Hunks, hunk)
+
+		case hunk != nil && (line == "" || strings.ContainsAny(line[:1], " -+")):
+			// Models often drop the space of empty context lines
+			if line == "" {
+				line = " "
+			}
+			hunk.Lines = append(hunk.Lines, line)
+
+		case hunk != nil && strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file"
+
+		default:
+			hunk = nil
+		}
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file headers (--- / +++) found in patch")
+	}
+	for _, p := range patches {
+		// Trailing blank lines are usually separators, not context
+		for _, h := range p.Hunks {
+			for len(h.Lines) > 0 && h.Lines[len(h.Lines)-1] == " " {
+				h.Lines = h.Lines[:len(h.Lines)-1]
+			}
+		}
+		if len(p.Hunks) == 0 && p.OldPath != "" && p.NewPath != "" {
+			return nil, fmt.Errorf("patch for %s has no hunks", p.NewPath)
+		}
+	}
+	return patches, nil
+}
+
+// diffPath extracts the path from a --- or +++ header, dropping timestamps
+// and git's a/ and b/ prefixes
+func diffPath(header string) string {
+	path := strings.TrimSpace(strings.SplitN(header, "\t", 2)[0])
+	if path == devNull {
+		return ""
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		path = path[2:]
+	}
+	return path
+}
+
+// Reverse returns a patch that undoes p
+func (p *FilePatch) Reverse() *FilePatch {
+	reversed := &FilePatch{OldPath: p.NewPath, NewPath: p.OldPath}
+	for _, h := range p.Hunks {
+		rh := &Hunk{OldStart: h.NewStart, NewStart: h.OldStart}
+		for _, line := range h.Lines {
+			switch line[0] {
+			case '-':
+				line = "+" + line[1:]
+			case '+':
+				line = "-" + line[1:]
+			}
+			rh.Lines = append(rh.Lines, line)
+		}
+		reversed.Hunks = append(reversed.Hunks, rh)
+	}
+	return reversed
+}
+
+// sides returns the lines a hunk expects and the lines it produces
+func (h *Hunk) sides() (old, new []string) {
+	for _, line := range h.Lines {
+		switch line[0] {
+		case ' ':
+			old = append(old, line[1:])
+			new = append(new, line[1:])
+		case '-':
+			old = append(old, line[1:])
+		case '+':
+			new = append(new, line[1:])
+		}
+	}
+	return old, new
+}
+
+// leadingContext returns the number of context lines before the first change
+func (h *Hunk) leadingContext() int {
+	n := 0
+	for _, line := range h.Lines {
+		if line[0] != ' ' {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// trailingContext returns the number of context lines after the last change
+func (h *Hunk) trailingContext() int {
+	n := 0
+	for i := len(h.Lines) - 1; i >= 0 && h.Lines[i][0] == ' '; i-- {
+		n++
+	}
+	return n
+}
+
+// Apply applies the hunks to content. Each hunk is looked for at its line,
+// then at growing offsets, and finally with up to fuzz context lines
+// ignored at either end. The result is only meaningful if no hunk failed.
+func (p *FilePatch) Apply(content string, fuzz int) (string, []HunkResult) {
+	lines := splitLines(content)
+	hadNewline := content == "" || strings.HasSuffix(content, "\n")
+
+	var results []HunkResult
+	offset := 0 // Lines added by earlier hunks
+	floor := 0  // Hunks apply in order and may not overlap
+
+	for i, h := range p.Hunks {
+		result := HunkResult{Index: i + 1}
+		old, new := h.sides()
+
+		applied := false
+		for f := 0; f <= fuzz && !applied; f++ {
+			lead, trail := min(f, h.leadingContext()), min(f, h.trailingContext())
+			if f > 0 && lead == 0 && trail == 0 {
+				break
+			}
+			fOld := old[lead : len(old)-trail]
+			fNew := new[lead : len(new)-trail]
+
+			expected := h.OldStart - 1 + offset + lead
+			if h.OldStart == 0 {
+				expected = 0
+			}
+			pos, ok := findHunk(lines, fOld, expected, floor)
+			if !ok {
+				continue
+			}
+
+			lines = append(lines[:pos], append(append([]string{}, fNew...), lines[pos+len(fOld):]...)...)
+			result.Line = pos + 1
+			result.Offset = pos - expected
+			result.Fuzz = f
+			offset += len(fNew) - len(fOld)
+			floor = pos + len(fNew)
+			applied = true
+		}
+
+		if !applied {
+			result.Error = hunkFailure(lines, old, h.OldStart-1+offset)
+		}
+		results = append(results, result)
+	}
+
+	output := strings.Join(lines, "\n")
+	if len(lines) > 0 && hadNewline {
+		output += "\n"
+	}
+	return output, results
+}
+
+// findHunk returns the position of old in lines nearest to expected, at or
+// after floor. Trailing whitespace is ignored if no exact match exists.
+func findHunk(lines, old []string, expected, floor int) (int, bool) {
+	if len(old) == 0 {
+		// Pure insertion: trust the header
+		if expected < floor {
+			expected = floor
+		}
+		if expected > len(lines) {
+			expected = len(lines)
+		}
+		return expected, true
+	}
+
+	equal := []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+	}
+	for _, eq := range equal {
+		for delta := 0; delta <= len(lines); delta++ {
+			for _, pos := range []int{expected - delta, expected + delta} {
+				if pos < floor || pos+len(old) > len(lines) {
+					continue
+				}
+				if matchAt(lines, old, pos, eq) {
+					return pos, true
+				}
+				if delta == 0 {
+					break
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// matchAt reports whether old matches lines at pos
+func matchAt(lines, old []string, pos int, eq func(a, b string) bool) bool {
+	for i, line := range old {
+		if !eq(lines[pos+i], line) {
+			return false
+		}
+	}
+	return true
+}
+
+// hunkFailure describes why a hunk did not apply, showing the expected
+// lines next to what the file has at that position
+func hunkFailure(lines, old []string, expected int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "context not found near line %d.\nExpected:\n", expected+1)
+	for _, line := range old {
+		sb.WriteString("  |" + line + "\n")
+	}
+
+	if expected < 0 {
+		expected = 0
+	}
+	if expected < len(lines) {
+		fmt.Fprintf(&sb, "File has at line %d:\n", expected+1)
+		end := expected + len(old)
+		if end > len(lines) {
+			end = len(lines)
+		}
+		for _, line := range lines[expected:end] {
+			sb.WriteString("  |" + line + "\n")
+		}
+	} else {
+		fmt.Fprintf(&sb, "The file has only %d lines.\n", len(lines))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// splitLines splits content into lines without a trailing empty line
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
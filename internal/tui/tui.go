@@ -0,0 +1,744 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/warm3snow/tama/internal/copilot"
+	"github.com/warm3snow/tama/internal/tools"
+	"github.com/warm3snow/tama/internal/ui"
+)
+
+// Layout constants
+const (
+	sidePanelWidth  = 34 // Width of the status side panel including its border
+	minWidthForSide = 80 // Narrower terminals hide the side panel
+	inputHeight     = 3  // Visible lines of the input editor
+)
+
+var (
+	titleStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("14"))
+	userStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("10"))
+	aiStyle      = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	noticeStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	errorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	faintStyle   = lipgloss.NewStyle().Faint(true)
+	labelStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("13"))
+	panelStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8")).Padding(0, 1)
+	inputStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8"))
+	diffTitle    = lipgloss.NewStyle().Bold(true).Reverse(true).Padding(0, 1)
+	footerStyle  = lipgloss.NewStyle().Faint(true)
+	statusColors = map[string]lipgloss.Color{
+		"in_progress": lipgloss.Color("11"),
+		"completed":   lipgloss.Color("10"),
+		"rejected":    lipgloss.Color("9"),
+		"failed":      lipgloss.Color("9"),
+	}
+)
+
+// Options configures a TUI session
+type Options struct {
+	Goal     string // Agent goal; an empty goal starts a chat session
+	Markdown bool   // Render AI responses as Markdown
+}
+
+// Entry roles in the conversation history
+const (
+	roleUser   = "user"
+	roleAI     = "ai"
+	roleNotice = "notice"
+	roleError  = "error"
+)
+
+// entry is a single message in the conversation history
+type entry struct {
+	role     string
+	content  string
+	rendered string // Cached rendering of a complete entry
+	done     bool
+}
+
+// Messages sent to the model from background work
+type (
+	chunkMsg    string
+	responseMsg struct{ err error }
+	stepMsg     struct{ err error }
+	actionMsg   struct {
+		action  copilot.AgentAction
+		message string
+		err     error
+	}
+	refreshMsg struct {
+		files []string
+		diff  string
+	}
+	// approvalMsg asks about a tool call; the answer is sent on reply
+	approvalMsg struct {
+		inv   tools.Invocation
+		reply chan tools.Approval
+	}
+)
+
+// keyMap holds the key bindings of the TUI
+type keyMap struct {
+	Send      key.Binding
+	Newline   key.Binding
+	Diff      key.Binding
+	AgentDiff key.Binding
+	Close     key.Binding
+	Accept    key.Binding
+	Reject    key.Binding
+	RejectAll key.Binding
+	Quit      key.Binding
+	ForceQuit key.Binding
+	Approve   key.Binding
+	Always    key.Binding
+	Deny      key.Binding
+	PageUp    key.Binding
+	PageDown  key.Binding
+}
+
+var keys = keyMap{
+	Send:      key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "send")),
+	Newline:   key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"), key.WithHelp("alt+enter", "newline")),
+	Diff:      key.NewBinding(key.WithKeys("ctrl+d"), key.WithHelp("ctrl+d", "diff")),
+	AgentDiff: key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "diff")),
+	Close:     key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "close diff")),
+	Accept:    key.NewBinding(key.WithKeys("a"), key.WithHelp("a", "accept")),
+	Reject:    key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "reject")),
+	RejectAll: key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "reject all")),
+	Quit:      key.NewBinding(key.WithKeys("q"), key.WithHelp("q", "quit")),
+	ForceQuit: key.NewBinding(key.WithKeys("ctrl+c"), key.WithHelp("ctrl+c", "quit")),
+	Approve:   key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "allow once")),
+	Always:    key.NewBinding(key.WithKeys("a"), key.WithHelp("a", "allow this session")),
+	Deny:      key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "deny")),
+	PageUp:    key.NewBinding(key.WithKeys("pgup"), key.WithHelp("pgup", "scroll up")),
+	PageDown:  key.NewBinding(key.WithKeys("pgdown"), key.WithHelp("pgdn", "scroll down")),
+}
+
+// confirmKey describes the Approve key when it confirms rejecting all changes
+var confirmKey = key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "confirm reject all"))
+
+// model is the bubbletea model of a TUI session
+type model struct {
+	cop  *copilot.Copilot
+	opts Options
+	send func(tea.Msg) // Delivers messages from background work
+
+	history viewport.Model
+	diff    viewport.Model
+	input   textarea.Model
+
+	entries  []entry
+	files    []string // Changed files from git status
+	diffText string
+	approval *approvalMsg // Tool call waiting for the user's approval
+
+	width, height int
+	busy          bool // A response is streaming
+	deciding      bool // Waiting for an accept/reject decision
+	confirming    bool // Waiting for the user to confirm rejecting all changes
+	finished      bool // The agent session has ended
+	showDiff      bool
+}
+
+// applyTheme takes the TUI colors from the active theme
+func applyTheme(theme *ui.Theme) {
+	if !ui.ColorEnabled() {
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+
+	titleStyle = titleStyle.Foreground(lipgloss.Color(theme.Logo.ANSI()))
+	userStyle = userStyle.Foreground(lipgloss.Color(theme.User.ANSI()))
+	aiStyle = aiStyle.Foreground(lipgloss.Color(theme.AI.ANSI()))
+	noticeStyle = noticeStyle.Foreground(lipgloss.Color(theme.Command.ANSI()))
+	errorStyle = errorStyle.Foreground(lipgloss.Color(theme.Removed.ANSI()))
+	labelStyle = labelStyle.Foreground(lipgloss.Color(theme.Heading.ANSI()))
+	statusColors = map[string]lipgloss.Color{
+		"in_progress": lipgloss.Color(theme.Command.ANSI()),
+		"completed":   lipgloss.Color(theme.Added.ANSI()),
+		"rejected":    lipgloss.Color(theme.Removed.ANSI()),
+		"failed":      lipgloss.Color(theme.Removed.ANSI()),
+	}
+}
+
+// Run starts a full-screen session and blocks until the user quits
+func Run(cop *copilot.Copilot, opts Options) error {
+	applyTheme(ui.CurrentTheme())
+
+	m := newModel(cop, opts)
+	program := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
+	m.send = program.Send
+	cop.SetToolApprover(m.approve)
+
+	_, err := program.Run()
+	return err
+}
+
+// newModel creates the model with its sub-components
+func newModel(cop *copilot.Copilot, opts Options) *model {
+	input := textarea.New()
+	input.Placeholder = "Ask anything... (enter to send, alt+enter for a newline)"
+	input.ShowLineNumbers = false
+	input.CharLimit = 0
+	input.Prompt = ""
+	input.KeyMap.InsertNewline = keys.Newline
+	input.SetHeight(inputHeight)
+
+	m := &model{
+		cop:     cop,
+		opts:    opts,
+		history: viewport.New(0, 0),
+		diff:    viewport.New(0, 0),
+		input:   input,
+	}
+
+	if m.agentMode() {
+		m.addEntry(roleNotice, fmt.Sprintf("Starting AI Agent mode with goal: %s", opts.Goal))
+	} else {
+		m.input.Focus()
+		m.addEntry(roleNotice, fmt.Sprintf("Connected to %s model: %s", cop.GetProvider(), cop.GetModel()))
+	}
+
+	return m
+}
+
+// agentMode reports whether the session drives the agent
+func (m *model) agentMode() bool {
+	return m.opts.Goal != ""
+}
+
+// Init starts the agent or focuses the input
+func (m *model) Init() tea.Cmd {
+	cmds := []tea.Cmd{m.refresh()}
+	if m.agentMode() {
+		m.cop.BeginAgent(m.opts.Goal)
+		cmds = append(cmds, m.startStep())
+	} else {
+		cmds = append(cmds, textarea.Blink)
+	}
+	return tea.Batch(cmds...)
+}
+
+// Update handles input and background messages
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.resize()
+		return m, nil
+
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		if m.showDiff {
+			m.diff, cmd = m.diff.Update(msg)
+		} else {
+			m.history, cmd = m.history.Update(msg)
+		}
+		return m, cmd
+
+	case tea.KeyMsg:
+		if cmd, handled := m.handleKey(msg); handled {
+			return m, cmd
+		}
+
+	case chunkMsg:
+		m.appendChunk(string(msg))
+		return m, nil
+
+	case responseMsg:
+		m.finishResponse(msg.err)
+		return m, m.refresh()
+
+	case stepMsg:
+		m.finishResponse(msg.err)
+		if msg.err == nil {
+			m.deciding = true
+			m.addEntry(roleNotice, "Review the changes: [a]ccept, [r]eject, e[x]it rejecting all changes, [d]iff, [q]uit")
+		} else {
+			m.finished = true
+		}
+		return m, m.refresh()
+
+	case actionMsg:
+		if msg.err != nil {
+			m.addEntry(roleError, msg.err.Error())
+			m.deciding = true
+			return m, nil
+		}
+		m.addEntry(roleNotice, msg.message)
+		if msg.action == copilot.ActionRejectAll {
+			m.finished = true
+			m.addEntry(roleNotice, "Agent stopped. Press q to quit.")
+			return m, m.refresh()
+		}
+		return m, tea.Batch(m.refresh(), m.startStep())
+
+	case approvalMsg:
+		m.approval = &msg
+		m.addEntry(roleNotice, "The agent wants to run a tool that needs your approval:\n"+
+			copilot.DescribeToolCall(msg.inv)+"Allow it? [y]es once, [a]lways this session, [n]o")
+		return m, nil
+
+	case refreshMsg:
+		m.files = msg.files
+		m.diffText = msg.diff
+		m.diff.SetContent(m.diffText)
+		return m, nil
+	}
+
+	// Remaining messages go to the input editor
+	if m.input.Focused() {
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		cmds = append(cmds, cmd)
+	}
+
+	return m, tea.Batch(cmds...)
+}
+
+// handleKey handles key bindings, reporting whether the key was consumed
+func (m *model) handleKey(msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch {
+	case key.Matches(msg, keys.ForceQuit):
+		m.answerApproval(tools.Reject)
+		return tea.Quit, true
+
+	case key.Matches(msg, keys.Diff):
+		m.showDiff = !m.showDiff
+		m.diff.GotoTop()
+		return nil, true
+
+	case key.Matches(msg, keys.Close) && m.showDiff:
+		m.showDiff = false
+		return nil, true
+
+	case key.Matches(msg, keys.PageUp):
+		if m.showDiff {
+			m.diff.ViewUp()
+		} else {
+			m.history.ViewUp()
+		}
+		return nil, true
+
+	case key.Matches(msg, keys.PageDown):
+		if m.showDiff {
+			m.diff.ViewDown()
+		} else {
+			m.history.ViewDown()
+		}
+		return nil, true
+	}
+
+	if m.approval != nil {
+		switch {
+		case key.Matches(msg, keys.Approve):
+			m.answerApproval(tools.ApproveOnce)
+		case key.Matches(msg, keys.Always):
+			m.answerApproval(tools.ApproveSession)
+		case key.Matches(msg, keys.Deny):
+			m.answerApproval(tools.Reject)
+		}
+		return nil, true
+	}
+
+	if m.agentMode() {
+		return m.handleAgentKey(msg), true
+	}
+
+	if key.Matches(msg, keys.Send) {
+		if m.busy {
+			return nil, true
+		}
+		prompt := strings.TrimSpace(m.input.Value())
+		if prompt == "" {
+			return nil, true
+		}
+		if prompt == "exit" || prompt == "quit" {
+			return tea.Quit, true
+		}
+		m.input.Reset()
+		return m.startPrompt(prompt), true
+	}
+
+	return nil, false
+}
+
+// handleAgentKey handles the agent decision keys that replace the agent menu
+func (m *model) handleAgentKey(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, keys.Quit):
+		return tea.Quit
+
+	case key.Matches(msg, keys.AgentDiff):
+		m.showDiff = !m.showDiff
+		m.diff.GotoTop()
+		return nil
+	}
+
+	if !m.deciding {
+		return nil
+	}
+
+	// Rejecting all changes discards work, so it needs a second key
+	if m.confirming {
+		m.confirming = false
+		if !key.Matches(msg, keys.Approve) {
+			m.addEntry(roleNotice, "Kept the changes.")
+			return nil
+		}
+		return m.applyAction(copilot.ActionRejectAll)
+	}
+
+	switch {
+	case key.Matches(msg, keys.Accept):
+		return m.applyAction(copilot.ActionAccept)
+	case key.Matches(msg, keys.Reject):
+		return m.applyAction(copilot.ActionReject)
+	case key.Matches(msg, keys.RejectAll):
+		m.confirming = true
+		m.addEntry(roleNotice, "Reject the current changes and stop? [y]es, any other key keeps them")
+	}
+	return nil
+}
+
+// applyAction applies an agent decision in the background
+func (m *model) applyAction(action copilot.AgentAction) tea.Cmd {
+	m.deciding = false
+	m.showDiff = false
+	cop := m.cop
+	return func() tea.Msg {
+		message, err := cop.ApplyAgentAction(action)
+		return actionMsg{action: action, message: message, err: err}
+	}
+}
+
+// approve asks the user about a tool call from background work and waits
+// for the answer
+func (m *model) approve(inv tools.Invocation) tools.Approval {
+	reply := make(chan tools.Approval, 1)
+	m.send(approvalMsg{inv: inv, reply: reply})
+	return <-reply
+}
+
+// answerApproval answers the tool call waiting for approval, if any
+func (m *model) answerApproval(approval tools.Approval) {
+	if m.approval == nil {
+		return
+	}
+	m.approval.reply <- approval
+	m.approval = nil
+
+	answers := map[tools.Approval]string{
+		tools.ApproveOnce:    "Allowed once.",
+		tools.ApproveSession: "Allowed for this session.",
+		tools.Reject:         "Denied.",
+	}
+	m.addEntry(roleNotice, answers[approval])
+}
+
+// startPrompt sends a chat prompt and streams the response
+func (m *model) startPrompt(prompt string) tea.Cmd {
+	m.addEntry(roleUser, prompt)
+	m.startResponse()
+
+	cop, send := m.cop, m.send
+	return func() tea.Msg {
+		respChan, err := cop.ProcessPrompt(prompt)
+		if err != nil {
+			return responseMsg{err: err}
+		}
+		for chunk := range respChan {
+			send(chunkMsg(chunk))
+		}
+		return responseMsg{}
+	}
+}
+
+// startStep runs the next agent step and streams its response
+func (m *model) startStep() tea.Cmd {
+	m.startResponse()
+
+	cop, send := m.cop, m.send
+	return func() tea.Msg {
+		err := cop.RunAgentStep(func(chunk string) {
+			send(chunkMsg(chunk))
+		})
+		return stepMsg{err: err}
+	}
+}
+
+// refresh reloads the changed files and the diff in the background
+func (m *model) refresh() tea.Cmd {
+	cop := m.cop
+	return func() tea.Msg {
+		diff, err := cop.AgentDiff()
+		if err != nil {
+			diff = fmt.Sprintf("Error getting changes: %v", err)
+		}
+		return refreshMsg{files: cop.ChangedFiles(), diff: diff}
+	}
+}
+
+// startResponse adds an empty AI entry that chunks are streamed into
+func (m *model) startResponse() {
+	m.busy = true
+	m.entries = append(m.entries, entry{role: roleAI})
+	m.updateHistory()
+}
+
+// appendChunk appends streamed text to the current AI entry
+func (m *model) appendChunk(chunk string) {
+	if len(m.entries) == 0 || m.entries[len(m.entries)-1].done {
+		return
+	}
+	m.entries[len(m.entries)-1].content += chunk
+	m.updateHistory()
+}
+
+// finishResponse completes the current AI entry
+func (m *model) finishResponse(err error) {
+	m.busy = false
+	if n := len(m.entries); n > 0 && !m.entries[n-1].done {
+		m.entries[n-1].done = true
+	}
+	if err != nil {
+		m.addEntry(roleError, fmt.Sprintf("Error: %v", err))
+		return
+	}
+	m.updateHistory()
+}
+
+// addEntry appends a complete entry to the history
+func (m *model) addEntry(role, content string) {
+	m.entries = append(m.entries, entry{role: role, content: content, done: true})
+	m.updateHistory()
+}
+
+// resize lays out the components for the current window size
+func (m *model) resize() {
+	mainWidth := m.mainWidth()
+
+	m.input.SetWidth(mainWidth - 2)
+	m.history.Width = mainWidth
+	m.history.Height = m.bodyHeight()
+	m.diff.Width = mainWidth
+	m.diff.Height = m.bodyHeight() - 1
+
+	// Renderings depend on the width
+	for i := range m.entries {
+		m.entries[i].rendered = ""
+	}
+	m.updateHistory()
+}
+
+// mainWidth returns the width of the conversation area
+func (m *model) mainWidth() int {
+	if m.width >= minWidthForSide {
+		return m.width - sidePanelWidth
+	}
+	return m.width
+}
+
+// bodyHeight returns the height of the conversation area
+func (m *model) bodyHeight() int {
+	height := m.height - 2 // Header and footer
+	if !m.agentMode() {
+		height -= inputHeight + 2 // Input editor and its border
+	}
+	if height < 1 {
+		height = 1
+	}
+	return height
+}
+
+// updateHistory re-renders the conversation, following the output when the
+// view was already scrolled to the bottom
+func (m *model) updateHistory() {
+	if m.width == 0 {
+		return
+	}
+	atBottom := m.history.AtBottom()
+
+	var b strings.Builder
+	for i := range m.entries {
+		e := &m.entries[i]
+		if e.done && e.rendered != "" {
+			b.WriteString(e.rendered)
+			continue
+		}
+		rendered := m.renderEntry(e)
+		if e.done {
+			e.rendered = rendered
+		}
+		b.WriteString(rendered)
+	}
+
+	m.history.SetContent(b.String())
+	if atBottom {
+		m.history.GotoBottom()
+	}
+}
+
+// renderEntry renders one history entry for the current width
+func (m *model) renderEntry(e *entry) string {
+	width := m.mainWidth() - 1
+
+	switch e.role {
+	case roleUser:
+		return userStyle.Render("You") + "\n" + lipgloss.NewStyle().Width(width).Render(e.content) + "\n\n"
+	case roleNotice:
+		return noticeStyle.Width(width).Render(e.content) + "\n\n"
+	case roleError:
+		return errorStyle.Width(width).Render(e.content) + "\n\n"
+	}
+
+	content := e.content
+	if !e.done && content == "" {
+		content = "..."
+	}
+
+	rendered := lipgloss.NewStyle().Width(width).Render(content)
+	if m.opts.Markdown {
+		var buf bytes.Buffer
+		out := ui.NewMarkdownRenderer(&buf, width)
+		out.Write([]byte(content))
+		out.Flush()
+		rendered = buf.String()
+	}
+	return aiStyle.Render("AI") + "\n" + strings.TrimRight(rendered, "\n") + "\n\n"
+}
+
+// View renders the screen
+func (m *model) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	mode := "Chat"
+	if m.agentMode() {
+		mode = "Agent"
+	}
+	header := titleStyle.Render("TAMA AI · "+mode) + faintStyle.Render(fmt.Sprintf("  %s/%s", m.cop.GetProvider(), m.cop.GetModel()))
+
+	var main string
+	if m.showDiff {
+		main = diffTitle.Render("Diff (esc or ctrl+d to close)") + "\n" + m.diff.View()
+	} else {
+		main = m.history.View()
+	}
+	main = lipgloss.NewStyle().Width(m.mainWidth()).Height(m.bodyHeight()).Render(main)
+
+	if !m.agentMode() {
+		main = lipgloss.JoinVertical(lipgloss.Left, main, inputStyle.Render(m.input.View()))
+	}
+
+	body := main
+	if m.width >= minWidthForSide {
+		body = lipgloss.JoinHorizontal(lipgloss.Top, main, m.sidePanel())
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, header, body, m.footer())
+}
+
+// sidePanel renders the task state, changed files and token usage
+func (m *model) sidePanel() string {
+	inner := sidePanelWidth - 4 // Border and padding
+	var b strings.Builder
+
+	if status := m.cop.AgentStatus(); status != nil {
+		b.WriteString(labelStyle.Render("Goal") + "\n")
+		b.WriteString(lipgloss.NewStyle().Width(inner).Render(status.Goal) + "\n\n")
+
+		b.WriteString(labelStyle.Render("Task") + "\n")
+		if task := status.CurrentTask; task != nil {
+			description := task.Description
+			if description == "" {
+				description = "(untitled)"
+			}
+			b.WriteString(lipgloss.NewStyle().Width(inner).Render(description) + "\n")
+			b.WriteString(lipgloss.NewStyle().Foreground(statusColors[task.Status]).Render(task.Status))
+			b.WriteString(faintStyle.Render(fmt.Sprintf(" · %s", time.Since(task.StartTime).Round(time.Second))) + "\n")
+		} else {
+			b.WriteString(faintStyle.Render("starting...") + "\n")
+		}
+		b.WriteString(faintStyle.Render(fmt.Sprintf("%d tasks completed", len(status.CompletedTasks))) + "\n\n")
+	}
+
+	b.WriteString(labelStyle.Render("Changed files") + "\n")
+	if len(m.files) == 0 {
+		b.WriteString(faintStyle.Render("none") + "\n")
+	}
+	for i, file := range m.files {
+		if i == 10 {
+			b.WriteString(faintStyle.Render(fmt.Sprintf("... %d more", len(m.files)-i)) + "\n")
+			break
+		}
+		b.WriteString(truncate(file, inner) + "\n")
+	}
+
+	usage := m.cop.TokenUsage()
+	b.WriteString("\n" + labelStyle.Render("Tokens") + "\n")
+	b.WriteString(fmt.Sprintf("prompt     %d\n", usage.PromptTokens))
+	b.WriteString(fmt.Sprintf("completion %d\n", usage.CompletionTokens))
+	b.WriteString(fmt.Sprintf("total      %d", usage.TotalTokens))
+
+	height := m.height - 4 // Header, footer and border
+	if height < 1 {
+		height = 1
+	}
+	return panelStyle.Width(sidePanelWidth - 2).Height(height).Render(b.String())
+}
+
+// footer renders the key binding help and activity state
+func (m *model) footer() string {
+	var bindings []key.Binding
+	switch {
+	case m.approval != nil:
+		bindings = []key.Binding{keys.Approve, keys.Always, keys.Deny, keys.ForceQuit}
+	case m.agentMode() && m.confirming:
+		bindings = []key.Binding{confirmKey, keys.Quit}
+	case m.agentMode() && m.deciding:
+		bindings = []key.Binding{keys.Accept, keys.Reject, keys.RejectAll, keys.AgentDiff, keys.Quit}
+	case m.agentMode():
+		bindings = []key.Binding{keys.AgentDiff, keys.PageUp, keys.PageDown, keys.Quit}
+	default:
+		bindings = []key.Binding{keys.Send, keys.Newline, keys.Diff, keys.PageUp, keys.ForceQuit}
+	}
+
+	var help []string
+	for _, binding := range bindings {
+		help = append(help, binding.Help().Key+" "+binding.Help().Desc)
+	}
+
+	state := ""
+	switch {
+	case m.busy:
+		state = "thinking... · "
+	case m.finished:
+		state = "done · "
+	}
+	return footerStyle.Render(truncate(state+strings.Join(help, " · "), m.width))
+}
+
+// truncate shortens text to width columns
+func truncate(text string, width int) string {
+	if lipgloss.Width(text) <= width || width < 4 {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && lipgloss.Width(string(runes)) > width-3 {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
@@ -0,0 +1,207 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// markerEscape starts every marker. It is a deprecated, invisible format
+// character that PasteReader drops from terminal input, so text the user
+// types or pastes can never contain a marker, not even a literal ↵.
+const markerEscape = "\U000E0001"
+
+// Markers stand in for newlines and tabs inside a single readline line, so
+// pasted or explicitly continued text is submitted as one message. They are
+// expanded back with ExpandMarkers once the line has been read.
+const (
+	NewlineMarker = markerEscape + "↵"
+	TabMarker     = markerEscape + "⇥"
+)
+
+// escapeTimeout is how long a lone Esc waits for the rest of a sequence
+// before it is passed on as a key press of its own
+const escapeTimeout = 50 * time.Millisecond
+
+// Terminal control sequences for bracketed paste mode
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+	pasteStart        = "\x1b[200~"
+	pasteEnd          = "\x1b[201~"
+)
+
+// EnableBracketedPaste asks the terminal to mark pasted text and returns a
+// function that turns it off again
+func EnableBracketedPaste() func() {
+	fmt.Fprint(os.Stdout, bracketedPasteOn)
+	return func() {
+		fmt.Fprint(os.Stdout, bracketedPasteOff)
+	}
+}
+
+// ExpandMarkers replaces newline and tab markers with the characters they
+// stand for. Escapes left over from a partly deleted marker are dropped.
+func ExpandMarkers(line string) string {
+	line = strings.ReplaceAll(line, NewlineMarker, "\n")
+	line = strings.ReplaceAll(line, TabMarker, "\t")
+	return strings.ReplaceAll(line, markerEscape, "")
+}
+
+// CollapseMarkers is the inverse of ExpandMarkers: it turns a message into a
+// single line, as needed for the line based history file
+func CollapseMarkers(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n", NewlineMarker)
+	return strings.ReplaceAll(text, "\t", TabMarker)
+}
+
+// PasteReader translates terminal input for readline: newlines and tabs
+// inside a bracketed paste, and Alt+Enter, become markers instead of
+// submitting the line or triggering completion
+type PasteReader struct {
+	r       io.Reader
+	reading chan readResult // Result of the read in progress, if any
+	err     error           // Error returned by the underlying reader
+	pending []byte          // Raw input not yet translated
+	out     []byte          // Translated input ready to be read
+	pasting bool            // Inside a bracketed paste
+	lastCR  bool            // The previous pasted byte was a carriage return
+}
+
+// readResult is the outcome of one read from the underlying reader
+type readResult struct {
+	data []byte
+	err  error
+}
+
+// NewPasteReader wraps the terminal input r
+func NewPasteReader(r io.Reader) *PasteReader {
+	return &PasteReader{r: r}
+}
+
+// Read returns translated input. Input that may start an escape sequence
+// is held back until the sequence is complete or escapeTimeout has passed.
+func (p *PasteReader) Read(b []byte) (int, error) {
+	for len(p.out) == 0 {
+		if p.err != nil {
+			return 0, p.err
+		}
+
+		// Only one read is in progress at a time; one that outlives a
+		// timeout is picked up by the next call
+		if p.reading == nil {
+			p.reading = make(chan readResult, 1)
+			go func(reading chan<- readResult) {
+				buf := make([]byte, 4096)
+				n, err := p.r.Read(buf)
+				reading <- readResult{data: buf[:n], err: err}
+			}(p.reading)
+		}
+
+		var timeout <-chan time.Time
+		if len(p.pending) > 0 {
+			timeout = time.After(escapeTimeout)
+		}
+
+		select {
+		case result := <-p.reading:
+			p.reading = nil
+			p.err = result.err
+			p.pending = append(p.pending, result.data...)
+			p.translate(result.err != nil)
+		case <-timeout:
+			p.translate(true)
+		}
+	}
+
+	n := copy(b, p.out)
+	p.out = p.out[n:]
+	return n, nil
+}
+
+// Close closes the underlying reader if it can be closed
+func (p *PasteReader) Close() error {
+	if closer, ok := p.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// translate moves pending input to the output buffer. An escape sequence
+// that may still be incomplete is kept pending unless flush is set.
+func (p *PasteReader) translate(flush bool) {
+	for len(p.pending) > 0 {
+		c := p.pending[0]
+
+		// Markers can only be made here, never typed
+		if c == markerEscape[0] {
+			if bytes.HasPrefix(p.pending, []byte(markerEscape)) {
+				p.pending = p.pending[len(markerEscape):]
+				continue
+			}
+			if len(p.pending) < len(markerEscape) && strings.HasPrefix(markerEscape, string(p.pending)) && !flush {
+				return
+			}
+		}
+
+		if c == '\x1b' {
+			seq, complete := p.matchEscape()
+			if !complete && !flush {
+				return
+			}
+			switch seq {
+			case pasteStart:
+				p.pasting = true
+				p.pending = p.pending[len(seq):]
+				continue
+			case pasteEnd:
+				p.pasting = false
+				p.pending = p.pending[len(seq):]
+				continue
+			case "\x1b\r", "\x1b\n":
+				// Alt+Enter inserts a newline
+				p.out = append(p.out, NewlineMarker...)
+				p.pending = p.pending[len(seq):]
+				continue
+			}
+		}
+
+		p.pending = p.pending[1:]
+		if !p.pasting {
+			p.out = append(p.out, c)
+			continue
+		}
+
+		switch c {
+		case '\r':
+			p.out = append(p.out, NewlineMarker...)
+		case '\n':
+			if !p.lastCR {
+				p.out = append(p.out, NewlineMarker...)
+			}
+		case '\t':
+			p.out = append(p.out, TabMarker...)
+		default:
+			p.out = append(p.out, c)
+		}
+		p.lastCR = c == '\r'
+	}
+}
+
+// matchEscape reports which special sequence starts the pending input, and
+// whether enough input is available to tell
+func (p *PasteReader) matchEscape() (string, bool) {
+	for _, seq := range []string{pasteStart, pasteEnd, "\x1b\r", "\x1b\n"} {
+		if bytes.HasPrefix(p.pending, []byte(seq)) {
+			return seq, true
+		}
+		if len(p.pending) < len(seq) && strings.HasPrefix(seq, string(p.pending)) {
+			return "", false
+		}
+	}
+	return "", true
+}
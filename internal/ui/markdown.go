@@ -0,0 +1,474 @@
+package ui
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+)
+
+// defaultWidth is used when the terminal width cannot be determined
+const defaultWidth = 80
+
+// CodeStyle is the chroma style used to highlight fenced code blocks
+var CodeStyle = "monokai"
+
+var (
+	headingStyle = color.New(color.FgMagenta, color.Bold)
+	boldStyle    = color.New(color.Bold)
+	italicStyle  = color.New(color.Italic)
+	codeStyle    = color.New(color.FgCyan)
+	linkStyle    = color.New(color.FgBlue, color.Underline)
+	quoteStyle   = color.New(color.Faint)
+	ruleStyle    = color.New(color.Faint)
+	fenceStyle   = color.New(color.Faint)
+)
+
+var (
+	headingPattern  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	fencePattern    = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([\\w+#.-]*)")
+	rulePattern     = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	bulletPattern   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	orderedPattern  = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	tableSepPattern = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	inlinePattern   = regexp.MustCompile("`[^`]+`|\\*\\*[^*]+\\*\\*|__[^_]+__|\\*[^*\\s][^*]*\\*|\\[[^\\]]+\\]\\([^)]+\\)")
+)
+
+// ResponseWriter receives streamed AI output. Flush must be called once the
+// response is complete to emit any buffered content.
+type ResponseWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// NewResponseWriter returns a writer that renders Markdown when markdown is
+// true and passes output through unchanged otherwise
+func NewResponseWriter(out io.Writer, markdown bool) ResponseWriter {
+	if !markdown {
+		return rawWriter{out}
+	}
+	return NewMarkdownRenderer(out, TerminalWidth())
+}
+
+// TerminalWidth returns the width of the terminal, or a default when unknown
+func TerminalWidth() int {
+	if width := readline.GetScreenWidth(); width > 0 {
+		return width
+	}
+	return defaultWidth
+}
+
+// rawWriter passes output through without rendering
+type rawWriter struct {
+	out io.Writer
+}
+
+func (w rawWriter) Write(p []byte) (int, error) {
+	return w.out.Write(p)
+}
+
+func (w rawWriter) Flush() error {
+	return nil
+}
+
+// MarkdownRenderer renders streamed Markdown for the terminal. Text is
+// rendered line by line as it arrives; fenced code blocks and tables are
+// buffered until they are complete so they can be highlighted and aligned.
+type MarkdownRenderer struct {
+	out   io.Writer
+	width int
+
+	line  strings.Builder // Incomplete line
+	fence string          // Opening fence of the current code block
+	lang  string          // Language of the current code block
+	code  []string        // Lines of the current code block
+	table []string        // Lines of the current table
+}
+
+// NewMarkdownRenderer creates a renderer that wraps text at width columns
+func NewMarkdownRenderer(out io.Writer, width int) *MarkdownRenderer {
+	if width <= 0 {
+		width = defaultWidth
+	}
+	return &MarkdownRenderer{out: out, width: width}
+}
+
+// Write buffers a chunk of Markdown and renders every complete line
+func (r *MarkdownRenderer) Write(p []byte) (int, error) {
+	r.line.Write(p)
+
+	text := r.line.String()
+	end := strings.LastIndex(text, "\n")
+	if end == -1 {
+		return len(p), nil
+	}
+
+	r.line.Reset()
+	r.line.WriteString(text[end+1:])
+
+	for _, line := range strings.Split(text[:end], "\n") {
+		if err := r.renderLine(strings.TrimSuffix(line, "\r")); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush renders any buffered content, closing unterminated blocks
+func (r *MarkdownRenderer) Flush() error {
+	if r.line.Len() > 0 {
+		line := r.line.String()
+		r.line.Reset()
+		if err := r.renderLine(line); err != nil {
+			return err
+		}
+	}
+	if r.fence != "" {
+		if err := r.flushCode(); err != nil {
+			return err
+		}
+	}
+	return r.flushTable()
+}
+
+// renderLine renders a single complete line
+func (r *MarkdownRenderer) renderLine(line string) error {
+	// Inside a code block everything is buffered until the closing fence
+	if r.fence != "" {
+		if strings.HasPrefix(strings.TrimSpace(line), r.fence) && strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), r.fence[:1])) == "" {
+			return r.flushCode()
+		}
+		r.code = append(r.code, line)
+		return nil
+	}
+
+	if isTableLine(line) {
+		r.table = append(r.table, line)
+		return nil
+	}
+	if err := r.flushTable(); err != nil {
+		return err
+	}
+
+	if match := fencePattern.FindStringSubmatch(line); match != nil {
+		r.fence = match[1]
+		r.lang = match[2]
+		r.code = nil
+		return nil
+	}
+
+	return r.print(r.renderText(line))
+}
+
+// renderText renders a line that is not part of a code block or table
+func (r *MarkdownRenderer) renderText(line string) string {
+	trimmed := strings.TrimSpace(line)
+
+	if trimmed == "" {
+		return "\n"
+	}
+
+	if match := headingPattern.FindStringSubmatch(trimmed); match != nil {
+		text := stripInline(match[2])
+		if len(match[1]) == 1 {
+			text = strings.ToUpper(text)
+		}
+		return headingStyle.Sprint(text) + "\n"
+	}
+
+	if rulePattern.MatchString(line) {
+		return ruleStyle.Sprint(strings.Repeat("─", r.width-1)) + "\n"
+	}
+
+	if strings.HasPrefix(trimmed, ">") {
+		text := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+		prefix := quoteStyle.Sprint("│ ")
+		return r.wrap(text, prefix, prefix, 2)
+	}
+
+	if match := bulletPattern.FindStringSubmatch(line); match != nil {
+		indent := strings.Repeat(" ", len(match[1]))
+		return r.wrap(match[2], indent+"• ", indent+"  ", len(indent)+2)
+	}
+
+	if match := orderedPattern.FindStringSubmatch(line); match != nil {
+		indent := strings.Repeat(" ", len(match[1]))
+		marker := match[2] + " "
+		return r.wrap(match[3], indent+marker, indent+strings.Repeat(" ", len(marker)), len(indent)+len(marker))
+	}
+
+	return r.wrap(trimmed, "", "", 0)
+}
+
+// span is a run of text with a single inline style
+type span struct {
+	text  string
+	style *color.Color
+}
+
+// parseInline splits text into styled spans for code, emphasis and links
+func parseInline(text string) []span {
+	var spans []span
+	last := 0
+	for _, loc := range inlinePattern.FindAllStringIndex(text, -1) {
+		if loc[0] > last {
+			spans = append(spans, span{text: text[last:loc[0]]})
+		}
+		token := text[loc[0]:loc[1]]
+		switch {
+		case strings.HasPrefix(token, "`"):
+			spans = append(spans, span{text: token[1 : len(token)-1], style: codeStyle})
+		case strings.HasPrefix(token, "**"), strings.HasPrefix(token, "__"):
+			spans = append(spans, span{text: token[2 : len(token)-2], style: boldStyle})
+		case strings.HasPrefix(token, "*"):
+			spans = append(spans, span{text: token[1 : len(token)-1], style: italicStyle})
+		case strings.HasPrefix(token, "["):
+			sep := strings.Index(token, "](")
+			label, url := token[1:sep], token[sep+2:len(token)-1]
+			spans = append(spans, span{text: label, style: linkStyle})
+			if url != label {
+				spans = append(spans, span{text: " (" + url + ")", style: quoteStyle})
+			}
+		}
+		last = loc[1]
+	}
+	if last < len(text) {
+		spans = append(spans, span{text: text[last:]})
+	}
+	return spans
+}
+
+// stripInline removes inline Markdown markers, keeping the text
+func stripInline(text string) string {
+	var b strings.Builder
+	for _, s := range parseInline(text) {
+		b.WriteString(s.text)
+	}
+	return b.String()
+}
+
+// wrap renders inline Markdown and wraps it at the renderer width. The first
+// line starts with first, continuation lines with rest; indent is the visible
+// width of both prefixes.
+func (r *MarkdownRenderer) wrap(text, first, rest string, indent int) string {
+	var b strings.Builder
+	b.WriteString(first)
+	column := indent
+	limit := r.width - 1
+
+	for _, s := range parseInline(text) {
+		words := strings.SplitAfter(s.text, " ")
+		for _, word := range words {
+			if word == "" {
+				continue
+			}
+			width := displayWidth(strings.TrimRight(word, " "))
+			if column > indent && column+width > limit {
+				b.WriteString("\n")
+				b.WriteString(rest)
+				column = indent
+				word = strings.TrimLeft(word, " ")
+			}
+			if s.style != nil {
+				b.WriteString(s.style.Sprint(word))
+			} else {
+				b.WriteString(word)
+			}
+			column += displayWidth(word)
+		}
+	}
+
+	b.WriteString("\n")
+	return b.String()
+}
+
+// flushCode renders the buffered code block with syntax highlighting
+func (r *MarkdownRenderer) flushCode() error {
+	code := strings.Join(r.code, "\n") + "\n"
+	lang := r.lang
+	r.fence, r.lang, r.code = "", "", nil
+
+	label := lang
+	if label == "" {
+		label = "code"
+	}
+	if err := r.print(fenceStyle.Sprint("┌─ "+label) + "\n"); err != nil {
+		return err
+	}
+	if err := r.print(highlight(code, lang)); err != nil {
+		return err
+	}
+	return r.print(fenceStyle.Sprint("└─") + "\n")
+}
+
+// highlight returns code with terminal syntax highlighting for lang
+func highlight(code, lang string) string {
+	if color.NoColor {
+		return code
+	}
+
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		lexer = lexers.Analyse(code)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	formatter := formatters.Get("terminal256")
+	style := styles.Get(CodeStyle)
+
+	iterator, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return code
+	}
+
+	var b strings.Builder
+	if err := formatter.Format(&b, style, iterator); err != nil {
+		return code
+	}
+	return b.String() + "\033[0m"
+}
+
+// isTableLine reports whether line looks like a Markdown table row
+func isTableLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return len(trimmed) > 1 && strings.HasPrefix(trimmed, "|")
+}
+
+// flushTable renders the buffered table with aligned columns
+func (r *MarkdownRenderer) flushTable() error {
+	if len(r.table) == 0 {
+		return nil
+	}
+	lines := r.table
+	r.table = nil
+
+	// A single row without a separator is not a table
+	if len(lines) < 2 || !tableSepPattern.MatchString(lines[1]) {
+		for _, line := range lines {
+			if err := r.print(r.renderText(line)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	header := splitRow(lines[0])
+	aligns := make([]string, len(header))
+	for i, cell := range splitRow(lines[1]) {
+		if i >= len(aligns) {
+			break
+		}
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			aligns[i] = "center"
+		case strings.HasSuffix(cell, ":"):
+			aligns[i] = "right"
+		}
+	}
+
+	rows := [][]string{header}
+	for _, line := range lines[2:] {
+		rows = append(rows, splitRow(line))
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range rows {
+		for i := range widths {
+			if i < len(row) {
+				if w := displayWidth(stripInline(row[i])); w > widths[i] {
+					widths[i] = w
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	for n, row := range rows {
+		for i, width := range widths {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			if i > 0 {
+				b.WriteString(ruleStyle.Sprint(" │ "))
+			}
+			b.WriteString(renderCell(cell, width, aligns[i], n == 0))
+		}
+		b.WriteString("\n")
+
+		if n == 0 {
+			for i, width := range widths {
+				if i > 0 {
+					b.WriteString(ruleStyle.Sprint("─┼─"))
+				}
+				b.WriteString(ruleStyle.Sprint(strings.Repeat("─", width)))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	return r.print(b.String())
+}
+
+// splitRow splits a table row into trimmed cells
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// renderCell renders inline Markdown in a table cell padded to width
+func renderCell(cell string, width int, align string, header bool) string {
+	var b strings.Builder
+	for _, s := range parseInline(cell) {
+		style := s.style
+		if header {
+			style = boldStyle
+		}
+		if style != nil {
+			b.WriteString(style.Sprint(s.text))
+		} else {
+			b.WriteString(s.text)
+		}
+	}
+
+	pad := width - displayWidth(stripInline(cell))
+	if pad <= 0 {
+		return b.String()
+	}
+	switch align {
+	case "right":
+		return strings.Repeat(" ", pad) + b.String()
+	case "center":
+		return strings.Repeat(" ", pad/2) + b.String() + strings.Repeat(" ", pad-pad/2)
+	default:
+		return b.String() + strings.Repeat(" ", pad)
+	}
+}
+
+// displayWidth returns the number of terminal columns text occupies
+func displayWidth(text string) int {
+	return readline.Runes{}.WidthAll([]rune(text))
+}
+
+// print writes rendered output
+func (r *MarkdownRenderer) print(text string) error {
+	_, err := io.WriteString(r.out, text)
+	return err
+}
@@ -0,0 +1,231 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// DefaultTheme is the theme used when none is configured
+const DefaultTheme = "dark"
+
+// Style is a set of terminal attributes for one UI element
+type Style []color.Attribute
+
+// Color returns a printer for the style
+func (s Style) Color() *color.Color {
+	return color.New(s...)
+}
+
+// ANSI returns the ANSI color index (0-15) of the style's foreground color,
+// or an empty string if it has none
+func (s Style) ANSI() string {
+	for _, attr := range s {
+		switch {
+		case attr >= color.FgBlack && attr <= color.FgWhite:
+			return strconv.Itoa(int(attr - color.FgBlack))
+		case attr >= color.FgHiBlack && attr <= color.FgHiWhite:
+			return strconv.Itoa(int(attr-color.FgHiBlack) + 8)
+		}
+	}
+	return ""
+}
+
+// Theme is a palette for all colored terminal output
+type Theme struct {
+	Name        string
+	Description string
+
+	User    Style // User messages and the input prompt
+	AI      Style // AI response label
+	Command Style // Command output, menus and notices
+	Info    Style // Informational lines such as the connected model
+	Logo    Style // The TAMA logo
+	Heading Style // Markdown headings
+	Code    Style // Inline code
+	Link    Style // Links
+	Muted   Style // Rules, quotes and other secondary text
+	Added   Style // Added lines in diffs
+	Removed Style // Removed lines in diffs
+
+	CodeStyle string // chroma style for fenced code blocks
+}
+
+// themes holds the built-in themes by name
+var themes = map[string]*Theme{
+	"dark": {
+		Name:        "dark",
+		Description: "Light text for dark terminals",
+		User:        Style{color.FgGreen, color.Bold},
+		AI:          Style{color.FgBlue},
+		Command:     Style{color.FgYellow, color.Bold},
+		Info:        Style{color.FgCyan},
+		Logo:        Style{color.FgCyan, color.Bold},
+		Heading:     Style{color.FgMagenta, color.Bold},
+		Code:        Style{color.FgCyan},
+		Link:        Style{color.FgBlue, color.Underline},
+		Muted:       Style{color.Faint},
+		Added:       Style{color.FgGreen},
+		Removed:     Style{color.FgRed},
+		CodeStyle:   "monokai",
+	},
+	"light": {
+		Name:        "light",
+		Description: "Dark text for light terminals",
+		User:        Style{color.FgGreen, color.Bold},
+		AI:          Style{color.FgBlue},
+		Command:     Style{color.FgMagenta, color.Bold},
+		Info:        Style{color.FgBlue},
+		Logo:        Style{color.FgBlue, color.Bold},
+		Heading:     Style{color.FgMagenta, color.Bold},
+		Code:        Style{color.FgRed},
+		Link:        Style{color.FgBlue, color.Underline},
+		Muted:       Style{color.FgHiBlack},
+		Added:       Style{color.FgGreen},
+		Removed:     Style{color.FgRed},
+		CodeStyle:   "github",
+	},
+	"dark-colorblind": {
+		Name:        "dark-colorblind",
+		Description: "Light text for dark terminals (colorblind-friendly)",
+		User:        Style{color.FgHiBlue, color.Bold},
+		AI:          Style{color.FgHiWhite},
+		Command:     Style{color.FgHiYellow, color.Bold},
+		Info:        Style{color.FgHiCyan},
+		Logo:        Style{color.FgHiBlue, color.Bold},
+		Heading:     Style{color.FgHiYellow, color.Bold},
+		Code:        Style{color.FgHiCyan},
+		Link:        Style{color.FgHiBlue, color.Underline},
+		Muted:       Style{color.Faint},
+		Added:       Style{color.FgHiBlue},
+		Removed:     Style{color.FgHiYellow},
+		CodeStyle:   "monokai",
+	},
+	"light-colorblind": {
+		Name:        "light-colorblind",
+		Description: "Dark text for light terminals (colorblind-friendly)",
+		User:        Style{color.FgBlue, color.Bold},
+		AI:          Style{color.FgBlack},
+		Command:     Style{color.FgRed, color.Bold},
+		Info:        Style{color.FgBlue},
+		Logo:        Style{color.FgBlue, color.Bold},
+		Heading:     Style{color.FgBlue, color.Bold},
+		Code:        Style{color.FgRed},
+		Link:        Style{color.FgBlue, color.Underline},
+		Muted:       Style{color.FgHiBlack},
+		Added:       Style{color.FgBlue},
+		Removed:     Style{color.FgRed},
+		CodeStyle:   "github",
+	},
+	"mono": {
+		Name:        "mono",
+		Description: "No colors, only bold and underline",
+		User:        Style{color.Bold},
+		AI:          Style{color.Bold},
+		Command:     Style{color.Bold},
+		Info:        Style{},
+		Logo:        Style{color.Bold},
+		Heading:     Style{color.Bold, color.Underline},
+		Code:        Style{},
+		Link:        Style{color.Underline},
+		Muted:       Style{},
+		Added:       Style{color.Bold},
+		Removed:     Style{},
+		CodeStyle:   "bw",
+	},
+}
+
+// themeOrder is the order themes are listed in the style picker
+var themeOrder = []string{"dark", "light", "dark-colorblind", "light-colorblind", "mono"}
+
+// current is the active theme
+var current = themes[DefaultTheme]
+
+// CurrentTheme returns the active theme
+func CurrentTheme() *Theme {
+	return current
+}
+
+// ThemeNames returns the names of the built-in themes in picker order
+func ThemeNames() []string {
+	return append([]string(nil), themeOrder...)
+}
+
+// GetTheme returns the named theme
+func GetTheme(name string) (*Theme, error) {
+	theme, ok := themes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme %q (available: %v)", name, ThemeNames())
+	}
+	return theme, nil
+}
+
+// SetTheme makes the named theme active. An empty name selects the default.
+func SetTheme(name string) error {
+	if name == "" {
+		name = DefaultTheme
+	}
+	theme, err := GetTheme(name)
+	if err != nil {
+		return err
+	}
+
+	current = theme
+	headingStyle = theme.Heading.Color()
+	codeStyle = theme.Code.Color()
+	linkStyle = theme.Link.Color()
+	quoteStyle = theme.Muted.Color()
+	ruleStyle = theme.Muted.Color()
+	fenceStyle = theme.Muted.Color()
+	CodeStyle = theme.CodeStyle
+	return nil
+}
+
+// ColorEnabled reports whether colored output is enabled. Color is disabled
+// when NO_COLOR is set or output is not a terminal.
+func ColorEnabled() bool {
+	return !color.NoColor
+}
+
+// GitDiffArgs returns the arguments for a git diff colored with the active
+// theme, or without color when color is disabled. The a/ and b/ path
+// prefixes are fixed and external diff drivers are not run, whatever the
+// git configuration says.
+func GitDiffArgs(extra ...string) []string {
+	args := []string{"diff", "--no-color"}
+	if ColorEnabled() {
+		args = []string{
+			"-c", "color.diff.new=" + current.Added.git(),
+			"-c", "color.diff.old=" + current.Removed.git(),
+			"diff", "--color",
+		}
+	}
+	args = append(args, "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/")
+	return append(args, extra...)
+}
+
+// git returns the style as a git color specification
+func (s Style) git() string {
+	var parts []string
+	if fg := s.ANSI(); fg != "" {
+		parts = append(parts, fg)
+	}
+	for _, attr := range s {
+		switch attr {
+		case color.Bold:
+			parts = append(parts, "bold")
+		case color.Faint:
+			parts = append(parts, "dim")
+		case color.Italic:
+			parts = append(parts, "italic")
+		case color.Underline:
+			parts = append(parts, "ul")
+		}
+	}
+	if len(parts) == 0 {
+		return "normal"
+	}
+	return strings.Join(parts, " ")
+}
@@ -2,8 +2,10 @@ package ui
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
-	"github.com/fatih/color"
+	"github.com/chzyer/readline"
 )
 
 const (
@@ -16,33 +18,65 @@ const (
    ╚═╝   ╚═╝  ╚═╝╚═╝     ╚═╝╚═╝  ╚═╝    ╚═╝  ╚═╝╚═╝`
 )
 
-// ShowInitialScreen displays the initial screen with style options
-func ShowInitialScreen() {
+// ShowInitialScreen displays the first-run style picker and returns the
+// name of the chosen theme
+func ShowInitialScreen() (string, error) {
 	fmt.Println("\n* Welcome to Tama AI Assistant!")
 	fmt.Println("\nLet's get started.")
 	fmt.Println("\nChoose the text style that looks best with your terminal:")
-	fmt.Println("To change this later, run /config")
-
-	lightText := color.New(color.FgHiWhite)
-	lightText.Println("> Light text")
-	fmt.Println("  Dark text")
-	fmt.Println("  Light text (colorblind-friendly)")
-	fmt.Println("  Dark text (colorblind-friendly)")
+	fmt.Println("To change this later, run /theme")
+	fmt.Println()
+
+	names := ThemeNames()
+	for i, name := range names {
+		theme := themes[name]
+		fmt.Printf("  %d. %-18s %s\n", i+1, name, theme.Description)
+		ShowThemePreview(theme)
+	}
 
-	fmt.Println("\nPreview")
+	rl, err := readline.New(fmt.Sprintf("\nStyle [1-%d, enter for %s]: ", len(names), DefaultTheme))
+	if err != nil {
+		return "", err
+	}
+	defer rl.Close()
+
+	for {
+		input, err := rl.Readline()
+		if err != nil {
+			return "", err
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return DefaultTheme, nil
+		}
+		if n, err := strconv.Atoi(input); err == nil && n >= 1 && n <= len(names) {
+			return names[n-1], nil
+		}
+		if _, ok := themes[input]; ok {
+			return input, nil
+		}
+		fmt.Printf("Please enter a number between 1 and %d.\n", len(names))
+	}
+}
 
-	fmt.Println("1 function greet() {")
-	color.Green(`2   console.log("Hello, World!");`)
-	color.Green(`3   console.log("Hello, Tama!");`)
-	fmt.Println("4 }")
+// ShowThemePreview prints a short sample rendered with the theme
+func ShowThemePreview(theme *Theme) {
+	fmt.Print("     ")
+	theme.User.Color().Print("You:")
+	fmt.Print(" fix the greeting  ")
+	theme.AI.Color().Print("AI:")
+	fmt.Print(" updated ")
+	theme.Code.Color().Print("greet()")
+	fmt.Print("  ")
+	theme.Removed.Color().Print(`- "Hello"`)
+	fmt.Print(" ")
+	theme.Added.Color().Println(`+ "Hello, Tama!"`)
 }
 
 // ShowSecondScreen displays the logo and welcome message
 func ShowSecondScreen() {
-	coral := color.New(color.FgRed).Add(color.FgYellow)
-
 	fmt.Println("\n* Welcome to Tama AI Assistant!")
-	coral.Println(Logo)
+	current.Logo.Color().Println(Logo)
 	fmt.Println("\nPress Enter to continue...")
 }
 
@@ -58,8 +92,8 @@ func ClearScreen() {
 
 // CreateColoredPrinters returns styled printer functions for user and AI messages
 func CreateColoredPrinters() (userPrinter, aiPrinter func(string)) {
-	userStyle := color.New(color.FgGreen).Add(color.Bold)
-	aiStyle := color.New(color.FgBlue)
+	userStyle := current.User.Color()
+	aiStyle := current.AI.Color()
 
 	userPrinter = func(msg string) {
 		userStyle.Printf("\nYou: %s\n", msg)
@@ -74,7 +108,7 @@ func CreateColoredPrinters() (userPrinter, aiPrinter func(string)) {
 
 // PrintModelInfo displays information about the currently connected model
 func PrintModelInfo(provider, model string) {
-	modelInfo := color.New(color.FgCyan)
+	modelInfo := current.Info.Color()
 	modelInfo.Printf("\nConnected to %s model: %s\n", provider, model)
 	fmt.Println("Type 'exit' or 'quit' to end the conversation.")
 }
@@ -0,0 +1,57 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to path through a temporary file in the same
+// directory followed by a rename, so the file is never left half-written.
+// An existing file keeps its permissions; a new file is created with mode.
+// Writing through a symlink replaces the file it points to.
+func WriteFileAtomic(path string, data []byte, mode os.FileMode) error {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory", path)
+		}
+		mode = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tama-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	tmpPath := tmp.Name()
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		return fail(fmt.Errorf("failed to write file: %v", err))
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(fmt.Errorf("failed to sync file: %v", err))
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return fail(fmt.Errorf("failed to set file mode: %v", err))
+	}
+	if err := tmp.Close(); err != nil {
+		return fail(fmt.Errorf("failed to write file: %v", err))
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace file: %v", err)
+	}
+	return nil
+}
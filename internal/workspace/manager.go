@@ -10,6 +10,7 @@ import (
 // Manager handles workspace operations and state
 type Manager struct {
 	root      string
+	resolver  *Resolver
 	mu        sync.RWMutex
 	openFiles map[string]*File
 }
@@ -30,6 +31,7 @@ func NewManager() *Manager {
 
 	return &Manager{
 		root:      wd,
+		resolver:  NewResolver(wd),
 		openFiles: make(map[string]*File),
 	}
 }
@@ -55,15 +57,13 @@ func (m *Manager) ReadFile(path string) (*File, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	absPath := filepath.Join(m.root, path)
-
-	// Check if path is within workspace
-	if !filepath.HasPrefix(absPath, m.root) {
-		return nil, fmt.Errorf("path is outside workspace: %s", path)
+	absPath, key, err := m.cacheKey(path)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check if file is already open
-	if file, ok := m.openFiles[path]; ok {
+	if file, ok := m.openFiles[key]; ok {
 		// Check if file has been modified
 		if stat, err := os.Stat(absPath); err == nil {
 			if stat.ModTime().Unix() > file.ModTime {
@@ -108,7 +108,7 @@ func (m *Manager) ReadFile(path string) (*File, error) {
 		ModTime: stat.ModTime().Unix(),
 	}
 
-	m.openFiles[path] = file
+	m.openFiles[key] = file
 	return file, nil
 }
 
@@ -117,11 +117,9 @@ func (m *Manager) WriteFile(path string, content []byte) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	absPath := filepath.Join(m.root, path)
-
-	// Check if path is within workspace
-	if !filepath.HasPrefix(absPath, m.root) {
-		return fmt.Errorf("path is outside workspace: %s", path)
+	absPath, key, err := m.cacheKey(path)
+	if err != nil {
+		return err
 	}
 
 	// Create parent directories if they don't exist
@@ -132,12 +130,9 @@ func (m *Manager) WriteFile(path string, content []byte) error {
 		return fmt.Errorf("failed to create directories: %v", err)
 	}
 
-	// Write file
-	if err := os.WriteFile(absPath, content, 0644); err != nil {
-		if os.IsPermission(err) {
-			return fmt.Errorf("permission denied writing file: %s", path)
-		}
-		return fmt.Errorf("failed to write file: %v", err)
+	// Replace the file atomically, keeping its mode
+	if err := WriteFileAtomic(absPath, content, 0644); err != nil {
+		return err
 	}
 
 	stat, err := os.Stat(absPath)
@@ -145,7 +140,7 @@ func (m *Manager) WriteFile(path string, content []byte) error {
 		return fmt.Errorf("failed to get file info: %v", err)
 	}
 
-	m.openFiles[path] = &File{
+	m.openFiles[key] = &File{
 		Path:    path,
 		Content: content,
 		ModTime: stat.ModTime().Unix(),
@@ -154,6 +149,54 @@ func (m *Manager) WriteFile(path string, content []byte) error {
 	return nil
 }
 
+// UpdateFile records content that was written to path outside the manager,
+// so the open file cache matches the file on disk. Files that are not open
+// are left out of the cache.
+func (m *Manager) UpdateFile(path string, content []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	absPath, key, err := m.cacheKey(path)
+	if err != nil {
+		return
+	}
+	file, ok := m.openFiles[key]
+	if !ok {
+		return
+	}
+	stat, err := os.Stat(absPath)
+	if err != nil {
+		delete(m.openFiles, key)
+		return
+	}
+
+	m.openFiles[key] = &File{
+		Path:    file.Path,
+		Content: content,
+		ModTime: stat.ModTime().Unix(),
+	}
+}
+
+// ForgetFile drops path from the open file cache after it was deleted or moved
+func (m *Manager) ForgetFile(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, key, err := m.cacheKey(path); err == nil {
+		delete(m.openFiles, key)
+	}
+}
+
+// cacheKey resolves a workspace path and returns it with its key in the open
+// file cache, the path relative to the root, so every way of writing a path
+// finds the same entry
+func (m *Manager) cacheKey(path string) (string, string, error) {
+	absPath, err := m.resolver.Resolve(path)
+	if err != nil {
+		return "", "", err
+	}
+	return absPath, m.resolver.Rel(absPath), nil
+}
+
 // Cleanup performs any necessary cleanup
 func (m *Manager) Cleanup() {
 	m.mu.Lock()
@@ -206,5 +249,6 @@ func (m *Manager) SetWorkspacePath(path string) error {
 
 	// Set new root path
 	m.root = absPath
+	m.resolver = NewResolver(absPath)
 	return nil
 }
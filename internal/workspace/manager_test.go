@@ -0,0 +1,54 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManagerCacheKey(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(root, "src", "main.go")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager()
+	if err := m.SetWorkspacePath(root); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		read string
+	}{
+		{name: "relative", read: "src/main.go"},
+		{name: "dot slash", read: "./src/main.go"},
+		{name: "unclean", read: "src/../src/main.go"},
+		{name: "absolute", read: path},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.ReadFile(tt.read); err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			// A write made with another spelling of the path within the
+			// same second must still update the cached file
+			m.UpdateFile("src/main.go", []byte("new\n"))
+			file, err := m.ReadFile(tt.read)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if string(file.Content) != "new\n" {
+				t.Errorf("cached content = %q, want the updated content", file.Content)
+			}
+			m.ForgetFile(path)
+			if files := m.GetSummary()["open_files"].([]string); len(files) != 0 {
+				t.Errorf("open files after ForgetFile = %v", files)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/warm3snow/tama/internal/ignore"
+)
+
+// maxSymlinks bounds how many symlinks are followed while resolving a path
+const maxSymlinks = 40
+
+// Resolver turns tool-supplied paths into absolute paths, refusing paths
+// that lead outside the workspace or are protected by .tamaignore or the
+// built-in sensitive file rules. Extra read-only roots may be read but not
+// written.
+type Resolver struct {
+	root         string
+	realRoot     string
+	readOnly     []string
+	realReadOnly []string
+	guards       []guard
+}
+
+// guard protects the sensitive files of one root
+type guard struct {
+	root      string
+	realRoot  string
+	protector *ignore.Protector
+}
+
+// NewResolver creates a resolver for the workspace root and optional
+// read-only roots. Relative read-only roots are taken relative to root.
+func NewResolver(root string, readOnlyRoots ...string) *Resolver {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	r := &Resolver{root: filepath.Clean(root)}
+	r.realRoot = realPath(r.root)
+	r.guards = append(r.guards, guard{r.root, r.realRoot, ignore.NewProtector(r.root)})
+
+	for _, dir := range readOnlyRoots {
+		if dir == "" {
+			continue
+		}
+		if strings.HasPrefix(dir, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				dir = filepath.Join(home, dir[2:])
+			}
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(r.root, dir)
+		}
+		dir = filepath.Clean(dir)
+		r.readOnly = append(r.readOnly, dir)
+		r.realReadOnly = append(r.realReadOnly, realPath(dir))
+		r.guards = append(r.guards, guard{dir, realPath(dir), ignore.NewProtector(dir)})
+	}
+	return r
+}
+
+// Root returns the absolute workspace root
+func (r *Resolver) Root() string {
+	return r.root
+}
+
+// Resolve returns the absolute path of a path to be written. The path may be
+// relative to the workspace or absolute, but must stay inside the workspace
+// after symlinks are followed.
+func (r *Resolver) Resolve(path string) (string, error) {
+	full := r.abs(path)
+	if within(r.root, full) {
+		if !within(r.realRoot, realPath(full)) {
+			return "", fmt.Errorf("path %s leads outside the workspace through a symlink", path)
+		}
+		if filepath.Base(full) == ignore.ProtectFile {
+			return "", fmt.Errorf("%s can only be changed by the user", path)
+		}
+		if err := r.Protected(full); err != nil {
+			return "", err
+		}
+		return full, nil
+	}
+	if r.readOnlyRoot(full) != "" {
+		return "", fmt.Errorf("path %s is read-only", path)
+	}
+	return "", fmt.Errorf("path %s is outside the workspace", path)
+}
+
+// ResolveRead returns the absolute path of a path to be read, which may also
+// lie inside a read-only root
+func (r *Resolver) ResolveRead(path string) (string, error) {
+	full := r.abs(path)
+	if !within(r.root, full) && r.readOnlyRoot(full) == "" {
+		return "", fmt.Errorf("path %s is outside the workspace", path)
+	}
+
+	real := realPath(full)
+	inside := within(r.realRoot, real)
+	for _, dir := range r.realReadOnly {
+		inside = inside || within(dir, real)
+	}
+	if !inside {
+		return "", fmt.Errorf("path %s leads outside the workspace through a symlink", path)
+	}
+	if err := r.Protected(full); err != nil {
+		return "", err
+	}
+	return full, nil
+}
+
+// Protected returns an *ignore.ProtectedError if an absolute path, or the
+// file a symlink leads to, is protected by .tamaignore or the built-in
+// sensitive file rules
+func (r *Resolver) Protected(path string) error {
+	path = filepath.Clean(path)
+	isDir := false
+	if info, err := os.Stat(path); err == nil {
+		isDir = info.IsDir()
+	}
+
+	if err := r.checkGuards(path, isDir); err != nil {
+		return err
+	}
+	if real := realPath(path); real != path {
+		return r.checkGuards(real, isDir)
+	}
+	return nil
+}
+
+// checkGuards checks a path against the guard of the root containing it
+func (r *Resolver) checkGuards(path string, isDir bool) error {
+	for _, g := range r.guards {
+		root := g.root
+		if !within(root, path) {
+			if root = g.realRoot; !within(root, path) {
+				continue
+			}
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		}
+		return g.protector.Check(filepath.ToSlash(rel), isDir)
+	}
+	return nil
+}
+
+// Contains reports whether an absolute path lies inside the workspace
+func (r *Resolver) Contains(path string) bool {
+	return within(r.root, filepath.Clean(path))
+}
+
+// Rel returns an absolute path relative to the workspace root with forward
+// slashes, or the path itself if it is outside the workspace
+func (r *Resolver) Rel(path string) string {
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil || !within(r.root, path) {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// abs cleans a path and makes it absolute against the workspace root
+func (r *Resolver) abs(path string) string {
+	if path == "" {
+		path = "."
+	}
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(r.root, path)
+}
+
+// readOnlyRoot returns the read-only root containing path, or ""
+func (r *Resolver) readOnlyRoot(path string) string {
+	for _, dir := range r.readOnly {
+		if within(dir, path) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// within reports whether path is root or inside it. Both must be clean
+// absolute paths; unlike a prefix check, /repo-evil is not inside /repo.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// realPath follows the symlinks in path. Components that do not exist yet
+// are kept as they are, and a dangling symlink resolves to its target, so
+// writing through it cannot escape the workspace.
+func realPath(path string) string {
+	rest := ""
+	for i := 0; i < maxSymlinks; {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(real, rest)
+		}
+
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				break
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(path), target)
+			}
+			path = filepath.Clean(target)
+			i++
+			continue
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+	return filepath.Join(path, rest)
+}
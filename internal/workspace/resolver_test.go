@@ -0,0 +1,132 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupWorkspace creates a workspace next to an outside directory:
+//
+//	root/src/main.go
+//	root/.env
+//	root/link-out  -> outside
+//	root/link-in   -> root/src
+//	root/dangling  -> outside/new.txt (does not exist)
+//	root/loop      -> root/loop
+//	root-evil/     (shares root's name as a prefix)
+//	outside/secret.txt
+func setupWorkspace(t *testing.T) (root, outside string) {
+	t.Helper()
+	base := t.TempDir()
+	root = filepath.Join(base, "root")
+	outside = filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "src"), outside, filepath.Join(base, "root-evil")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(root, "src", "main.go"):     "package main\n",
+		filepath.Join(root, ".env"):               "KEY=value\n",
+		filepath.Join(outside, "secret.txt"):      "secret\n",
+		filepath.Join(base, "root-evil", "x.txt"): "x\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(root, "link-out"): outside,
+		filepath.Join(root, "link-in"):  filepath.Join(root, "src"),
+		filepath.Join(root, "dangling"): filepath.Join(outside, "new.txt"),
+		filepath.Join(root, "loop"):     filepath.Join(root, "loop"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	return root, outside
+}
+
+func TestResolve(t *testing.T) {
+	root, outside := setupWorkspace(t)
+	r := NewResolver(root, outside)
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string // Path relative to root, when resolving succeeds
+		wantErr string
+	}{
+		{name: "relative file", path: "src/main.go", want: "src/main.go"},
+		{name: "absolute file", path: filepath.Join(root, "src", "main.go"), want: "src/main.go"},
+		{name: "new file", path: "src/new/file.go", want: "src/new/file.go"},
+		{name: "dot segments inside", path: "src/../src/main.go", want: "src/main.go"},
+		{name: "symlink inside", path: "link-in/main.go", want: "link-in/main.go"},
+		{name: "parent escape", path: "../outside/secret.txt", wantErr: "read-only"},
+		{name: "sibling with shared prefix", path: "../root-evil/x.txt", wantErr: "outside the workspace"},
+		{name: "absolute outside", path: "/etc/passwd", wantErr: "outside the workspace"},
+		{name: "symlinked directory escape", path: "link-out/secret.txt", wantErr: "through a symlink"},
+		{name: "new file through symlink", path: "link-out/new.txt", wantErr: "through a symlink"},
+		{name: "dangling symlink", path: "dangling", wantErr: "through a symlink"},
+		{name: "symlink loop", path: "loop/file", want: "loop/file"},
+		{name: "sensitive file", path: ".env", wantErr: ".env"},
+		{name: "protect file", path: ".tamaignore", wantErr: "only be changed by the user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve(%q) = %q, %v; want error containing %q", tt.path, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q): %v", tt.path, err)
+			}
+			if want := filepath.Join(root, tt.want); got != want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.path, got, want)
+			}
+		})
+	}
+}
+
+func TestResolveRead(t *testing.T) {
+	root, outside := setupWorkspace(t)
+	r := NewResolver(root, outside)
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{name: "workspace file", path: "src/main.go"},
+		{name: "read-only root", path: filepath.Join(outside, "secret.txt")},
+		{name: "symlink into read-only root", path: "link-out/secret.txt"},
+		{name: "outside every root", path: "../root-evil/x.txt", wantErr: "outside the workspace"},
+		{name: "sensitive file", path: ".env", wantErr: ".env"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.ResolveRead(tt.path)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("ResolveRead(%q): %v", tt.path, err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("ResolveRead(%q) = %v, want error containing %q", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+
+	// Without the read-only root the symlink is an escape
+	if _, err := NewResolver(root).ResolveRead("link-out/secret.txt"); err == nil {
+		t.Error("ResolveRead followed a symlink out of the workspace")
+	}
+}